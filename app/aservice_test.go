@@ -27,9 +27,10 @@ func (a *serviceA) Configure(c Config) (err error) {
 	return nil
 }
 
-func (a *serviceA) Start(ctx Context) {
+func (a *serviceA) Start(ctx Context) error {
 	// immediately update a state
 	go ctx.Heartbeat()
+	return nil
 }
 
 func (a *serviceA) UnmarshalBinary(raw []byte) error {
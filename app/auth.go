@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Allowlist of client networks. Empty list allows everyone.
+type Allowlist []netip.Prefix
+
+// ParseAllowlist accepts IP addresses and CIDR networks, like 10.0.0.0/8
+func ParseAllowlist(entries []string) (Allowlist, error) {
+	var res Allowlist
+	for _, v := range entries {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allow entry: %s", v)
+			}
+			res = append(res, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow entry: %s", v)
+		}
+		res = append(res, prefix.Masked())
+	}
+	return res, nil
+}
+
+// Allows tells if the client with remote address, like 127.0.0.1:12345, is allowed
+func (a Allowlist) Allows(remoteAddr string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	roleRead  = "read"
+	roleAdmin = "admin"
+)
+
+// apiAuth protects REST API and UI with tokens, that have either read-only
+// or admin role. Health checks are always available for orchestrators.
+type apiAuth struct {
+	allow  Allowlist
+	tokens map[string]string
+}
+
+func newApiAuth(c Config) (*apiAuth, error) {
+	allow, err := ParseAllowlist(c.ListOr("allow"))
+	if err != nil {
+		return nil, err
+	}
+	auth := &apiAuth{
+		allow:  allow,
+		tokens: map[string]string{},
+	}
+	for _, v := range c.ListOr("tokens") {
+		role, token, ok := strings.Cut(v, ":")
+		if !ok || token == "" {
+			return nil, fmt.Errorf("invalid token: expected role:token")
+		}
+		if role != roleRead && role != roleAdmin {
+			return nil, fmt.Errorf("invalid token role: %s", role)
+		}
+		auth.tokens[token] = role
+	}
+	return auth, nil
+}
+
+type roleKey struct{}
+
+// IsAdmin tells if the request came with admin token, so that it's allowed
+// to see secrets, like credentials of proxies. Everyone is admin, if there
+// are no tokens configured.
+func IsAdmin(r *http.Request) bool {
+	role, _ := r.Context().Value(roleKey{}).(string)
+	return role == roleAdmin
+}
+
+// role returns the role of the token from either bearer or basic authorization,
+// where basic auth is there for browsers to open the UI
+func (a *apiAuth) role(r *http.Request) string {
+	token := ""
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	} else if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	if token == "" {
+		return ""
+	}
+	for known, role := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return role
+		}
+	}
+	return ""
+}
+
+func (a *apiAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !a.allow.Allows(r.RemoteAddr) {
+			http.Error(rw, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if len(a.tokens) == 0 {
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), roleKey{}, roleAdmin)))
+			return
+		}
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		role := a.role(r)
+		if role == "" {
+			rw.Header().Set("WWW-Authenticate", `Basic realm="slrp"`)
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if role != roleAdmin && !readOnly {
+			http.Error(rw, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), roleKey{}, role)))
+	})
+}
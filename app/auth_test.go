@@ -0,0 +1,87 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowlist(t *testing.T) {
+	allow, err := ParseAllowlist([]string{"10.0.0.0/8", "127.0.0.1", "2001:db8::/32"})
+	require.NoError(t, err)
+	assert.True(t, allow.Allows("10.1.2.3:1234"))
+	assert.True(t, allow.Allows("127.0.0.1:1234"))
+	assert.True(t, allow.Allows("[::ffff:127.0.0.1]:1234"))
+	assert.True(t, allow.Allows("[2001:db8::1]:1234"))
+	assert.False(t, allow.Allows("127.0.0.2:1234"))
+	assert.False(t, allow.Allows("garbage"))
+
+	assert.True(t, Allowlist(nil).Allows("1.2.3.4:5"))
+
+	_, err = ParseAllowlist([]string{"10.0.0.0/33"})
+	assert.EqualError(t, err, "invalid allow entry: 10.0.0.0/33")
+	_, err = ParseAllowlist([]string{"localhost"})
+	assert.EqualError(t, err, "invalid allow entry: localhost")
+}
+
+func TestApiAuth(t *testing.T) {
+	_, err := newApiAuth(Config{"tokens": "root:abc"})
+	assert.EqualError(t, err, "invalid token role: root")
+	_, err = newApiAuth(Config{"tokens": "admin"})
+	assert.EqualError(t, err, "invalid token: expected role:token")
+	_, err = newApiAuth(Config{"allow": "nope"})
+	assert.EqualError(t, err, "invalid allow entry: nope")
+
+	auth, err := newApiAuth(Config{
+		"tokens": "read:r3ad, admin:adm1n",
+		"allow":  "192.0.2.0/24",
+	})
+	require.NoError(t, err)
+	admin := false
+	inner := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		admin = IsAdmin(r)
+		rw.WriteHeader(200)
+	})
+	handler := auth.middleware(inner)
+	serve := func(method, path string, prepare func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		prepare(r)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, r)
+		return rw
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	anonymous := func(r *http.Request) {}
+
+	assert.Equal(t, 200, serve("GET", "/healthz", anonymous).Code)
+	res := serve("GET", "/api/pool", anonymous)
+	assert.Equal(t, 401, res.Code)
+	assert.Equal(t, `Basic realm="slrp"`, res.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, 401, serve("GET", "/api/pool", bearer("wrong")).Code)
+	assert.Equal(t, 200, serve("GET", "/api/pool", bearer("r3ad")).Code)
+	assert.False(t, admin)
+	assert.Equal(t, 403, serve("DELETE", "/api/pool/x", bearer("r3ad")).Code)
+	assert.Equal(t, 200, serve("DELETE", "/api/pool/x", bearer("adm1n")).Code)
+	assert.True(t, admin)
+	assert.Equal(t, 200, serve("GET", "/", func(r *http.Request) {
+		r.SetBasicAuth("anyone", "r3ad")
+	}).Code)
+	assert.Equal(t, 403, serve("GET", "/healthz", func(r *http.Request) {
+		r.RemoteAddr = "198.51.100.1:1234"
+	}).Code)
+
+	open, err := newApiAuth(Config{})
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	admin = false
+	open.middleware(inner).ServeHTTP(rw, httptest.NewRequest("GET", "/api/pool", nil))
+	assert.Equal(t, 200, rw.Code)
+	assert.True(t, admin)
+}
@@ -40,6 +40,12 @@ type configurable interface {
 	Configure(Config) error
 }
 
+// reconfigurable is implemented by services, that apply configuration changes
+// without a restart. Invalid configuration must not be applied partially.
+type reconfigurable interface {
+	Reconfigure(Config) error
+}
+
 type configuration map[string]Config
 
 func (c Config) StrOr(key, def string) string {
@@ -101,6 +107,26 @@ func (c Config) BoolOr(key string, def bool) bool {
 	}
 }
 
+// ListOr returns comma-separated values, trimming the whitespace around them
+func (c Config) ListOr(key string, def ...string) []string {
+	if c == nil {
+		return def
+	}
+	v, ok := c[key]
+	if !ok {
+		return def
+	}
+	res := []string{}
+	for _, item := range strings.Split(expandEnv(v), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
 func getConfig() (configuration, error) {
 	var raw []byte
 	var err error
@@ -194,3 +194,26 @@ func TestConfigEnvDurs(t *testing.T) {
 	set = config["a"].DurOr("b_c", time.Second*20)
 	assert.Equal(t, time.Second*20, set)
 }
+
+func TestConfigEnvLists(t *testing.T) {
+	defer envm{
+		"SLRP_A_B":   "x, y,,z ",
+		"SLRP_A_B_C": "",
+	}.restore()()
+
+	var cfg Config
+	def := cfg.ListOr("new", "a", "b")
+	assert.Equal(t, []string{"a", "b"}, def)
+
+	config, err := getConfig()
+	assert.NoError(t, err)
+
+	def = config["a"].ListOr("new")
+	assert.Nil(t, def)
+
+	set := config["a"].ListOr("b", "a")
+	assert.Equal(t, []string{"x", "y", "z"}, set)
+
+	set = config["a"].ListOr("b_c", "a")
+	assert.Equal(t, []string{}, set)
+}
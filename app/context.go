@@ -7,8 +7,15 @@ import (
 )
 
 type Service interface {
-	// TODO: Start(Context) error
-	Start(Context)
+	// Start launches background work of the service. Fabric doesn't start
+	// the remaining services and shuts down on the first error.
+	Start(Context) error
+}
+
+// stoppable is implemented by services, that have to finish in-flight work
+// before the shutdown. Services are stopped in reverse initialization order.
+type stoppable interface {
+	Stop(ctx context.Context) error
 }
 
 type Context interface {
@@ -50,7 +57,10 @@ type mockCtx struct {
 }
 
 func (a *mockCtx) Start(s Service) {
-	s.Start(a)
+	err := s.Start(a)
+	if err != nil {
+		panic(err)
+	}
 	a.Spin()
 }
 
@@ -3,13 +3,18 @@ package app
 import (
 	"context"
 	"encoding"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -35,10 +40,17 @@ type Fabric struct {
 	updated       map[string]time.Time
 	flushed       map[string]time.Time
 	configuration configuration
+	configMu      sync.Mutex
 
 	syncService chan string
 	askStats    chan chan stats
+	askFlush    chan chan struct{}
 	syncTrigger *time.Ticker
+
+	writeMu        sync.Mutex
+	flushMu        sync.Mutex
+	flushDurations map[string]*Histogram
+	loaded         atomic.Bool
 }
 
 type stat struct {
@@ -54,32 +66,36 @@ type aServer interface {
 	Close() error
 }
 
-func Run(ctx context.Context, f Factories) {
-	(&Fabric{Factories: f}).Start(ctx)
+// Run starts all services and shuts them down on SIGINT or SIGTERM. Another
+// signal during the shutdown terminates the process immediately.
+func Run(ctx context.Context, f Factories) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return (&Fabric{Factories: f}).Start(ctx)
 }
 
-func (f *Fabric) Start(ctx context.Context) {
+func (f *Fabric) Start(ctx context.Context) error {
 	f.syncService = make(chan string)
 	f.askStats = make(chan chan stats)
+	f.askFlush = make(chan chan struct{})
 	f.updated = map[string]time.Time{}
 	f.flushed = map[string]time.Time{}
 	f.contexts = map[string]*serviceContext{}
 	f.services = map[string]Service{}
 	f.loadConfiguration()
 	f.initLogging()
-	// embedded UI needs server router to attach to
-	f.Factories["server"] = newServer
-	// server needs fabric
-	f.Factories["fabric"] = func() *Fabric {
-		return f
-	}
-	// and every dependency would just recursively resolve
-	singletons, initOrder, err := f.Factories.Init()
+	err := f.initSingletons()
 	if err != nil {
 		panic(err)
 	}
-	f.singletons = singletons
-	f.initOrder = initOrder
+	err = f.configuration.validate(f.schemas(), f.singletons)
+	if err != nil {
+		log.Err(err).Msg("invalid configuration")
+		return fmt.Errorf("config: %w", err)
+	}
 	syncTrigger := f.configuration["app"].DurOr("sync", 1*time.Minute)
 	f.syncTrigger = time.NewTicker(syncTrigger)
 	f.State = f.configuration["app"].StrOr("state", "$HOME/.$APP/data")
@@ -106,11 +122,41 @@ func (f *Fabric) Start(ctx context.Context) {
 	f.initServices()
 	f.configureServices()
 	f.loadState()
-	f.startAll(ctx)
-	go f.sync(ctx)
+	f.loaded.Store(true)
+	// services outlive the parent context, until they are stopped
+	// and their state is flushed
+	services, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = f.startAll(services)
+	go f.sync(services)
+	go f.reloadOnHangup(services)
+	if err == nil {
+		// wait for a signal or for all servers to stop
+		select {
+		case <-ctx.Done():
+		case <-monitor.stopped():
+		}
+	}
+	f.shutdown()
+	return err
+}
 
-	// wait for all servers to stop
-	monitor.Wait()
+func (f *Fabric) initSingletons() error {
+	// embedded UI needs server router to attach to
+	f.Factories["server"] = newServer
+	// server needs fabric
+	f.Factories["fabric"] = func() *Fabric {
+		return f
+	}
+	f.Factories["config"] = newConfigApi
+	// and every dependency would just recursively resolve
+	singletons, initOrder, err := f.Factories.Init()
+	if err != nil {
+		return err
+	}
+	f.singletons = singletons
+	f.initOrder = initOrder
+	return nil
 }
 
 func (f *Fabric) Url() string {
@@ -123,6 +169,7 @@ func (f *Fabric) initLogging() {
 		"debug": zerolog.DebugLevel,
 		"info":  zerolog.InfoLevel,
 		"warn":  zerolog.WarnLevel,
+		"error": zerolog.ErrorLevel,
 	}
 	logLevel := f.configuration["log"].StrOr("level", "info")
 	level, ok := levels[strings.ToLower(logLevel)]
@@ -159,7 +206,7 @@ type monitorServers struct {
 	Singletons
 }
 
-func (m *monitorServers) Start(ctx Context) {
+func (m *monitorServers) Start(ctx Context) error {
 	for s, v := range m.Singletons {
 		srv, ok := v.(aServer)
 		if !ok {
@@ -169,6 +216,59 @@ func (m *monitorServers) Start(ctx Context) {
 		go m.closeOnDone(ctx.Done(), s, srv)
 		go m.listenAndServe(s, srv)
 	}
+	return nil
+}
+
+// stopped is closed, when all servers stop
+func (m *monitorServers) stopped() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		m.Wait()
+		close(done)
+	}()
+	return done
+}
+
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Stop waits for in-flight requests of servers, that support graceful shutdown,
+// and closes all others
+func (m *monitorServers) Stop(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(m.Singletons))
+	for s, v := range m.Singletons {
+		srv, ok := v.(aServer)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(service string, srv aServer) {
+			defer wg.Done()
+			var err error
+			gs, ok := srv.(shutdowner)
+			if ok {
+				err = gs.Shutdown(ctx)
+				if err != nil {
+					// requests didn't finish in time
+					srv.Close()
+				}
+			} else {
+				err = srv.Close()
+			}
+			if err != nil {
+				errs <- fmt.Errorf("%s: %w", service, err)
+			}
+		}(s, srv)
+	}
+	wg.Wait()
+	close(errs)
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
 }
 
 func (m *monitorServers) closeOnDone(done <-chan struct{}, service string, srv aServer) {
@@ -184,21 +284,53 @@ func (m *monitorServers) listenAndServe(service string, server aServer) {
 	m.Done()
 }
 
-func (f *Fabric) startAll(ctx context.Context) {
+func (f *Fabric) startAll(ctx context.Context) error {
 	for _, service := range f.initOrder {
 		log.Debug().Str("service", service).Msg("starting")
 		_, ok := f.services[service]
 		if !ok {
 			continue
 		}
-		f.contexts[service] = &serviceContext{
+		sc := &serviceContext{
 			ctx:  ctx,
 			sync: f.syncService,
 			name: service,
 		}
-		f.services[service].Start(f.contexts[service])
+		err := f.services[service].Start(sc)
+		if err != nil {
+			log.Err(err).Str("service", service).Msg("cannot start")
+			return fmt.Errorf("%s: %w", service, err)
+		}
+		f.contexts[service] = sc
 	}
 	log.Debug().Msg("all services loaded")
+	return nil
+}
+
+// shutdown stops started services in reverse initialization order, so that
+// servers stop accepting requests first and every service finishes in-flight
+// work before services it depends on. The state is flushed only after that.
+func (f *Fabric) shutdown() {
+	f.configMu.Lock()
+	timeout := f.configuration["app"].DurOr("shutdown_timeout", 30*time.Second)
+	f.configMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	log.Info().Dur("timeout", timeout).Msg("shutting down")
+	for i := len(f.initOrder) - 1; i >= 0; i-- {
+		service := f.initOrder[i]
+		_, started := f.contexts[service]
+		if !started {
+			continue
+		}
+		s, ok := f.services[service].(stoppable)
+		if !ok {
+			continue
+		}
+		err := s.Stop(ctx)
+		log.Err(err).Str("service", service).Msg("stopped")
+	}
+	f.flushAll(ctx)
 }
 
 func (f *Fabric) loadState() {
@@ -240,6 +372,29 @@ func (f *Fabric) initServices() {
 	}
 }
 
+// Ping makes sure that the loop, which keeps track of state updates, is alive
+func (h *Fabric) Ping(ctx context.Context) error {
+	resp := make(chan stats, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case h.askStats <- resp:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resp:
+		return nil
+	}
+}
+
+func (h *Fabric) Ready() error {
+	if !h.loaded.Load() {
+		return fmt.Errorf("state is not loaded")
+	}
+	return nil
+}
+
 func (h *Fabric) snapshot() stats {
 	resp := make(chan stats)
 	h.askStats <- resp
@@ -247,12 +402,35 @@ func (h *Fabric) snapshot() stats {
 	return res
 }
 
+// flushAll writes state of all changed services to disk and waits for it
+// until the deadline
+func (h *Fabric) flushAll(ctx context.Context) {
+	done := make(chan struct{})
+	select {
+	case <-ctx.Done():
+		log.Warn().Msg("state is not flushed")
+		return
+	case h.askFlush <- done:
+	}
+	select {
+	case <-ctx.Done():
+		log.Warn().Msg("state is not flushed")
+	case <-done:
+	}
+}
+
 func (h *Fabric) sync(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			h.syncTrigger.Stop()
 			return
+		case done := <-h.askFlush:
+			wg := h.flushChanged()
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
 		case resp := <-h.askStats:
 			s := stats{}
 			for k := range h.services {
@@ -266,68 +444,118 @@ func (h *Fabric) sync(ctx context.Context) {
 			// keep service up-to-date time
 			h.updated[service] = time.Now()
 		case <-h.syncTrigger.C:
-			for service, updated := range h.updated {
-				// some services don't need to have a persistent state
-				_, ok := h.services[service].(encoding.BinaryMarshaler)
-				if !ok {
-					continue
-				}
-				flushed := h.flushed[service]
-				if flushed.After(updated) {
-					continue
-				}
-				// flush state to disk only for those changed
-				log.Info().Str("service", service).Msg("flushing")
-				// theoretically we can make it transactional, but it'll
-				// block all heartbeat producers, so don't really need it now
-				go h.flush(service)
-				// add a channel to ensure that flush succeeded
-				h.flushed[service] = time.Now()
-			}
+			// theoretically we can make it transactional, but it'll
+			// block all heartbeat producers, so don't really need it now
+			h.flushChanged()
 		}
 	}
 }
 
-func (h *Fabric) load(service string) error {
-	l := func(file string) error {
-		f, err := os.Open(file)
-		if err != nil {
-			return err
+// flushChanged writes state to disk only for services, that changed since
+// the last flush
+func (h *Fabric) flushChanged() *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for service, updated := range h.updated {
+		// some services don't need to have a persistent state
+		_, ok := h.services[service].(encoding.BinaryMarshaler)
+		if !ok {
+			continue
+		}
+		flushed := h.flushed[service]
+		if flushed.After(updated) {
+			continue
 		}
-		dec := gob.NewDecoder(f)
-		// TODO: check loads!!
-		return dec.Decode(h.services[service])
+		log.Info().Str("service", service).Msg("flushing")
+		wg.Add(1)
+		go func(service string) {
+			defer wg.Done()
+			h.flush(service)
+		}(service)
+		// add a channel to ensure that flush succeeded
+		h.flushed[service] = time.Now()
 	}
-	db := fmt.Sprintf("%s/%s", h.State, service)
-	err := l(db)
-	if err != nil {
-		err = l(db + ".bak")
+	return &wg
+}
+
+// load falls back to the backup, if the latest snapshot is missing, truncated,
+// corrupted or cannot be migrated
+func (h *Fabric) load(service string) error {
+	s, ok := h.services[service].(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%s has no state", service)
 	}
-	return err
+	return loadWithBackup(filepath.Join(h.State, service), s)
+}
+
+func loadWithBackup(db string, s encoding.BinaryUnmarshaler) error {
+	err := loadSnapshot(db, s)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		log.Warn().Err(err).Str("file", db).Msg("loading backup")
+	}
+	bakErr := loadSnapshot(db+".bak", s)
+	if os.IsNotExist(bakErr) {
+		return err
+	}
+	return bakErr
 }
 
 func (h *Fabric) flush(service string) {
+	defer h.observeFlush(service, time.Now())
+	s, ok := h.services[service].(encoding.BinaryMarshaler)
+	if !ok {
+		log.Warn().Str("service", service).Msg("cannot sync: no state")
+		return
+	}
+	// flushes on ticker and on shutdown may overlap
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
 	err := os.MkdirAll(h.State, 0700)
 	if err != nil {
 		log.Err(err).Msg("cannot create folder")
 		return
 	}
-	db := fmt.Sprintf("%s/%s", h.State, service)
-	if _, err := os.Stat(db); err == nil {
-		err = os.Rename(db, db+".bak")
-		if err != nil {
-			log.Warn().Err(err).Str("service", service).Msg("cannot sync backup")
-		}
-	}
-	f, err := os.Create(db)
+	data, err := s.MarshalBinary()
 	if err != nil {
 		log.Warn().Err(err).Str("service", service).Msg("cannot sync")
 		return
 	}
-	defer f.Close()
-	err = gob.NewEncoder(f).Encode(h.services[service])
+	db := filepath.Join(h.State, service)
+	err = writeSnapshot(db, stateVersion(s), data)
 	if err != nil {
-		log.Warn().Err(err).Str("service", service).Msg("cannot sync backup")
+		log.Warn().Err(err).Str("service", service).Msg("cannot sync")
+		return
 	}
 	log.Info().Str("file", db).Str("service", service).Msg("synced state")
 }
+
+func (h *Fabric) observeFlush(service string, start time.Time) {
+	h.flushMu.Lock()
+	defer h.flushMu.Unlock()
+	if h.flushDurations == nil {
+		h.flushDurations = map[string]*Histogram{}
+	}
+	hist, ok := h.flushDurations[service]
+	if !ok {
+		hist = NewHistogram()
+		h.flushDurations[service] = hist
+	}
+	hist.Observe(time.Since(start).Seconds())
+}
+
+func (h *Fabric) CollectMetrics(m *Metrics) {
+	h.flushMu.Lock()
+	defer h.flushMu.Unlock()
+	services := []string{}
+	for k := range h.flushDurations {
+		services = append(services, k)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		m.Histogram("slrp_state_flush_duration_seconds",
+			"Time to write state of a service to disk",
+			h.flushDurations[service], "service", service)
+	}
+}
@@ -6,10 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -107,6 +111,38 @@ func TestFabricStartAndLoadFromBackup(t *testing.T) {
 				assert.NotNil(t, services["server"], "must have server itself")
 			},
 		},
+		{ // health
+			Status: 200,
+			Verb:   "GET",
+			Url:    "/healthz",
+			Match: equalJson(map[string]any{
+				"Status": "ok",
+				"Checks": map[string]any{"fabric": "ok"},
+			}),
+		},
+		{ // readiness
+			Status: 200,
+			Verb:   "GET",
+			Url:    "/readyz",
+			Match: equalJson(map[string]any{
+				"Status": "ok",
+				"Checks": map[string]any{"fabric": "ok"},
+			}),
+		},
+		{ // effective configuration
+			Status: 200,
+			Verb:   "GET",
+			Url:    "/api/config",
+			Match: func(config map[string]any) {
+				assert.Equal(t, map[string]any{
+					"addr":           "127.0.0.1:0",
+					"read_timeout":   "15s",
+					"health_timeout": "5s",
+				}, config["server"])
+				assert.Equal(t, "1s", config["app"].(map[string]any)["sync"])
+				assert.Equal(t, "30s", config["app"].(map[string]any)["shutdown_timeout"])
+			},
+		},
 		{ // HttpGet
 			Status:  200,
 			Verb:    "GET",
@@ -204,9 +240,220 @@ func TestFlushCannotRename(t *testing.T) {
 	fabric.flush("x")
 }
 
+func TestFlushPermissions(t *testing.T) {
+	a := newServiceA()
+	go func() {
+		a.flushed <- nil
+	}()
+	fabric := &Fabric{
+		State:    t.TempDir(),
+		services: map[string]Service{"x": a},
+	}
+	fabric.flush("x")
+	info, err := os.Stat(filepath.Join(fabric.State, "x"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
 func TestFlushCannotCreate(t *testing.T) {
 	fabric := &Fabric{
 		State: t.TempDir(),
 	}
 	fabric.flush("dev/👺")
 }
+
+type rawService struct{}
+
+func (rawService) HttpGet(*http.Request) (any, error) {
+	return Raw{
+		ContentType: "text/plain",
+		Filename:    "a.txt",
+		Body:        []byte("not a json"),
+	}, nil
+}
+
+func TestRawResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	(&httpResource{get: rawService{}}).ServeHTTP(rw, httptest.NewRequest("GET", "/api/raw", nil))
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "text/plain", rw.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="a.txt"`, rw.Header().Get("Content-Disposition"))
+	assert.Equal(t, "not a json", rw.Body.String())
+}
+
+type streamService struct{}
+
+func (streamService) HttpGet(*http.Request) (any, error) {
+	return Stream{
+		ContentType: "text/csv",
+		Filename:    "a.csv",
+		Write: func(w io.Writer) error {
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "%d\n", i)
+			}
+			return nil
+		},
+	}, nil
+}
+
+func TestStreamResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	(&httpResource{get: streamService{}}).ServeHTTP(rw, httptest.NewRequest("GET", "/api/stream", nil))
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "text/csv", rw.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="a.csv"`, rw.Header().Get("Content-Disposition"))
+	assert.Equal(t, "0\n1\n2\n", rw.Body.String())
+}
+
+func TestFlushOnShutdown(t *testing.T) {
+	state := &versionedState{version: 1, data: []byte("last")}
+	stopped := &stoppableService{}
+	fabric := &Fabric{
+		State: t.TempDir(),
+		services: map[string]Service{
+			"x":    serviceWithState{state},
+			"stop": stopped,
+			"skip": &stoppableService{},
+		},
+		initOrder:   []string{"x", "stop", "skip"},
+		contexts:    map[string]*serviceContext{"x": nil, "stop": nil},
+		updated:     map[string]time.Time{"x": time.Now()},
+		flushed:     map[string]time.Time{},
+		askFlush:    make(chan chan struct{}),
+		syncTrigger: time.NewTicker(time.Hour),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fabric.sync(ctx)
+
+	fabric.shutdown()
+	assert.True(t, stopped.stopped)
+
+	version, data, err := readSnapshot(filepath.Join(fabric.State, "x"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), version)
+	assert.Equal(t, []byte("last"), data)
+}
+
+type stoppableService struct {
+	stopped bool
+}
+
+func (s *stoppableService) Start(Context) error {
+	return nil
+}
+
+func (s *stoppableService) Stop(ctx context.Context) error {
+	s.stopped = true
+	return nil
+}
+
+func TestStartError(t *testing.T) {
+	fabric := &Fabric{
+		services: map[string]Service{
+			"a":    &stoppableService{},
+			"fail": failingService{},
+			"b":    &stoppableService{},
+		},
+		initOrder: []string{"a", "fail", "b"},
+		contexts:  map[string]*serviceContext{},
+	}
+	err := fabric.startAll(context.Background())
+	assert.EqualError(t, err, "fail: cannot start")
+	assert.Contains(t, fabric.contexts, "a")
+	assert.NotContains(t, fabric.contexts, "b")
+}
+
+type failingService struct{}
+
+func (failingService) Start(Context) error {
+	return fmt.Errorf("cannot start")
+}
+
+func TestMonitorStop(t *testing.T) {
+	graceful := &http.Server{}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	monitor := Singletons{
+		"graceful": graceful,
+		"other":    closingServer{other},
+	}.Monitor()
+	monitor.Add(1)
+	go func() {
+		defer monitor.Done()
+		graceful.Serve(ln)
+	}()
+
+	err = monitor.Stop(context.Background())
+	assert.NoError(t, err)
+	<-monitor.stopped()
+}
+
+type closingServer struct {
+	net.Listener
+}
+
+func (closingServer) ListenAndServe() error {
+	return nil
+}
+
+// inFlightService finishes its work only after it's asked to stop
+type inFlightService struct {
+	loops   Group
+	started chan bool
+	mu      sync.Mutex
+	data    []byte
+}
+
+func (s *inFlightService) Start(ctx Context) error {
+	loops := s.loops.Start(ctx)
+	s.loops.Go(func() {
+		s.started <- true
+		<-loops.Done()
+		time.Sleep(50 * time.Millisecond)
+		s.mu.Lock()
+		s.data = []byte("finished")
+		s.mu.Unlock()
+	})
+	return nil
+}
+
+func (s *inFlightService) Stop(ctx context.Context) error {
+	return s.loops.Stop(ctx)
+}
+
+func (s *inFlightService) MarshalBinary() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, nil
+}
+
+func TestStopFinishesWorkBeforeFlush(t *testing.T) {
+	service := &inFlightService{
+		started: make(chan bool),
+		data:    []byte("in-flight"),
+	}
+	fabric := &Fabric{
+		State:       t.TempDir(),
+		services:    map[string]Service{"x": service},
+		initOrder:   []string{"x"},
+		contexts:    map[string]*serviceContext{},
+		updated:     map[string]time.Time{"x": time.Now()},
+		flushed:     map[string]time.Time{},
+		askFlush:    make(chan chan struct{}),
+		syncTrigger: time.NewTicker(time.Hour),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fabric.sync(ctx)
+	require.NoError(t, fabric.startAll(ctx))
+	<-service.started
+
+	fabric.shutdown()
+
+	_, data, err := readSnapshot(filepath.Join(fabric.State, "x"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("finished"), data)
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs background goroutines of a service, so that Stop cancels them
+// and waits, until they return. Zero value is ready to use.
+type Group struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+}
+
+// groupCtx is the service context, that is cancelled by the group
+type groupCtx struct {
+	Context
+	ctx context.Context
+}
+
+func (g groupCtx) Ctx() context.Context {
+	return g.ctx
+}
+
+func (g groupCtx) Done() <-chan struct{} {
+	return g.ctx.Done()
+}
+
+// Start returns the context for goroutines of the group, that is cancelled
+// either with the parent or on Stop
+func (g *Group) Start(parent Context) Context {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ctx, cancel := context.WithCancel(parent.Ctx())
+	g.ctx = ctx
+	g.cancel = cancel
+	g.stopped = false
+	return groupCtx{parent, ctx}
+}
+
+// Go runs f in the background
+func (g *Group) Go(f func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f()
+	}()
+}
+
+// Stop cancels the context of the group and waits for goroutines to return
+// or for ctx to be done
+func (g *Group) Stop(ctx context.Context) error {
+	g.mu.Lock()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		g.mu.Lock()
+		g.stopped = true
+		g.mu.Unlock()
+		return nil
+	}
+}
+
+// Done is closed, once the group is stopped or its parent is cancelled. It
+// returns nil, if the group was never started
+func (g *Group) Done() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx == nil {
+		return nil
+	}
+	return g.ctx.Done()
+}
+
+// Stopped tells if all goroutines returned after Stop, so that the state
+// they owned can be accessed directly
+func (g *Group) Stopped() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stopped
+}
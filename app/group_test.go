@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupStop(t *testing.T) {
+	var g Group
+	ctx := g.Start(MockCtx())
+	done := false
+	g.Go(func() {
+		<-ctx.Done()
+		done = true
+	})
+	assert.False(t, g.Stopped())
+	assert.NoError(t, g.Stop(context.Background()))
+	assert.True(t, done)
+	assert.True(t, g.Stopped())
+}
+
+func TestGroupDone(t *testing.T) {
+	var g Group
+	assert.Nil(t, g.Done())
+	g.Start(MockCtx())
+	done := g.Done()
+	assert.NotNil(t, done)
+	assert.NoError(t, g.Stop(context.Background()))
+	<-done
+}
+
+func TestGroupStopTimeout(t *testing.T) {
+	var g Group
+	g.Start(MockCtx())
+	release := make(chan bool)
+	defer close(release)
+	g.Go(func() {
+		<-release
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, g.Stop(ctx), context.DeadlineExceeded)
+	assert.False(t, g.Stopped())
+}
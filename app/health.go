@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// pinger is implemented by services, that reply to ping from their main loop.
+// Ping gives up, once the context is done, so that stuck loops don't keep
+// health checks waiting forever
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// readiness is implemented by services, that may not be ready to serve traffic
+type readiness interface {
+	Ready() error
+}
+
+type healthStatus struct {
+	Status string
+	Checks map[string]string
+}
+
+// healthHandler runs all checks concurrently and replies with 503, if any
+// of them failed or didn't finish within the timeout
+type healthHandler struct {
+	timeout time.Duration
+	checks  map[string]func(context.Context) error
+}
+
+func (hh healthHandler) run(ctx context.Context, check func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, hh.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		if ctx.Err() == nil {
+			return err
+		}
+	case <-ctx.Done():
+	}
+	return fmt.Errorf("not responding within %s", hh.timeout)
+}
+
+func (hh healthHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(hh.checks))
+	for name, check := range hh.checks {
+		go func(name string, check func(context.Context) error) {
+			results <- result{name, hh.run(r.Context(), check)}
+		}(name, check)
+	}
+	status := healthStatus{
+		Status: "ok",
+		Checks: map[string]string{},
+	}
+	for range hh.checks {
+		res := <-results
+		if res.err != nil {
+			status.Status = "failing"
+			status.Checks[res.name] = res.err.Error()
+			continue
+		}
+		status.Checks[res.name] = "ok"
+	}
+	body, _ := json.Marshal(status)
+	rw.Header().Set("Content-Type", "application/json")
+	if status.Status != "ok" {
+		rw.WriteHeader(503)
+	} else {
+		rw.WriteHeader(200)
+	}
+	rw.Write(body)
+}
+
+func readyCheck(r readiness) func(context.Context) error {
+	return func(context.Context) error {
+		return r.Ready()
+	}
+}
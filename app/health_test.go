@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingPinger chan bool
+
+func (b blockingPinger) Ping(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b:
+		return nil
+	}
+}
+
+type cancelledPinger chan error
+
+func (c cancelledPinger) Ping(ctx context.Context) error {
+	<-ctx.Done()
+	c <- ctx.Err()
+	return ctx.Err()
+}
+
+func serveHealth(t *testing.T, hh healthHandler) (int, healthStatus) {
+	rw := httptest.NewRecorder()
+	hh.ServeHTTP(rw, httptest.NewRequest("GET", "/healthz", nil))
+	var status healthStatus
+	err := json.Unmarshal(rw.Body.Bytes(), &status)
+	require.NoError(t, err)
+	return rw.Code, status
+}
+
+func TestHealthHandler(t *testing.T) {
+	stuck := blockingPinger(make(chan bool))
+	defer close(stuck)
+	alive := blockingPinger(make(chan bool))
+	close(alive)
+
+	code, status := serveHealth(t, healthHandler{time.Second, map[string]func(context.Context) error{
+		"alive": alive.Ping,
+	}})
+	assert.Equal(t, 200, code)
+	assert.Equal(t, healthStatus{"ok", map[string]string{"alive": "ok"}}, status)
+
+	code, status = serveHealth(t, healthHandler{10 * time.Millisecond, map[string]func(context.Context) error{
+		"alive":  alive.Ping,
+		"stuck":  stuck.Ping,
+		"broken": readyCheck(brokenReadiness{}),
+	}})
+	assert.Equal(t, 503, code)
+	assert.Equal(t, healthStatus{"failing", map[string]string{
+		"alive":  "ok",
+		"stuck":  "not responding within 10ms",
+		"broken": "nope",
+	}}, status)
+}
+
+type brokenReadiness struct{}
+
+func (brokenReadiness) Ready() error {
+	return fmt.Errorf("nope")
+}
+
+func TestHealthCheckGivesUpOnTimeout(t *testing.T) {
+	cancelled := cancelledPinger(make(chan error, 1))
+	code, status := serveHealth(t, healthHandler{10 * time.Millisecond, map[string]func(context.Context) error{
+		"cancelled": cancelled.Ping,
+	}})
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "not responding within 10ms", status.Checks["cancelled"])
+	select {
+	case err := <-cancelled:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("ping is still running")
+	}
+}
+
+func TestFabricReady(t *testing.T) {
+	fabric := &Fabric{}
+	assert.EqualError(t, fabric.Ready(), "state is not loaded")
+	fabric.loaded.Store(true)
+	assert.NoError(t, fabric.Ready())
+}
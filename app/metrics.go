@@ -0,0 +1,192 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricsCollector is implemented by services, that expose metrics on /metrics
+type metricsCollector interface {
+	CollectMetrics(m *Metrics)
+}
+
+// DefaultBuckets are upper bounds of histogram buckets in seconds
+var DefaultBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics is a set of metric families in Prometheus text exposition format
+type Metrics struct {
+	families map[string]*family
+	order    []string
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		families: map[string]*family{},
+	}
+}
+
+// Gauge adds a sample of a value, that can go up and down. Labels are
+// given as name and value pairs.
+func (m *Metrics) Gauge(name, help string, value float64, labels ...string) {
+	m.family(name, help, "gauge").add(name, value, labels)
+}
+
+// Counter adds a sample of a value, that only goes up
+func (m *Metrics) Counter(name, help string, value float64, labels ...string) {
+	m.family(name, help, "counter").add(name, value, labels)
+}
+
+// Histogram adds cumulative buckets, sum and count of the observations
+func (m *Metrics) Histogram(name, help string, h *Histogram, labels ...string) {
+	f := m.family(name, help, "histogram")
+	buckets, counts, sum, count := h.snapshot()
+	var cumulative uint64
+	for i, le := range buckets {
+		cumulative += counts[i]
+		f.add(name+"_bucket", float64(cumulative), append(labels, "le", formatFloat(le)))
+	}
+	f.add(name+"_bucket", float64(count), append(labels, "le", "+Inf"))
+	f.add(name+"_sum", sum, labels)
+	f.add(name+"_count", float64(count), labels)
+}
+
+func (m *Metrics) family(name, help, kind string) *family {
+	f, ok := m.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind}
+		m.families[name] = f
+		m.order = append(m.order, name)
+	}
+	return f
+}
+
+func (f *family) add(name string, value float64, labels []string) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 1 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i])
+			sb.WriteString(`="`)
+			sb.WriteString(escapeLabel(labels[i+1]))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(formatFloat(value))
+	f.samples = append(f.samples, sb.String())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteTo writes families in the order they were first added
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, name := range m.order {
+		f := m.families[name]
+		n, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		for _, s := range f.samples {
+			n, err = fmt.Fprintln(w, s)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// Histogram counts observations in buckets and is safe for concurrent use
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(buckets ...float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	idx := sort.SearchFloat64s(h.buckets, v)
+	if idx < len(h.buckets) {
+		h.counts[idx]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) snapshot() ([]float64, []uint64, float64, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	return h.buckets, counts, h.sum, h.count
+}
+
+// metricsHandler serves metrics of all collectors in a stable order
+type metricsHandler struct {
+	collectors map[string]metricsCollector
+}
+
+func (mh metricsHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for k := range mh.collectors {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	m := NewMetrics()
+	for _, name := range names {
+		mh.collectors[name].CollectMetrics(m)
+	}
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(200)
+	m.WriteTo(rw)
+}
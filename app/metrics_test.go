@@ -0,0 +1,71 @@
+package app
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type collectorFunc func(m *Metrics)
+
+func (f collectorFunc) CollectMetrics(m *Metrics) {
+	f(m)
+}
+
+func TestMetricsExposition(t *testing.T) {
+	h := NewHistogram(1, 5)
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(3)
+	h.Observe(10)
+
+	m := NewMetrics()
+	m.Gauge("slrp_things", "Number of things", 2, "kind", `a"b`)
+	m.Counter("slrp_events_total", "Events so far", 7)
+	m.Gauge("slrp_things", "Number of things", 1.5, "kind", "c", "state", "ok")
+	m.Histogram("slrp_took_seconds", "Time it took", h, "service", "x")
+
+	var sb strings.Builder
+	_, err := m.WriteTo(&sb)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP slrp_things Number of things
+# TYPE slrp_things gauge
+slrp_things{kind="a\"b"} 2
+slrp_things{kind="c",state="ok"} 1.5
+# HELP slrp_events_total Events so far
+# TYPE slrp_events_total counter
+slrp_events_total 7
+# HELP slrp_took_seconds Time it took
+# TYPE slrp_took_seconds histogram
+slrp_took_seconds_bucket{service="x",le="1"} 2
+slrp_took_seconds_bucket{service="x",le="5"} 3
+slrp_took_seconds_bucket{service="x",le="+Inf"} 4
+slrp_took_seconds_sum{service="x"} 14.5
+slrp_took_seconds_count{service="x"} 4
+`, sb.String())
+}
+
+func TestMetricsHandler(t *testing.T) {
+	fabric := &Fabric{}
+	fabric.observeFlush("pool", time.Now())
+	handler := metricsHandler{map[string]metricsCollector{
+		"b": collectorFunc(func(m *Metrics) {
+			m.Gauge("slrp_b", "B", 1)
+		}),
+		"a": collectorFunc(func(m *Metrics) {
+			m.Gauge("slrp_a", "A", 1)
+		}),
+		"fabric": fabric,
+	}}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rw.Header().Get("Content-Type"))
+	body := rw.Body.String()
+	assert.Less(t, strings.Index(body, "slrp_a 1"), strings.Index(body, "slrp_b 1"))
+	assert.Contains(t, body, `slrp_state_flush_duration_seconds_count{service="pool"} 1`)
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// values of these keys are not logged or returned from the API
+var secretKey = regexp.MustCompile(`(?i)password|token|secret|license|users`)
+
+const redacted = "<redacted>"
+
+type configChange struct {
+	Service string
+	Key     string
+	From    string `json:",omitempty"`
+	To      string `json:",omitempty"`
+}
+
+// diff returns changes of every key in every section, ordered by section and key
+func (c configuration) diff(other configuration, schemas map[string]Schema) (changes []configChange) {
+	services := map[string]bool{}
+	for k := range c {
+		services[k] = true
+	}
+	for k := range other {
+		services[k] = true
+	}
+	for service := range services {
+		keys := map[string]bool{}
+		for k := range c[service] {
+			keys[k] = true
+		}
+		for k := range other[service] {
+			keys[k] = true
+		}
+		for key := range keys {
+			from, hadBefore := c[service][key]
+			to, hasNow := other[service][key]
+			if hadBefore == hasNow && from == to {
+				continue
+			}
+			if schemas[service].secret(key) {
+				from, to = redacted, redacted
+			}
+			changes = append(changes, configChange{
+				Service: service,
+				Key:     key,
+				From:    from,
+				To:      to,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Service != changes[j].Service {
+			return changes[i].Service < changes[j].Service
+		}
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// Reload reads configuration again and applies changes to services, that support
+// it. When any of the services rejects its configuration, services, that already
+// applied their changes, are reconfigured back.
+func (f *Fabric) Reload() ([]configChange, error) {
+	conf, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	return f.reconfigure(conf)
+}
+
+func (f *Fabric) reconfigure(conf configuration) ([]configChange, error) {
+	f.configMu.Lock()
+	defer f.configMu.Unlock()
+	schemas := f.schemas()
+	err := conf.validate(schemas, f.singletons)
+	if err != nil {
+		return nil, err
+	}
+	changes := f.configuration.diff(conf, schemas)
+	changed := map[string]bool{}
+	for _, v := range changes {
+		log.Info().
+			Str("service", v.Service).
+			Str("key", v.Key).
+			Str("from", v.From).
+			Str("to", v.To).
+			Msg("config changed")
+		changed[v.Service] = true
+	}
+	applied := []string{}
+	for _, service := range f.initOrder {
+		if !changed[service] {
+			continue
+		}
+		delete(changed, service)
+		r, ok := f.singletons[service].(reconfigurable)
+		if !ok {
+			log.Warn().Str("service", service).Msg("restart required to apply config")
+			continue
+		}
+		err := r.Reconfigure(conf[service])
+		if err != nil {
+			f.rollback(applied)
+			return nil, fmt.Errorf("%s: %w", service, err)
+		}
+		applied = append(applied, service)
+	}
+	for service := range changed {
+		// app, log and other sections without a service
+		log.Warn().Str("section", service).Msg("restart required to apply config")
+	}
+	for _, service := range applied {
+		f.configuration[service] = conf[service]
+	}
+	log.Info().Strs("services", applied).Msg("reloaded config")
+	return changes, nil
+}
+
+// rollback applies previous configuration, that was valid, in reverse order
+func (f *Fabric) rollback(applied []string) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		service := applied[i]
+		err := f.singletons[service].(reconfigurable).Reconfigure(f.configuration[service])
+		if err != nil {
+			log.Err(err).Str("service", service).Msg("cannot roll back config")
+		}
+	}
+}
+
+// reloadOnHangup reloads configuration on every SIGHUP
+func (f *Fabric) reloadOnHangup(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			_, err := f.Reload()
+			if err != nil {
+				log.Err(err).Msg("cannot reload config")
+			}
+		}
+	}
+}
+
+// configApi exposes configuration of the application
+type configApi struct {
+	fabric *Fabric
+}
+
+func newConfigApi(fabric *Fabric) *configApi {
+	return &configApi{fabric}
+}
+
+// HttpGet returns configuration with defaults of missing keys and with masked secrets
+func (ca *configApi) HttpGet(r *http.Request) (any, error) {
+	return ca.fabric.effective(), nil
+}
+
+func (ca *configApi) HttpPostByID(id string, r *http.Request) (any, error) {
+	if id != "reload" {
+		return nil, NotFound("unknown command: " + id)
+	}
+	return ca.fabric.Reload()
+}
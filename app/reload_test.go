@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDiff(t *testing.T) {
+	before := configuration{
+		"pool":   Config{"offer_limit": "25", "shards": "1", "upstream": "http://a:b@c"},
+		"server": Config{"tokens": "admin:a"},
+		"log":    Config{"level": "info"},
+	}
+	after := configuration{
+		"pool":    Config{"offer_limit": "10", "selection": "fastest", "upstream": "http://a:d@c"},
+		"server":  Config{"tokens": "admin:b"},
+		"history": Config{"limit": "5"},
+		"log":     Config{"level": "info"},
+	}
+	assert.Equal(t, []configChange{
+		{Service: "history", Key: "limit", To: "5"},
+		{Service: "pool", Key: "offer_limit", From: "25", To: "10"},
+		{Service: "pool", Key: "selection", To: "fastest"},
+		{Service: "pool", Key: "shards", From: "1"},
+		{Service: "pool", Key: "upstream", From: redacted, To: redacted},
+		{Service: "server", Key: "tokens", From: redacted, To: redacted},
+	}, before.diff(after, map[string]Schema{
+		"pool": {{Name: "upstream", Type: TypeList, Secret: true}},
+	}))
+}
+
+type reloadable struct {
+	applied []string
+}
+
+func (r *reloadable) Reconfigure(c Config) error {
+	if c["fail"] != "" {
+		return fmt.Errorf("invalid: %s", c["fail"])
+	}
+	r.applied = append(r.applied, c["value"])
+	return nil
+}
+
+func TestReconfigure(t *testing.T) {
+	a, b := &reloadable{}, &reloadable{}
+	fabric := &Fabric{
+		singletons: Singletons{
+			"a":      a,
+			"b":      b,
+			"static": struct{}{},
+		},
+		initOrder: []string{"a", "b", "static"},
+		configuration: configuration{
+			"a": Config{"value": "1"},
+			"b": Config{"value": "1"},
+		},
+	}
+
+	// b rejects its config and a is rolled back
+	_, err := fabric.reconfigure(configuration{
+		"a": Config{"value": "2"},
+		"b": Config{"fail": "yes"},
+	})
+	assert.EqualError(t, err, "b: invalid: yes")
+	assert.Equal(t, []string{"2", "1"}, a.applied)
+	assert.Empty(t, b.applied)
+	assert.Equal(t, "1", fabric.configuration["a"]["value"])
+
+	changes, err := fabric.reconfigure(configuration{
+		"a":      Config{"value": "3"},
+		"b":      Config{"value": "1"},
+		"static": Config{"x": "y"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, []string{"2", "1", "3"}, a.applied)
+	assert.Empty(t, b.applied)
+	assert.Equal(t, "3", fabric.configuration["a"]["value"])
+	// services without Reconfigure keep the config, they were started with
+	assert.Nil(t, fabric.configuration["static"])
+}
+
+func TestReloadViaApi(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "slrp.yml"), []byte("a:\n  value: \"2\"\n"), 0o600)
+	require.NoError(t, err)
+	defer envm{"APP": "slrp", "PWD": dir}.restore()()
+
+	a := &reloadable{}
+	api := newConfigApi(&Fabric{
+		singletons:    Singletons{"a": a},
+		initOrder:     []string{"a"},
+		configuration: configuration{"a": Config{"value": "1"}},
+	})
+	_, err = api.HttpPostByID("unknown", nil)
+	assert.EqualError(t, err, "unknown command: unknown")
+
+	changes, err := api.HttpPostByID("reload", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []configChange{
+		{Service: "a", Key: "value", From: "1", To: "2"},
+	}, changes)
+	assert.Equal(t, []string{"2"}, a.applied)
+}
@@ -1,8 +1,10 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -44,6 +46,43 @@ type httpResource struct {
 	deleteByID httpDeleteByID
 }
 
+// Raw response is written to the client as is, without JSON serialization
+type Raw struct {
+	ContentType string
+	// Filename is optional and makes browsers download the response
+	Filename string
+	Body     []byte
+}
+
+func (raw Raw) write(rw http.ResponseWriter) {
+	raw.header(rw)
+	rw.Write(raw.Body)
+}
+
+func (raw Raw) header(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", raw.ContentType)
+	if raw.Filename != "" {
+		rw.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%q", raw.Filename))
+	}
+	rw.WriteHeader(200)
+}
+
+// Stream response is written to the client by the function, so that large
+// responses are not kept in memory. Errors after the first write can only
+// be logged, so that the function should fail early.
+type Stream struct {
+	ContentType string
+	// Filename is optional and makes browsers download the response
+	Filename string
+	Write    func(w io.Writer) error
+}
+
+func (s Stream) write(rw http.ResponseWriter) error {
+	Raw{ContentType: s.ContentType, Filename: s.Filename}.header(rw)
+	return s.Write(rw)
+}
+
 type InternalError struct{ error }
 
 func (i InternalError) Unwrap() error {
@@ -112,6 +151,17 @@ func (hr *httpResource) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		rw.WriteHeader(200)
 		return
 	}
+	if raw, ok := response.(Raw); ok {
+		raw.write(rw)
+		return
+	}
+	if stream, ok := response.(Stream); ok {
+		err = stream.write(rw)
+		if err != nil {
+			log.Warn().Err(err).Str("service", hr.service).Msg("cannot stream response")
+		}
+		return
+	}
 	if r.FormValue("format") == "text" {
 		rw.WriteHeader(200)
 		rw.Write([]byte(fmt.Sprintf("%s", response)))
@@ -132,6 +182,9 @@ type mainServer struct {
 	fabric   *Fabric
 	router   *mux.Router
 	onInit   []func(router *mux.Router)
+
+	healthTimeout time.Duration
+	auth          *apiAuth
 }
 
 func newServer(fabric *Fabric) *mainServer {
@@ -151,10 +204,30 @@ func (s *mainServer) Configure(c Config) (err error) {
 	s.ReadTimeout = timeout
 	s.IdleTimeout = timeout
 	s.WriteTimeout = timeout
+	s.healthTimeout = c.DurOr("health_timeout", 5*time.Second)
+	s.auth, err = newApiAuth(c)
+	if err != nil {
+		return err
+	}
 	s.listener, err = net.Listen("tcp", s.Addr)
 	return err
 }
 
+func (s *mainServer) ConfigSchema() Schema {
+	return Schema{
+		{Name: "addr", Type: TypeString, Default: "localhost:8089",
+			Doc: "address of listening HTTP server"},
+		{Name: "read_timeout", Type: TypeDuration, Default: "15s",
+			Doc: "read, write and idle timeout of API requests"},
+		{Name: "health_timeout", Type: TypeDuration, Default: "5s",
+			Doc: "time for every check of /healthz and /readyz to reply"},
+		{Name: "tokens", Type: TypeList, Secret: true,
+			Doc: "API tokens with their roles, like read:abc,admin:xyz"},
+		{Name: "allow", Type: TypeList,
+			Doc: "IP addresses and networks, that are allowed to connect"},
+	}
+}
+
 func (s *mainServer) url() string {
 	return fmt.Sprintf("http://%s", s.listener.Addr())
 }
@@ -166,15 +239,34 @@ func (s *mainServer) ListenAndServe() error {
 	return s.Serve(s.listener)
 }
 
-func (s *mainServer) Start(ctx Context) {
+func (s *mainServer) Start(ctx Context) error {
 	// it's easier to lazily init serve mux,
 	// rather than tinker with DI container
 	s.initRestAPI()
+	return nil
 }
 
 func (s *mainServer) initRestAPI() {
+	if s.auth != nil {
+		s.router.Use(s.auth.middleware)
+	}
 	hasApi := map[string]bool{}
+	collectors := map[string]metricsCollector{}
+	health := healthHandler{s.healthTimeout, map[string]func(context.Context) error{}}
+	ready := healthHandler{s.healthTimeout, map[string]func(context.Context) error{}}
 	for service, v := range s.fabric.singletons {
+		collector, ok := v.(metricsCollector)
+		if ok {
+			collectors[service] = collector
+		}
+		p, ok := v.(pinger)
+		if ok {
+			health.checks[service] = p.Ping
+		}
+		r, ok := v.(readiness)
+		if ok {
+			ready.checks[service] = readyCheck(r)
+		}
 		get, ok := v.(httpGet)
 		if ok {
 			hasApi[service] = true
@@ -216,6 +308,9 @@ func (s *mainServer) initRestAPI() {
 			}).Methods("DELETE")
 		}
 	}
+	s.router.Handle("/metrics", metricsHandler{collectors}).Methods("GET")
+	s.router.Handle("/healthz", health).Methods("GET")
+	s.router.Handle("/readyz", ready).Methods("GET")
 	s.router.HandleFunc("/api", func(rw http.ResponseWriter, r *http.Request) {
 		snapshot := s.fabric.snapshot()
 		for k, v := range snapshot {
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// KeyType tells how the value of configuration key is parsed
+type KeyType string
+
+const (
+	TypeString   KeyType = "string"
+	TypeInt      KeyType = "int"
+	TypeBool     KeyType = "bool"
+	TypeDuration KeyType = "duration"
+	TypeList     KeyType = "list"
+)
+
+// Key declares configuration property, that service understands
+type Key struct {
+	Name    string
+	Type    KeyType
+	Default string `json:",omitempty"`
+	Doc     string
+	// Values are the only allowed values, compared ignoring the case
+	Values []string `json:",omitempty"`
+	// Secret values are not logged or returned from the API
+	Secret bool `json:",omitempty"`
+}
+
+// Schema lists all configuration keys of a service
+type Schema []Key
+
+// described is implemented by services, that declare their configuration keys.
+// Configuration of these services is validated before they are configured.
+type described interface {
+	ConfigSchema() Schema
+}
+
+// sections, that configure the application itself
+var fabricSchema = map[string]Schema{
+	"app": {
+		{Name: "state", Type: TypeString, Default: "$HOME/.$APP/data",
+			Doc: "where data persists on disk through restarts"},
+		{Name: "sync", Type: TypeDuration, Default: "1m",
+			Doc: "how often data is synchronised to disk"},
+		{Name: "shutdown_timeout", Type: TypeDuration, Default: "30s",
+			Doc: "time to wait for in-flight requests and the final flush on shutdown"},
+	},
+	"log": {
+		{Name: "level", Type: TypeString, Default: "info",
+			Doc:    "log level of application",
+			Values: []string{"trace", "debug", "info", "warn", "error"}},
+		{Name: "format", Type: TypeString, Default: "pretty",
+			Doc:    "format of log lines printed",
+			Values: []string{"pretty", "json", "file"}},
+		{Name: "file", Type: TypeString, Default: "$PWD/$APP.log",
+			Doc: "application logs in JSON format, when format is file"},
+	},
+	"pprof": {
+		{Name: "enable", Type: TypeBool, Default: "false",
+			Doc: "expose profiler endpoints. Developer use only"},
+		{Name: "addr", Type: TypeString, Default: "localhost:6060",
+			Doc: "address of listening profiler server"},
+	},
+}
+
+func (s Schema) key(name string) (Key, bool) {
+	for _, k := range s {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// validate fails on unknown keys and on values, that cannot be parsed
+func (s Schema) validate(c Config) error {
+	keys := []string{}
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		k, ok := s.key(name)
+		if !ok {
+			return fmt.Errorf("unknown key: %s", name)
+		}
+		err := k.validate(c[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (k Key) validate(v string) error {
+	switch k.Type {
+	case TypeInt:
+		_, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid int: %s", v)
+		}
+	case TypeBool:
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no":
+		default:
+			return fmt.Errorf("invalid bool: %s", v)
+		}
+	case TypeDuration:
+		d, err := ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration: %s", v)
+		}
+	}
+	if len(k.Values) == 0 {
+		return nil
+	}
+	// services compare values as they are, so that case must match
+	for _, allowed := range k.Values {
+		if allowed == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected one of %s, got %s", strings.Join(k.Values, ", "), v)
+}
+
+// effective returns configured values along with defaults of the other keys
+func (s Schema) effective(c Config) Config {
+	res := Config{}
+	for _, k := range s {
+		if k.Default != "" {
+			res[k.Name] = k.Default
+		}
+	}
+	for k, v := range c {
+		res[k] = v
+	}
+	return res
+}
+
+// secret tells if value of the key must not be shown
+func (s Schema) secret(name string) bool {
+	k, ok := s.key(name)
+	if ok {
+		return k.Secret
+	}
+	return secretKey.MatchString(name)
+}
+
+// masked replaces non-empty secret values
+func (s Schema) masked(c Config) Config {
+	res := Config{}
+	for k, v := range c {
+		if v != "" && s.secret(k) {
+			v = redacted
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// schemas returns configuration keys of the application and of every
+// service, that declares them
+func (f *Fabric) schemas() map[string]Schema {
+	res := map[string]Schema{}
+	for section, schema := range fabricSchema {
+		res[section] = schema
+	}
+	for service, v := range f.singletons {
+		d, ok := v.(described)
+		if !ok {
+			continue
+		}
+		res[service] = d.ConfigSchema()
+	}
+	return res
+}
+
+// validate checks every section, which has a schema. Sections without
+// a service are most likely coming from unrelated environment variables.
+func (c configuration) validate(schemas map[string]Schema, singletons Singletons) error {
+	sections := []string{}
+	for section := range c {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		schema, ok := schemas[section]
+		if ok {
+			err := schema.validate(c[section])
+			if err != nil {
+				return fmt.Errorf("%s: %w", section, err)
+			}
+			continue
+		}
+		_, ok = singletons[section]
+		if !ok {
+			log.Warn().Str("section", section).Msg("unknown config section")
+		}
+	}
+	return nil
+}
+
+// effective returns configuration with defaults and with masked secrets
+func (f *Fabric) effective() configuration {
+	f.configMu.Lock()
+	defer f.configMu.Unlock()
+	res := configuration{}
+	schemas := f.schemas()
+	for section, schema := range schemas {
+		res[section] = schema.masked(schema.effective(f.configuration[section]))
+	}
+	for section, c := range f.configuration {
+		_, ok := schemas[section]
+		if ok {
+			continue
+		}
+		res[section] = Schema{}.masked(c)
+	}
+	return res
+}
+
+// PrintDefaults writes configuration file with default values and
+// documentation of every key of the application and its services
+func PrintDefaults(w io.Writer, factories Factories) error {
+	f := &Fabric{Factories: factories}
+	err := f.initSingletons()
+	if err != nil {
+		return err
+	}
+	schemas := f.schemas()
+	sections := []string{}
+	for section := range schemas {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", section)
+		for _, k := range schemas[section] {
+			doc := k.Doc
+			if len(k.Values) > 0 {
+				doc = fmt.Sprintf("%s. One of: %s", doc, strings.Join(k.Values, ", "))
+			}
+			fmt.Fprintf(w, "  # %s (%s)\n", doc, k.Type)
+			fmt.Fprintf(w, "  %s: %s\n", k.Name, strconv.Quote(k.Default))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = Schema{
+	{Name: "count", Type: TypeInt, Default: "5", Doc: "number of things"},
+	{Name: "enabled", Type: TypeBool, Default: "true", Doc: "run it"},
+	{Name: "timeout", Type: TypeDuration, Default: "1m", Doc: "time to wait"},
+	{Name: "mode", Type: TypeString, Default: "fast", Doc: "how to run",
+		Values: []string{"fast", "slow"}},
+	{Name: "users", Type: TypeList, Secret: true, Doc: "who is allowed"},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		err    string
+	}{
+		{Config{"count": "10", "enabled": "yes", "timeout": "1h30m", "mode": "slow"}, ""},
+		{Config{"users": "a:b,c:d"}, ""},
+		{Config{"unknown": "1"}, "unknown key: unknown"},
+		{Config{"count": "many"}, "count: invalid int: many"},
+		{Config{"enabled": "maybe"}, "enabled: invalid bool: maybe"},
+		{Config{"timeout": "soon"}, "timeout: invalid duration: soon"},
+		{Config{"mode": "medium"}, "mode: expected one of fast, slow, got medium"},
+		{Config{"mode": "Fast"}, "mode: expected one of fast, slow, got Fast"},
+	}
+	for _, tt := range tests {
+		err := testSchema.validate(tt.config)
+		if tt.err == "" {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestSchemaEffective(t *testing.T) {
+	c := testSchema.masked(testSchema.effective(Config{
+		"count": "10",
+		"users": "a:b",
+	}))
+	assert.Equal(t, Config{
+		"count":   "10",
+		"enabled": "true",
+		"timeout": "1m",
+		"mode":    "fast",
+		"users":   redacted,
+	}, c)
+}
+
+type describedService struct{}
+
+func (describedService) Configure(Config) error {
+	return nil
+}
+
+func (describedService) ConfigSchema() Schema {
+	return testSchema
+}
+
+func TestConfigurationValidate(t *testing.T) {
+	fabric := &Fabric{
+		singletons: Singletons{
+			"described": describedService{},
+			"other":     struct{}{},
+		},
+	}
+	schemas := fabric.schemas()
+	err := configuration{
+		"described": Config{"count": "1"},
+		"other":     Config{"anything": "goes"},
+		"unrelated": Config{"env": "var"},
+	}.validate(schemas, fabric.singletons)
+	assert.NoError(t, err)
+
+	err = configuration{
+		"described": Config{"count": "x"},
+	}.validate(schemas, fabric.singletons)
+	assert.EqualError(t, err, "described: count: invalid int: x")
+
+	err = configuration{
+		"log": Config{"level": "verbose"},
+	}.validate(schemas, fabric.singletons)
+	assert.EqualError(t, err, "log: level: expected one of trace, debug, info, warn, error, got verbose")
+}
+
+func TestStartFailsOnInvalidConfig(t *testing.T) {
+	defer envm{
+		"APP":                "slrp",
+		"PWD":                t.TempDir(),
+		"HOME":               t.TempDir(),
+		"SLRP_DESCRIBED_FOO": "bar",
+	}.restore()()
+	fabric := &Fabric{
+		Factories: Factories{
+			"described": func() describedService {
+				return describedService{}
+			},
+		},
+	}
+	err := fabric.Start(context.Background())
+	assert.EqualError(t, err, "config: described: unknown key: foo")
+}
+
+func TestReconfigureValidates(t *testing.T) {
+	fabric := &Fabric{
+		singletons:    Singletons{"described": describedService{}},
+		initOrder:     []string{"described"},
+		configuration: configuration{},
+	}
+	_, err := fabric.reconfigure(configuration{
+		"described": Config{"mode": "medium"},
+	})
+	assert.EqualError(t, err, "described: mode: expected one of fast, slow, got medium")
+}
+
+func TestPrintDefaults(t *testing.T) {
+	var buf bytes.Buffer
+	err := PrintDefaults(&buf, Factories{
+		"described": func() describedService {
+			return describedService{}
+		},
+	})
+	require.NoError(t, err)
+	out := buf.String()
+	assert.Contains(t, out, `described:
+  # number of things (int)
+  count: "5"
+  # run it (bool)
+  enabled: "true"
+  # time to wait (duration)
+  timeout: "1m"
+  # how to run. One of: fast, slow (string)
+  mode: "fast"
+  # who is allowed (list)
+  users: ""
+`)
+	assert.Contains(t, out, `server:
+  # address of listening HTTP server (string)
+  addr: "localhost:8089"
+`)
+	assert.Contains(t, out, `app:
+  # where data persists on disk through restarts (string)
+  state: "$HOME/.$APP/data"
+`)
+}
@@ -26,7 +26,10 @@ func (s Singletons) MockStart() MockRuntime {
 		}
 		ctx := MockCtx()
 		ctx.name = k
-		service.Start(ctx)
+		err := service.Start(ctx)
+		if err != nil {
+			panic(err)
+		}
 		r[k] = ctx
 	}
 	return r
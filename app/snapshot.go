@@ -0,0 +1,162 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Migrator is implemented by services, that changed the format of their state.
+// Snapshots written before the service had a version are of version 0.
+type Migrator interface {
+	// StateVersion is written into the header of the snapshot
+	StateVersion() uint32
+	// MigrateState converts the state of older version into the current one
+	MigrateState(from uint32, data []byte) ([]byte, error)
+}
+
+const snapshotMagic = "SLRP"
+
+// snapshotFormat is the version of the header itself
+const snapshotFormat uint16 = 1
+
+// snapshotHeader precedes the state of a service, so that truncated or
+// corrupted files are detected before they get to the service
+type snapshotHeader struct {
+	Magic    [4]byte
+	Format   uint16
+	Version  uint32
+	Length   uint64
+	Checksum [sha256.Size]byte
+}
+
+func stateVersion(service any) uint32 {
+	m, ok := service.(Migrator)
+	if !ok {
+		return 0
+	}
+	return m.StateVersion()
+}
+
+// writeSnapshot writes state to a temporary file and renames it over the previous
+// snapshot only after it is synced to disk, keeping the previous one as .bak
+func writeSnapshot(file string, version uint32, data []byte) error {
+	dir := filepath.Dir(file)
+	tmp, err := os.CreateTemp(dir, filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	header := snapshotHeader{
+		Format:   snapshotFormat,
+		Version:  version,
+		Length:   uint64(len(data)),
+		Checksum: sha256.Sum256(data),
+	}
+	copy(header.Magic[:], snapshotMagic)
+	err = binary.Write(tmp, binary.BigEndian, header)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		// state may include credentials of upstream proxies
+		err = tmp.Chmod(0o600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if _, err := os.Stat(file); err == nil {
+		err = os.Rename(file, file+".bak")
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+	err = os.Rename(tmp.Name(), file)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// readSnapshot validates the header and returns version and state. Files
+// without a header are gob-encoded states of version 0.
+func readSnapshot(file string) (uint32, []byte, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !bytes.HasPrefix(raw, []byte(snapshotMagic)) {
+		var legacy rawState
+		err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&legacy)
+		if err != nil {
+			return 0, nil, fmt.Errorf("legacy: %w", err)
+		}
+		return 0, legacy, nil
+	}
+	r := bytes.NewReader(raw)
+	var header snapshotHeader
+	err = binary.Read(r, binary.BigEndian, &header)
+	if err != nil {
+		return 0, nil, fmt.Errorf("header: %w", err)
+	}
+	if header.Format != snapshotFormat {
+		return 0, nil, fmt.Errorf("unsupported snapshot format: %d", header.Format)
+	}
+	if header.Length != uint64(r.Len()) {
+		return 0, nil, fmt.Errorf("truncated: expected %d bytes, got %d", header.Length, r.Len())
+	}
+	data, _ := io.ReadAll(r)
+	if sha256.Sum256(data) != header.Checksum {
+		return 0, nil, fmt.Errorf("checksum mismatch")
+	}
+	return header.Version, data, nil
+}
+
+// rawState captures bytes of BinaryMarshaler, that were encoded with gob
+type rawState []byte
+
+func (rs *rawState) UnmarshalBinary(data []byte) error {
+	*rs = append([]byte{}, data...)
+	return nil
+}
+
+// loadSnapshot migrates state of older versions and restores it in the service
+func loadSnapshot(file string, service encoding.BinaryUnmarshaler) error {
+	version, data, err := readSnapshot(file)
+	if err != nil {
+		return err
+	}
+	current := stateVersion(service)
+	if version > current {
+		return fmt.Errorf("state version %d is newer than supported %d", version, current)
+	}
+	if version < current {
+		data, err = service.(Migrator).MigrateState(version, data)
+		if err != nil {
+			return fmt.Errorf("migrate from %d: %w", version, err)
+		}
+	}
+	return service.UnmarshalBinary(data)
+}
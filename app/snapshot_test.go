@@ -0,0 +1,142 @@
+package app
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionedState struct {
+	version uint32
+	data    []byte
+}
+
+func (vs *versionedState) StateVersion() uint32 {
+	return vs.version
+}
+
+func (vs *versionedState) MigrateState(from uint32, data []byte) ([]byte, error) {
+	if from == 0 && bytes.Equal(data, []byte("broken")) {
+		return nil, fmt.Errorf("cannot migrate")
+	}
+	return append([]byte(fmt.Sprintf("v%d:", from)), data...), nil
+}
+
+func (vs *versionedState) MarshalBinary() ([]byte, error) {
+	return vs.data, nil
+}
+
+func (vs *versionedState) UnmarshalBinary(data []byte) error {
+	vs.data = data
+	return nil
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "x")
+	err := writeSnapshot(file, 3, []byte("first"))
+	require.NoError(t, err)
+	err = writeSnapshot(file, 3, []byte("second"))
+	require.NoError(t, err)
+
+	version, data, err := readSnapshot(file)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), version)
+	assert.Equal(t, []byte("second"), data)
+
+	_, data, err = readSnapshot(file + ".bak")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), data)
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	leftovers, _ := filepath.Glob(file + ".tmp*")
+	assert.Empty(t, leftovers)
+}
+
+func TestReadSnapshotCorrupted(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "x")
+	err := writeSnapshot(file, 1, []byte("payload"))
+	require.NoError(t, err)
+	raw, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	os.WriteFile(file, raw[:len(raw)-1], 0o600)
+	_, _, err = readSnapshot(file)
+	assert.EqualError(t, err, "truncated: expected 7 bytes, got 6")
+
+	raw[len(raw)-1] = 'X'
+	os.WriteFile(file, raw, 0o600)
+	_, _, err = readSnapshot(file)
+	assert.EqualError(t, err, "checksum mismatch")
+
+	os.WriteFile(file, []byte("SLRP"), 0o600)
+	_, _, err = readSnapshot(file)
+	assert.EqualError(t, err, "header: unexpected EOF")
+
+	os.WriteFile(file, []byte("garbage"), 0o600)
+	_, _, err = readSnapshot(file)
+	assert.ErrorContains(t, err, "legacy: ")
+}
+
+func TestLoadSnapshotMigrates(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy")
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(&versionedState{data: []byte("old")})
+	require.NoError(t, err)
+	os.WriteFile(legacy, b.Bytes(), 0o600)
+
+	current := &versionedState{version: 2}
+	err = loadSnapshot(legacy, current)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v0:old"), current.data)
+
+	newer := filepath.Join(dir, "newer")
+	writeSnapshot(newer, 3, []byte("new"))
+	err = loadSnapshot(newer, current)
+	assert.EqualError(t, err, "state version 3 is newer than supported 2")
+
+	broken := filepath.Join(dir, "broken")
+	writeSnapshot(broken, 0, []byte("broken"))
+	err = loadSnapshot(broken, current)
+	assert.EqualError(t, err, "migrate from 0: cannot migrate")
+}
+
+func TestLoadFallsBackToBackup(t *testing.T) {
+	state := &versionedState{version: 1, data: []byte("good")}
+	fabric := &Fabric{
+		State:    t.TempDir(),
+		services: map[string]Service{"x": serviceWithState{state}},
+	}
+	fabric.flush("x")
+	state.data = []byte("newer")
+	fabric.flush("x")
+
+	db := filepath.Join(fabric.State, "x")
+	raw, _ := os.ReadFile(db)
+	os.WriteFile(db, raw[:len(raw)-2], 0o600)
+
+	err := fabric.load("x")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("good"), state.data)
+
+	os.Remove(db + ".bak")
+	err = fabric.load("x")
+	assert.EqualError(t, err, "truncated: expected 5 bytes, got 3")
+}
+
+type serviceWithState struct {
+	*versionedState
+}
+
+func (serviceWithState) Start(Context) error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// State is the directory with snapshots of services along with configuration
+// of the application. It is used by commands, that work without starting the
+// application, which would otherwise overwrite the changed snapshots.
+type State struct {
+	Dir           string
+	configuration configuration
+}
+
+// OpenState resolves the state directory from configuration
+func OpenState() (*State, error) {
+	conf, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		Dir:           conf["app"].StrOr("state", "$HOME/.$APP/data"),
+		configuration: conf,
+	}, nil
+}
+
+// Services returns names of services, that have a snapshot
+func (s *State) Services() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	services := []string{}
+	for _, v := range entries {
+		if v.IsDir() || strings.Contains(v.Name(), ".") {
+			// backups and temporary files
+			continue
+		}
+		services = append(services, v.Name())
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// Version returns the version and the size of the latest snapshot
+func (s *State) Version(service string) (uint32, int, error) {
+	version, data, err := readSnapshot(filepath.Join(s.Dir, service))
+	return version, len(data), err
+}
+
+// Load restores the service from the latest valid snapshot or from its backup
+func (s *State) Load(service string, into encoding.BinaryUnmarshaler) error {
+	return loadWithBackup(filepath.Join(s.Dir, service), into)
+}
+
+// NotRunning fails, if the application accepts connections on the address
+// of its REST API, as it would overwrite the changed snapshots on the next sync
+func (s *State) NotRunning() error {
+	addr := s.configuration["server"].StrOr("addr", "localhost:8089")
+	conn, err := net.DialTimeout("tcp", addr, 1*time.Second)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+	return fmt.Errorf("slrp is running on %s, stop it before changing the state", addr)
+}
+
+// Save writes the snapshot of the service, keeping the previous one as backup.
+// It refuses to write, while the application is running.
+func (s *State) Save(service string, from encoding.BinaryMarshaler) error {
+	err := s.NotRunning()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	data, err := from.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(filepath.Join(s.Dir, service), stateVersion(from), data)
+}
+
+// Init creates and configures services without starting them
+func (s *State) Init(f Factories) (Singletons, error) {
+	singletons, initOrder, err := f.Init()
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range initOrder {
+		conf := s.configuration[service]
+		d, ok := singletons[service].(described)
+		if ok {
+			err = d.ConfigSchema().validate(conf)
+			if err != nil {
+				return nil, fmt.Errorf("config: %s: %w", service, err)
+			}
+		}
+		c, ok := singletons[service].(configurable)
+		if !ok {
+			continue
+		}
+		err = c.Configure(conf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", service, err)
+		}
+	}
+	return singletons, nil
+}
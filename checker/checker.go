@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nfx/slrp/app"
@@ -70,6 +71,7 @@ func NewChecker(dialer dialer) Checker {
 type configurableChecker struct {
 	ip       string
 	client   httpClient
+	mu       sync.RWMutex
 	strategy Checker
 }
 
@@ -82,18 +84,10 @@ func (cc *configurableChecker) Configure(conf app.Config) error {
 		return fmt.Errorf("cannot get this IP: %w", err)
 	}
 	cc.ip = ip
-	strategies := map[string]Checker{
-		"twopass": newTwoPass(ip, cc.client),
-		"simple":  newFederated(firstPass, cc.client, ip),
-		"headers": newFederated([]string{
-			"https://ifconfig.me/all",
-			"https://ifconfig.io/all.json",
-		}, cc.client, ip),
-	}
 	strategyName := conf.StrOr("strategy", "simple")
-	strategy, ok := strategies[strategyName]
-	if !ok {
-		return fmt.Errorf("invalid strategy: %s", strategyName)
+	strategy, err := cc.newStrategy(strategyName, cc.client)
+	if err != nil {
+		return err
 	}
 	cc.strategy = strategy
 	timeout := conf.DurOr("timeout", 5*time.Second)
@@ -109,6 +103,64 @@ func (cc *configurableChecker) Configure(conf app.Config) error {
 	return nil
 }
 
+func (cc *configurableChecker) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "strategy", Type: app.TypeString, Default: "simple",
+			Doc:    "verification strategy to check the IP of the proxy",
+			Values: []string{"simple", "headers", "twopass"}},
+		{Name: "timeout", Type: app.TypeDuration, Default: "5s",
+			Doc: "time to wait while performing verification"},
+	}
+}
+
+// Reconfigure changes strategy and timeout for checks, that start afterwards
+func (cc *configurableChecker) Reconfigure(conf app.Config) error {
+	timeout := conf.DurOr("timeout", 5*time.Second)
+	client := cc.client
+	original, ok := cc.client.(*http.Client)
+	if ok {
+		// in-flight checks keep the previous timeout
+		copied := *original
+		copied.Timeout = timeout
+		client = &copied
+	}
+	strategyName := conf.StrOr("strategy", "simple")
+	strategy, err := cc.newStrategy(strategyName, client)
+	if err != nil {
+		return err
+	}
+	cc.mu.Lock()
+	cc.strategy = strategy
+	cc.mu.Unlock()
+	log.Info().
+		Str("strategy", strategyName).
+		Dur("timeout", timeout).
+		Msg("reconfigured proxy checker")
+	return nil
+}
+
+func (cc *configurableChecker) newStrategy(name string, client httpClient) (Checker, error) {
+	switch name {
+	case "twopass":
+		return newTwoPass(cc.ip, client), nil
+	case "simple":
+		return newFederated(firstPass, client, cc.ip), nil
+	case "headers":
+		return newFederated([]string{
+			"https://ifconfig.me/all",
+			"https://ifconfig.io/all.json",
+		}, client, cc.ip), nil
+	default:
+		return nil, fmt.Errorf("invalid strategy: %s", name)
+	}
+}
+
+func (cc *configurableChecker) current() Checker {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return cc.strategy
+}
+
 func (cc *configurableChecker) thisIP() (string, error) {
 	req, err := http.NewRequest("GET", "https://ifconfig.me/ip", nil)
 	if err != nil {
@@ -124,11 +176,19 @@ func (cc *configurableChecker) thisIP() (string, error) {
 	return s.Text(), nil
 }
 
+func (cc *configurableChecker) Ready() error {
+	if cc.current() == nil {
+		return fmt.Errorf("checker is not configured")
+	}
+	return nil
+}
+
 func (cc *configurableChecker) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
-	if cc.strategy == nil {
+	strategy := cc.current()
+	if strategy == nil {
 		return 0, fmt.Errorf("no strategy")
 	}
-	return cc.strategy.Check(ctx, proxy)
+	return strategy.Check(ctx, proxy)
 }
 
 func newTwoPass(ip string, client httpClient) twoPass {
@@ -23,6 +23,7 @@ func TestFailure(t *testing.T) {
 	ctx := context.Background()
 	_, err := c.Check(ctx, pmux.HttpProxy("127.0.0.1:1"))
 	assert.EqualError(t, err, "no strategy")
+	assert.EqualError(t, c.(*configurableChecker).Ready(), "checker is not configured")
 }
 
 func TestConfigurableChecker(t *testing.T) {
@@ -35,6 +36,25 @@ func TestConfigurableChecker(t *testing.T) {
 	assert.Equal(t, time.Second*5, client.Timeout)
 }
 
+func TestReconfigure(t *testing.T) {
+	original := &http.Client{Timeout: 5 * time.Second}
+	c := &configurableChecker{
+		ip:     "127.0.0.1",
+		client: original,
+	}
+	err := c.Reconfigure(app.Config{"strategy": "unknown"})
+	assert.EqualError(t, err, "invalid strategy: unknown")
+	assert.EqualError(t, c.Ready(), "checker is not configured")
+
+	err = c.Reconfigure(app.Config{"strategy": "twopass", "timeout": "1s"})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Ready())
+	strategy, ok := c.current().(twoPass)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, strategy.first[0].client.(*http.Client).Timeout)
+	assert.Equal(t, 5*time.Second, original.Timeout)
+}
+
 type checkerShim struct {
 	http.Response
 	err error
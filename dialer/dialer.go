@@ -31,6 +31,16 @@ func NewDialer() *wireGuardDialer {
 	return &wireGuardDialer{}
 }
 
+// ConfigSchema declares configuration keys of the WireGuard dialer.
+func (d *wireGuardDialer) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "wireguard_config_file", Type: app.TypeString,
+			Doc: "configuration file from WireGuard"},
+		{Name: "wireguard_verbose", Type: app.TypeBool, Default: "false",
+			Doc: "verbose logging mode for WireGuard tunnel"},
+	}
+}
+
 // Configure initializes the WireGuard dialer with the provided configuration.
 func (d *wireGuardDialer) Configure(c app.Config) error {
 	configFile := c.StrOr("wireguard_config_file", "")
@@ -93,8 +103,7 @@ func (d *wireGuardDialer) addrsFromConfig(section, key string) (addrs []netip.Ad
 	value := d.conf[section][key]
 	for _, v := range strings.Split(value, ",") {
 		v = strings.TrimSpace(v)
-		if strings.Contains(v, ":") {
-			// Skip IPv6 addresses for now (not supported).
+		if v == "" {
 			continue
 		}
 		if strings.Contains(v, "/") {
@@ -157,8 +166,9 @@ func (d *wireGuardDialer) getIpsSetShim() (*bytes.Buffer, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Add the allowed IP and endpoint information to the buffer.
-	_, err = b.WriteString("allowed_ip=0.0.0.0/0\n")
+	// Add the allowed IP and endpoint information to the buffer. Both IPv4 and
+	// IPv6 traffic is routed through the tunnel.
+	_, err = b.WriteString("allowed_ip=0.0.0.0/0\nallowed_ip=::/0\n")
 	//_, err = b.WriteString(fmt.Sprintf("allowed_ip=%s\n", d.conf["Peer"]["AllowedIPs"]))
 	if err != nil {
 		return nil, err
@@ -1,6 +1,7 @@
 package history
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -29,6 +30,7 @@ type filteredRequest struct {
 	URL        string
 	StatusCode int
 	Status     string
+	Blocked    string
 	Proxy      string
 	Appeared   int
 	Size       int
@@ -45,6 +47,7 @@ type Request struct {
 	URL        string     `facet:"Host"`
 	StatusCode int        `facet:"Status Code"`
 	Status     string     `facet:"Status"`
+	Blocked    string     // name of the matched block rule
 	Proxy      pmux.Proxy `facet:"Proxy"`
 	Appeared   int
 	InHeaders  map[string]string
@@ -107,17 +110,29 @@ type History struct {
 	requestRequest chan requestRequest
 	filter         chan filter
 	record         chan Request
+	limits         chan int
 	requests       RequestDataset
 	appears        map[pmux.Proxy]int
 	limit          int
+	latency        map[string]*app.Histogram
+	loops          app.Group
 }
 
+// outcomes of forwarding attempts, that have separate latency histograms
+var outcomes = []string{"ok", "failed", "blocked"}
+
 func NewHistory() *History {
+	latency := map[string]*app.Histogram{}
+	for _, v := range outcomes {
+		latency[v] = app.NewHistogram()
+	}
 	return &History{
+		latency:        latency,
 		requests:       RequestDataset{},
 		requestRequest: make(chan requestRequest),
 		filter:         make(chan filter),
 		record:         make(chan Request, 128),
+		limits:         make(chan int),
 		appears:        map[pmux.Proxy]int{},
 	}
 }
@@ -127,18 +142,73 @@ func (h *History) Configure(c app.Config) error {
 	return nil
 }
 
-func (h *History) Start(ctx app.Context) {
-	go h.main(ctx)
+func (h *History) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "limit", Type: app.TypeInt, Default: "1000",
+			Doc: "number of requests to keep in memory"},
+	}
+}
+
+// Reconfigure changes the number of kept requests and drops the oldest ones
+func (h *History) Reconfigure(c app.Config) error {
+	h.limits <- c.IntOr("limit", 1000)
+	return nil
+}
+
+func (h *History) Start(ctx app.Context) error {
+	loops := h.loops.Start(ctx)
+	h.loops.Go(func() { h.main(loops) })
+	return nil
+}
+
+// Stop keeps requests, that were recorded before it, and stops the main loop
+func (h *History) Stop(ctx context.Context) error {
+	return h.loops.Stop(ctx)
 }
 
 func (h *History) Wrap(transport http.RoundTripper) http.RoundTripper {
 	return roundTripper{h, transport}
 }
 
+// Ping goes through the main loop
+func (h *History) Ping(ctx context.Context) error {
+	out := make(chan Request, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case h.requestRequest <- requestRequest{ID: 0, out: out}:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-out:
+		return nil
+	}
+}
+
 func (h *History) Record(r Request) {
 	h.record <- r
 }
 
+func (h *History) observe(r Request) {
+	outcome := "ok"
+	switch {
+	case r.Blocked != "":
+		outcome = "blocked"
+	case r.StatusCode >= 400:
+		outcome = "failed"
+	}
+	h.latency[outcome].Observe(r.Took.Seconds())
+}
+
+func (h *History) CollectMetrics(m *app.Metrics) {
+	for _, v := range outcomes {
+		m.Histogram("slrp_history_request_duration_seconds",
+			"Duration of forwarding attempts through proxies",
+			h.latency[v], "outcome", v)
+	}
+}
+
 func (h *History) HttpGet(r *http.Request) (interface{}, error) {
 	res := h.sendFilter(r)
 	return res, res.Err
@@ -181,18 +251,25 @@ func (h *History) main(ctx app.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			for {
+				select {
+				case r := <-h.record:
+					counter++
+					h.add(counter, r)
+				default:
+					return
+				}
+			}
 		case r := <-h.record:
-			// this may turn into partitioned data structure or index?..
 			counter++
-			r.ID = counter
-			h.appears[r.Proxy] += 1
-			r.Appeared = h.appears[r.Proxy]
-			if h.limit > 0 && len(h.requests) == h.limit {
-				h.requests = h.requests[1:]
-			}
-			h.requests = append(h.requests, r)
+			h.add(counter, r)
 			ctx.Heartbeat()
+		case limit := <-h.limits:
+			h.limit = limit
+			if limit > 0 && len(h.requests) > limit {
+				h.requests = h.requests[len(h.requests)-limit:]
+				ctx.Heartbeat()
+			}
 		case r := <-h.requestRequest:
 			var found bool
 			for i := 0; i < len(h.requests); i++ {
@@ -214,6 +291,17 @@ func (h *History) main(ctx app.Context) {
 	}
 }
 
+func (h *History) add(id int, r Request) {
+	// this may turn into partitioned data structure or index?..
+	r.ID = id
+	h.appears[r.Proxy] += 1
+	r.Appeared = h.appears[r.Proxy]
+	if h.limit > 0 && len(h.requests) == h.limit {
+		h.requests = h.requests[1:]
+	}
+	h.requests = append(h.requests, r)
+}
+
 func (h *History) handleFilter(f filter) filterResults {
 	res, err := h.requests.Query(f.Query)
 	if err != nil {
@@ -238,6 +326,7 @@ func (h *History) handleFilter(f filter) filterResults {
 			URL:        v.URL,
 			Status:     v.Status,
 			StatusCode: v.StatusCode,
+			Blocked:    v.Blocked,
 			Proxy:      v.Proxy.String(),
 			Appeared:   h.appears[v.Proxy],
 			Size:       len(v.OutBody),
@@ -64,3 +64,18 @@ func TestRecord(t *testing.T) {
 	fr := x.(filterResults)
 	assert.Equal(t, 1, len(fr.QueryResult.Records))
 }
+
+func TestReconfigureLimit(t *testing.T) {
+	history, runtime := app.MockStartSpin(NewHistory())
+	defer runtime.Stop()
+	for i := 0; i < 3; i++ {
+		history.Record(Request{
+			Proxy: pmux.HttpProxy("1.2.3.4:56789"),
+		})
+	}
+	err := history.Reconfigure(app.Config{"limit": "2"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, Request{}, history.get(1))
+	assert.Equal(t, 3, history.get(3).ID)
+}
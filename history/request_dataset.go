@@ -8,7 +8,11 @@ import (
 type RequestDataset []Request
 
 func (d RequestDataset) Query(query string) (*eval.QueryResult[Request], error) {
-	return (&eval.Dataset[Request, RequestDataset]{
+	return d.Dataset().Query(query)
+}
+
+func (d RequestDataset) Dataset() *eval.Dataset[Request, RequestDataset] {
+	return &eval.Dataset[Request, RequestDataset]{
 		Source: d,
 		Accessors: eval.Accessors{
 			"ID":         eval.NumberGetter{Name: "ID", Func: d.getID},
@@ -19,6 +23,7 @@ func (d RequestDataset) Query(query string) (*eval.QueryResult[Request], error)
 			"URL":        eval.StringGetter{Name: "URL", Func: d.getURL},
 			"StatusCode": eval.NumberGetter{Name: "StatusCode", Func: d.getStatusCode},
 			"Status":     eval.StringGetter{Name: "Status", Func: d.getStatus},
+			"Blocked":    eval.StringGetter{Name: "Blocked", Func: d.getBlocked},
 			"Proxy":      eval.StringGetter{Name: "Proxy", Func: d.getProxy},
 			"Appeared":   eval.NumberGetter{Name: "Appeared", Func: d.getAppeared},
 			"Took":       eval.NumberGetter{Name: "Took", Func: d.getTook},
@@ -33,6 +38,7 @@ func (d RequestDataset) Query(query string) (*eval.QueryResult[Request], error)
 			"URL":        {Asc: d.sortAscURL, Desc: d.sortDescURL},
 			"StatusCode": {Asc: d.sortAscStatusCode, Desc: d.sortDescStatusCode},
 			"Status":     {Asc: d.sortAscStatus, Desc: d.sortDescStatus},
+			"Blocked":    {Asc: d.sortAscBlocked, Desc: d.sortDescBlocked},
 			"Proxy":      {Asc: d.sortAscProxy, Desc: d.sortDescProxy},
 			"Appeared":   {Asc: d.sortAscAppeared, Desc: d.sortDescAppeared},
 			"Took":       {Asc: d.sortAscTook, Desc: d.sortDescTook},
@@ -78,7 +84,7 @@ func (d RequestDataset) Query(query string) (*eval.QueryResult[Request], error)
 				},
 			}.Facets(filtered, topN)
 		},
-	}).Query(query)
+	}
 }
 
 func (d RequestDataset) getSize(record int) float64 {
@@ -181,6 +187,18 @@ func (_ RequestDataset) sortDescStatus(left, right Request) bool {
 	return left.Status > right.Status
 }
 
+func (d RequestDataset) getBlocked(record int) string {
+	return d[record].Blocked
+}
+
+func (_ RequestDataset) sortAscBlocked(left, right Request) bool {
+	return left.Blocked < right.Blocked
+}
+
+func (_ RequestDataset) sortDescBlocked(left, right Request) bool {
+	return left.Blocked > right.Blocked
+}
+
 func (d RequestDataset) getProxy(record int) string {
 	return d[record].Proxy.String()
 }
@@ -11,6 +11,9 @@ import (
 	"github.com/nfx/slrp/pmux"
 )
 
+// routingHeaders are set by the pool and never reach the destination
+var routingHeaders = []string{"X-Proxy-Hints", "X-Proxy-Session", "X-Proxy-Selection"}
+
 type roundTripper struct {
 	history   *History
 	transport http.RoundTripper
@@ -31,6 +34,10 @@ func (rt roundTripper) outBody(out *http.Response, err error) ([]byte, *http.Res
 			Header:     http.Header{},
 		}
 	}
+	if out.Request != nil && out.Request.Method == http.MethodConnect {
+		// body of established tunnel is the raw connection
+		return nil, out
+	}
 	outBody := justRead(out.Body) // todo: check for leaked fds
 	out.Body = ioutil.NopCloser(bytes.NewBuffer(outBody))
 	return outBody, out
@@ -60,14 +67,29 @@ func (rt roundTripper) RoundTrip(in *http.Request) (*http.Response, error) {
 	// other roundtripper, so that they don't leak to destination.
 	serial := rt.popIntHeader(in.Header, "X-Proxy-Serial")
 	attempt := rt.popIntHeader(in.Header, "X-Proxy-Attempt")
+	// routing hints and session were already applied by the pool, so
+	// they're kept only in the record
+	routing := map[string]string{}
+	for _, k := range routingHeaders {
+		v := in.Header.Get(k)
+		if v == "" {
+			continue
+		}
+		routing[k] = v
+		in.Header.Del(k)
+	}
 	// get proxy used for making the request
 	proxy := pmux.GetProxyFromContext(in.Context())
 	// perform actual HTTP round trip
 	out, err := rt.transport.RoundTrip(in)
 	// read read response body or fill it with just enough defaults
 	outBody, out := rt.outBody(out, err)
+	inHeaders := rt.headersToMap(in.Header)
+	for k, v := range routing {
+		inHeaders[k] = v
+	}
 	// record concise information about the request for debugging purposes
-	rt.history.Record(Request{
+	record := Request{
 		Serial:     serial,
 		Attempt:    attempt,
 		Ts:         time.Now(),
@@ -75,14 +97,17 @@ func (rt roundTripper) RoundTrip(in *http.Request) (*http.Response, error) {
 		URL:        in.URL.String(),
 		StatusCode: out.StatusCode,
 		Status:     out.Status,
+		Blocked:    out.Header.Get("X-Proxy-Blocked"),
 		Proxy:      proxy,
-		InHeaders:  rt.headersToMap(in.Header),
+		InHeaders:  inHeaders,
 		OutHeaders: rt.headersToMap(out.Header),
 		InBody:     justRead(in.Body),
 		OutBody:    outBody,
 		Size:       len(outBody),
 		Took:       time.Since(start),
-	})
+	}
+	rt.history.observe(record)
+	rt.history.Record(record)
 	if err != nil {
 		// net/http/client.go expects no body on error
 		return nil, err
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/nfx/slrp/app"
@@ -74,3 +75,90 @@ func TestRoundTripperCornerCases(t *testing.T) {
 	assert.Equal(t, "", req.InHeaders["X-Proxy-Attempt"])
 	assert.Equal(t, "nothing", req.InHeaders["Abc"])
 }
+
+type headerCapture struct {
+	header http.Header
+}
+
+func (hc *headerCapture) RoundTrip(in *http.Request) (*http.Response, error) {
+	hc.header = in.Header.Clone()
+	return &http.Response{StatusCode: 200, Header: http.Header{}}, nil
+}
+
+func TestRoundTripperRoutingHeaders(t *testing.T) {
+	hist := NewHistory()
+	runtime := app.Singletons{"_": hist}.MockStart()
+	defer runtime.Stop()
+
+	capture := &headerCapture{}
+	_, err := roundTripper{hist, capture}.RoundTrip(&http.Request{
+		Header: http.Header{
+			"X-Proxy-Hints":   []string{`Country = "DE"`},
+			"X-Proxy-Session": []string{"abc"},
+		},
+		Method: "GET",
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "localhost",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "", capture.header.Get("X-Proxy-Hints"))
+	assert.Equal(t, "", capture.header.Get("X-Proxy-Session"))
+
+	// wait until request is recorded
+	<-runtime["_"].Wait
+	runtime["_"].Spin()
+
+	res, err := hist.HttpGetByID("1", nil)
+	assert.NoError(t, err)
+	req := res.(Request)
+	assert.Equal(t, `Country = "DE"`, req.InHeaders["X-Proxy-Hints"])
+	assert.Equal(t, "abc", req.InHeaders["X-Proxy-Session"])
+}
+
+type blockedTransport struct{}
+
+func (blockedTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("X-Proxy-Blocked", "captcha")
+	return &http.Response{StatusCode: 200, Header: header}, nil
+}
+
+func TestRoundTripperBlocked(t *testing.T) {
+	hist := NewHistory()
+	runtime := app.Singletons{"_": hist}.MockStart()
+	defer runtime.Stop()
+
+	_, err := roundTripper{hist, blockedTransport{}}.RoundTrip(&http.Request{
+		Method: "GET",
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "localhost",
+		},
+	})
+	assert.NoError(t, err)
+
+	// wait until request is recorded
+	<-runtime["_"].Wait
+	runtime["_"].Spin()
+
+	res, err := hist.HttpGetByID("1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "captcha", res.(Request).Blocked)
+
+	out, err := hist.HttpGet(&http.Request{URL: &url.URL{
+		RawQuery: url.Values{"filter": {`Blocked = "captcha"`}}.Encode(),
+	}})
+	assert.NoError(t, err)
+	filtered := out.(filterResults)
+	assert.Len(t, filtered.Records, 1)
+	assert.Equal(t, "captcha", filtered.Records[0].Blocked)
+
+	m := app.NewMetrics()
+	hist.CollectMetrics(m)
+	var sb strings.Builder
+	m.WriteTo(&sb)
+	assert.Contains(t, sb.String(), `slrp_history_request_duration_seconds_count{outcome="blocked"} 1`)
+	assert.Contains(t, sb.String(), `slrp_history_request_duration_seconds_count{outcome="ok"} 0`)
+}
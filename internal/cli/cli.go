@@ -0,0 +1,324 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/checker"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/pool"
+	"github.com/nfx/slrp/probe"
+	"github.com/nfx/slrp/stats"
+)
+
+// Command works with the state directory without starting the application
+type Command struct {
+	Factories app.Factories
+	Out       io.Writer
+}
+
+// Run executes the command, like `pool export --format csv`
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command")
+	}
+	name := args[0]
+	if len(args) > 1 {
+		name += " " + args[1]
+	}
+	switch name {
+	case "config print-defaults":
+		return app.PrintDefaults(c.Out, c.Factories)
+	case "pool export":
+		return c.poolExport(args[2:])
+	case "blacklist list":
+		return c.blacklistList(args[2:])
+	case "blacklist remove":
+		return c.blacklistRemove(args[2:])
+	case "state inspect":
+		return c.stateInspect(args[2:])
+	}
+	switch args[0] {
+	case "query":
+		return c.query(args[1:])
+	case "check":
+		return c.check(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", strings.Join(args, " "))
+	}
+}
+
+// init creates and configures only the given services, so that commands
+// don't listen on ports or probe proxies
+func (c *Command) init(state *app.State, services ...string) (app.Singletons, error) {
+	f := app.Factories{}
+	for _, service := range services {
+		factory, ok := c.Factories[service]
+		if !ok {
+			return nil, fmt.Errorf("no factory: %s", service)
+		}
+		f[service] = factory
+	}
+	return state.Init(f)
+}
+
+func (c *Command) ipLookup(state *app.State) (ipinfo.IpInfoGetter, error) {
+	singletons, err := c.init(state, "ipinfo")
+	if err != nil {
+		return nil, err
+	}
+	return singletons["ipinfo"].(ipinfo.IpInfoGetter), nil
+}
+
+func (c *Command) poolEntries(state *app.State) (pool.ApiEntryDataset, error) {
+	var persisted pool.Persisted
+	err := state.Load("pool", &persisted)
+	if err != nil {
+		return nil, err
+	}
+	ipLookup, err := c.ipLookup(state)
+	if err != nil {
+		return nil, err
+	}
+	return persisted.Entries(ipLookup), nil
+}
+
+func (c *Command) poolExport(args []string) error {
+	flags := flag.NewFlagSet("pool export", flag.ContinueOnError)
+	format := flags.String("format", "txt", "one of "+strings.Join(pool.ExportFormats, ", "))
+	filter := flags.String("filter", "", "query to select proxies. Working proxies by default")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	state, err := app.OpenState()
+	if err != nil {
+		return err
+	}
+	entries, err := c.poolEntries(state)
+	if err != nil {
+		return err
+	}
+	// whoever reads the state file has the credentials already
+	return entries.Export(c.Out, *format, *filter, true)
+}
+
+func (c *Command) probeState(state *app.State) (*probe.Persisted, error) {
+	var persisted probe.Persisted
+	err := state.Load("probe", &persisted)
+	if err != nil {
+		return nil, err
+	}
+	return &persisted, nil
+}
+
+// query prints the same records, as the API returns for the dataset
+func (c *Command) query(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: query <pool|blacklist|reverify> [query]")
+	}
+	dataset, filter := args[0], ""
+	if len(args) == 2 {
+		filter = args[1]
+	}
+	state, err := app.OpenState()
+	if err != nil {
+		return err
+	}
+	var res any
+	switch dataset {
+	case "pool":
+		entries, err := c.poolEntries(state)
+		if err != nil {
+			return err
+		}
+		res, err = entries.Query(filter)
+		if err != nil {
+			return err
+		}
+	case "blacklist", "reverify":
+		persisted, err := c.probeState(state)
+		if err != nil {
+			return err
+		}
+		ipLookup, err := c.ipLookup(state)
+		if err != nil {
+			return err
+		}
+		res, err = persisted.Query(dataset, filter, ipLookup)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown dataset: %s", dataset)
+	}
+	return c.printJson(res)
+}
+
+func (c *Command) blacklistList(args []string) error {
+	flags := flag.NewFlagSet("blacklist list", flag.ContinueOnError)
+	filter := flags.String("filter", "", "query to select blacklisted proxies")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	return c.query([]string{"blacklist", *filter})
+}
+
+// blacklistRemove changes the state of the probe, so that the application
+// must not be running
+func (c *Command) blacklistRemove(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: blacklist remove <proxy-url>...")
+	}
+	state, err := app.OpenState()
+	if err != nil {
+		return err
+	}
+	err = state.NotRunning()
+	if err != nil {
+		return err
+	}
+	persisted, err := c.probeState(state)
+	if err != nil {
+		return err
+	}
+	removed := []pmux.Proxy{}
+	for _, v := range args {
+		proxy, err := parseProxy(v)
+		if err != nil {
+			return err
+		}
+		if !persisted.Unblacklist(proxy) {
+			return fmt.Errorf("not blacklisted: %s", proxy)
+		}
+		removed = append(removed, proxy)
+	}
+	err = state.Save("probe", persisted)
+	if err != nil {
+		return err
+	}
+	for _, proxy := range removed {
+		fmt.Fprintf(c.Out, "removed %s\n", proxy)
+	}
+	return nil
+}
+
+// check verifies the proxy with the configured checker
+func (c *Command) check(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: check <proxy-url>")
+	}
+	proxy, err := parseProxy(args[0])
+	if err != nil {
+		return err
+	}
+	state, err := app.OpenState()
+	if err != nil {
+		return err
+	}
+	singletons, err := c.init(state, "dialer", "checker")
+	if err != nil {
+		return err
+	}
+	speed, err := singletons["checker"].(checker.Checker).Check(ctx, proxy)
+	if err != nil {
+		return fmt.Errorf("%s: %w", proxy, err)
+	}
+	fmt.Fprintf(c.Out, "%s is working, verified in %s\n", proxy, speed)
+	return nil
+}
+
+// persisted returns types of states, that can be shown in readable form.
+// Other snapshots, like the private key of CA, are shown only with their size.
+var persisted = map[string]func() encoding.BinaryUnmarshaler{
+	"pool": func() encoding.BinaryUnmarshaler {
+		return &pool.Persisted{}
+	},
+	"probe": func() encoding.BinaryUnmarshaler {
+		return &probe.Persisted{}
+	},
+	"stats": func() encoding.BinaryUnmarshaler {
+		return &gobState[stats.Sources]{}
+	},
+}
+
+type gobState[T any] struct {
+	Value T
+}
+
+func (g *gobState[T]) UnmarshalBinary(data []byte) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(&g.Value)
+}
+
+func (g *gobState[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.Value)
+}
+
+type inspected struct {
+	Service string
+	Version uint32
+	Size    int
+	State   any `json:",omitempty"`
+}
+
+func (c *Command) stateInspect(services []string) error {
+	state, err := app.OpenState()
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		services, err = state.Services()
+		if err != nil {
+			return err
+		}
+	}
+	for _, service := range services {
+		version, size, err := state.Version(service)
+		if err != nil {
+			return fmt.Errorf("%s: %w", service, err)
+		}
+		res := inspected{
+			Service: service,
+			Version: version,
+			Size:    size,
+		}
+		factory, ok := persisted[service]
+		if ok {
+			s := factory()
+			err = state.Load(service, s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", service, err)
+			}
+			res.State = s
+		}
+		err = c.printJson(res)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Command) printJson(v any) error {
+	enc := json.NewEncoder(c.Out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func parseProxy(raw string) (pmux.Proxy, error) {
+	proxy := pmux.NewProxyFromURL(raw)
+	if !proxy.Valid() {
+		return proxy, fmt.Errorf("invalid proxy: %s", raw)
+	}
+	return proxy, nil
+}
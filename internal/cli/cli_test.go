@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/checker"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/probe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChecker struct{}
+
+func (fakeChecker) Check(ctx context.Context, proxy pmux.Proxy) (time.Duration, error) {
+	if proxy.Port() == 1 {
+		return 0, fmt.Errorf("timeout")
+	}
+	return time.Second, nil
+}
+
+func testCommand(t *testing.T) (*Command, *bytes.Buffer) {
+	t.Setenv("APP", "slrp")
+	t.Setenv("PWD", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SLRP_APP_STATE", t.TempDir())
+	// nothing listens on the closed port, so that slrp is not running
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Setenv("SLRP_SERVER_ADDR", listener.Addr().String())
+	listener.Close()
+	var out bytes.Buffer
+	return &Command{
+		Out: &out,
+		Factories: app.Factories{
+			"ipinfo": func() ipinfo.NoopIpInfo {
+				return ipinfo.NoopIpInfo{Country: "Zimbabwe"}
+			},
+			"dialer": func() int {
+				return 0
+			},
+			"checker": func(int) checker.Checker {
+				return fakeChecker{}
+			},
+		},
+	}, &out
+}
+
+func TestBlacklist(t *testing.T) {
+	cmd, out := testCommand(t)
+	state, err := app.OpenState()
+	require.NoError(t, err)
+	var persisted probe.Persisted
+	persisted.Failures = []string{"timeout"}
+	persisted.Blacklist = map[pmux.Proxy]int{
+		pmux.HttpProxy("127.0.0.1:8080"): 0,
+		pmux.HttpProxy("127.0.0.2:8080"): 0,
+	}
+	err = state.Save("probe", &persisted)
+	require.NoError(t, err)
+
+	err = cmd.Run(context.Background(), []string{"blacklist", "list"})
+	require.NoError(t, err)
+	var res struct {
+		Total   int
+		Records []struct {
+			Proxy   string
+			Country string
+			Failure string
+		}
+	}
+	err = json.Unmarshal(out.Bytes(), &res)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total)
+	assert.Equal(t, "Zimbabwe", res.Records[0].Country)
+	assert.Equal(t, "timeout", res.Records[0].Failure)
+
+	out.Reset()
+	err = cmd.Run(context.Background(), []string{"blacklist", "remove", "http://127.0.0.1:8080"})
+	require.NoError(t, err)
+	assert.Equal(t, "removed http://127.0.0.1:8080\n", out.String())
+
+	err = cmd.Run(context.Background(), []string{"blacklist", "remove", "http://127.0.0.1:8080"})
+	assert.EqualError(t, err, "not blacklisted: http://127.0.0.1:8080")
+
+	out.Reset()
+	err = cmd.Run(context.Background(), []string{"query", "blacklist", `Proxy ~ "127.0.0.1"`})
+	require.NoError(t, err)
+	err = json.Unmarshal(out.Bytes(), &res)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Total)
+
+	out.Reset()
+	err = cmd.Run(context.Background(), []string{"state", "inspect", "probe"})
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `"Service": "probe"`)
+	assert.Contains(t, out.String(), `"http://127.0.0.2:8080": 0`)
+}
+
+func TestBlacklistRemoveWhileRunning(t *testing.T) {
+	cmd, out := testCommand(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	addr := listener.Addr().String()
+	t.Setenv("SLRP_SERVER_ADDR", addr)
+
+	err = cmd.Run(context.Background(), []string{"blacklist", "remove", "http://127.0.0.1:8080"})
+	assert.EqualError(t, err, fmt.Sprintf("slrp is running on %s, stop it before changing the state", addr))
+	assert.Empty(t, out.String())
+}
+
+func TestQueryErrors(t *testing.T) {
+	cmd, _ := testCommand(t)
+	err := cmd.Run(context.Background(), []string{"query", "history"})
+	assert.EqualError(t, err, "unknown dataset: history")
+
+	err = cmd.Run(context.Background(), []string{"query", "pool"})
+	assert.ErrorContains(t, err, "no such file or directory")
+
+	err = cmd.Run(context.Background(), []string{"pool", "export", "--format", "xml"})
+	assert.ErrorContains(t, err, "no such file or directory")
+
+	err = cmd.Run(context.Background(), []string{"unknown", "command"})
+	assert.EqualError(t, err, "unknown command: unknown command")
+}
+
+func TestCheck(t *testing.T) {
+	cmd, out := testCommand(t)
+	err := cmd.Run(context.Background(), []string{"check", "http://127.0.0.1:8080"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080 is working, verified in 1s\n", out.String())
+
+	err = cmd.Run(context.Background(), []string{"check", "http://127.0.0.1:1"})
+	assert.EqualError(t, err, "http://127.0.0.1:1: timeout")
+
+	err = cmd.Run(context.Background(), []string{"check", "nope"})
+	assert.EqualError(t, err, "invalid proxy: nope")
+}
@@ -46,9 +46,21 @@ func (i *Lookup) Configure(c app.Config) error {
 	return nil
 }
 
-func (i *Lookup) Start(ctx app.Context) {
+func (i *Lookup) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "license", Type: app.TypeString, Secret: true,
+			Doc: "license key for MaxMind downloads"},
+		{Name: "mmdb_asn", Type: app.TypeString, Default: "$HOME/.$APP/maxmind/GeoLite2-ASN.mmdb",
+			Doc: "downloaded snapshot of MaxMind ASN database"},
+		{Name: "mmdb_city", Type: app.TypeString, Default: "$HOME/.$APP/maxmind/GeoLite2-City.mmdb",
+			Doc: "downloaded snapshot of MaxMind City database"},
+	}
+}
+
+func (i *Lookup) Start(ctx app.Context) error {
 	// noop - later, when we'll be doing refreshes - we should decide if we
 	// should block or not, replace reader just from one thread and etc.
+	return nil
 }
 
 var geoLiteCityFmt = "https://download.maxmind.com/app/geoip_download?edition_id=%s&license_key=%s&suffix=tar.gz"
@@ -5,11 +5,13 @@ import (
 	"embed"
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/nfx/slrp/app"
 	"github.com/nfx/slrp/checker"
 	"github.com/nfx/slrp/dialer"
 	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/internal/cli"
 	"github.com/nfx/slrp/internal/updater"
 	"github.com/nfx/slrp/ipinfo"
 	"github.com/nfx/slrp/pool"
@@ -30,8 +32,28 @@ func main() {
 	if *updatePtr {
 		updater.AutoUpdate(version)
 	}
+	if flag.NArg() > 0 {
+		// offline commands work with the state directory without starting servers
+		cmd := &cli.Command{
+			Factories: factories(),
+			Out:       os.Stdout,
+		}
+		err := cmd.Run(context.Background(), flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	fmt.Printf("slrp v%s\n", version)
-	app.Run(context.Background(), app.Factories{
+	err := app.Run(context.Background(), factories())
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func factories() app.Factories {
+	return app.Factories{
 		"ca":        serve.NewCA,
 		"blacklist": probe.NewBlacklistApi,
 		"checker":   checker.NewChecker,
@@ -44,7 +66,9 @@ func main() {
 		"probe":     probe.NewProbe,
 		"refresher": refresher.NewRefresher,
 		"reverify":  probe.NewReverifyApi,
+		"sessions":  pool.NewSessionsApi,
+		"socks":     serve.NewSocksProxyServer,
 		"stats":     stats.NewStats,
 		"ui":        app.MountSpaUI(embedFrontend),
-	})
+	}
 }
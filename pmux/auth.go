@@ -0,0 +1,91 @@
+package pmux
+
+import (
+	"encoding/base64"
+	"net/url"
+	"sync"
+)
+
+// credentials are interned in a process-wide table, so that Proxy stays
+// comparable and small, as only a handful of upstream proxies have them
+var credentials = &credentialTable{
+	ids: map[credential]uint32{},
+}
+
+type credential struct {
+	user string
+	pass string
+}
+
+type credentialTable struct {
+	mu    sync.RWMutex
+	ids   map[credential]uint32
+	items []credential
+}
+
+// intern returns identifier of credentials, that is never zero
+func (ct *credentialTable) intern(c credential) uint32 {
+	ct.mu.RLock()
+	id, ok := ct.ids[c]
+	ct.mu.RUnlock()
+	if ok {
+		return id
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	id, ok = ct.ids[c]
+	if ok {
+		return id
+	}
+	ct.items = append(ct.items, c)
+	id = uint32(len(ct.items))
+	ct.ids[c] = id
+	return id
+}
+
+func (ct *credentialTable) get(id uint32) (credential, bool) {
+	if id == 0 {
+		return credential{}, false
+	}
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	if int(id) > len(ct.items) {
+		return credential{}, false
+	}
+	return ct.items[id-1], true
+}
+
+// WithAuth returns the same proxy, that authenticates with username and
+// password: Proxy-Authorization header for HTTP and HTTPS, RFC 1929 for SOCKS5.
+// Proxies with different credentials are different entries in the pool.
+func (p Proxy) WithAuth(user, pass string) Proxy {
+	if user == "" && pass == "" {
+		p.auth = 0
+		return p
+	}
+	p.auth = credentials.intern(credential{user, pass})
+	return p
+}
+
+func (p Proxy) HasAuth() bool {
+	return p.auth != 0
+}
+
+// User returns credentials of the proxy or nil, if there are none
+func (p Proxy) User() *url.Userinfo {
+	c, ok := credentials.get(p.auth)
+	if !ok {
+		return nil
+	}
+	return url.UserPassword(c.user, c.pass)
+}
+
+// proxyAuthorization returns value for Proxy-Authorization header
+func (p Proxy) proxyAuthorization() string {
+	c, ok := credentials.get(p.auth)
+	if !ok {
+		return ""
+	}
+	raw := []byte(c.user + ":" + c.pass)
+	return "Basic " + base64.StdEncoding.EncodeToString(raw)
+}
@@ -1,7 +1,11 @@
 package pmux
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"testing"
@@ -38,6 +42,95 @@ func TestProxyBucket(t *testing.T) {
 	assert.Equal(t, 4, HttpProxy("127.0.0.1:23456").Bucket(10))
 }
 
+func TestProxyBucket_IPv6(t *testing.T) {
+	p := HttpProxy("[2001:db8::1]:8080")
+	bucket := p.Bucket(31)
+	assert.True(t, bucket >= 0 && bucket < 31)
+	assert.Equal(t, bucket, p.Bucket(31), "must be deterministic")
+	seen := map[int]bool{}
+	for i := 1; i < 100; i++ {
+		seen[HttpProxy(fmt.Sprintf("[2001:db8::%x]:8080", i)).Bucket(31)] = true
+	}
+	assert.Greater(t, len(seen), 15, "must be distributed")
+}
+
+func TestNewProxy_IPv6(t *testing.T) {
+	p := Socks5Proxy("[2001:DB8::1]:1080")
+	assert.True(t, p.Valid())
+	assert.True(t, p.IsIPv6())
+	assert.Equal(t, "socks5://[2001:db8::1]:1080", p.String())
+	assert.Equal(t, "[2001:db8::1]:1080", p.Address())
+	assert.Equal(t, net.ParseIP("2001:db8::1"), p.IP())
+	assert.Equal(t, "socks5://[2001:db8::1]:1080", p.URL().String())
+
+	// unbracketed address is ambiguous
+	assert.False(t, HttpProxy("2001:db8::1:8080").Valid())
+	// zones cannot be used for remote proxies
+	assert.Equal(t, "http://[fe80::1]:80", HttpProxy("[fe80::1%eth0]:80").String())
+}
+
+func TestNewProxy_IPv4Mapped(t *testing.T) {
+	mapped := HttpProxy("[::ffff:1.2.3.4]:3128")
+	assert.False(t, mapped.IsIPv6())
+	assert.Equal(t, HttpProxy("1.2.3.4:3128"), mapped)
+}
+
+func TestProxyBinary(t *testing.T) {
+	for _, p := range []Proxy{
+		Socks4Proxy("1.2.3.4:56789"),
+		HttpsProxy("[2001:db8::1]:443"),
+		{},
+	} {
+		raw, err := p.MarshalBinary()
+		assert.NoError(t, err)
+		var loaded Proxy
+		err = loaded.UnmarshalBinary(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, p, loaded)
+	}
+	var p Proxy
+	err := p.UnmarshalBinary([]byte{1, 2})
+	assert.EqualError(t, err, "invalid proxy length: 2")
+}
+
+func TestProxyGobMapKeys(t *testing.T) {
+	in := map[Proxy]int{
+		HttpProxy("1.2.3.4:80"):        1,
+		Socks5Proxy("[2001:db8::2]:1"): 2,
+	}
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(in)
+	assert.NoError(t, err)
+	out := map[Proxy]int{}
+	err = gob.NewDecoder(&b).Decode(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+}
+
+func TestProxyText(t *testing.T) {
+	raw, err := json.Marshal(map[Proxy]int{
+		HttpsProxy("[2001:db8::1]:443"): 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"https://[2001:db8::1]:443":1}`, string(raw))
+
+	var out map[Proxy]int
+	err = json.Unmarshal(raw, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, out[HttpsProxy("[2001:db8::1]:443")])
+
+	var p Proxy
+	err = p.UnmarshalText([]byte("nope"))
+	assert.EqualError(t, err, "invalid proxy: nope")
+}
+
+func TestLegacyProxy(t *testing.T) {
+	// 127.0.0.1:23456 over socks5, as it was packed in uint64
+	packed := uint64(0x7f000001)<<32 | uint64(23456)<<16 | uint64(SOCKS5)
+	assert.Equal(t, Socks5Proxy("127.0.0.1:23456"), LegacyProxy(packed))
+	assert.Equal(t, Proxy{}, LegacyProxy(0))
+}
+
 func TestProxyURL(t *testing.T) {
 	assert.Equal(t, "socks5://1.2.3.4:56789", Socks5Proxy("1.2.3.4:56789").URL().String())
 }
@@ -50,14 +143,14 @@ func TestProxyMarlshalJSON(t *testing.T) {
 
 func TestGetProxyFromContext(t *testing.T) {
 	proxy := GetProxyFromContext(context.Background())
-	assert.Equal(t, Proxy(0), proxy)
+	assert.Equal(t, Proxy{}, proxy)
 }
 
 func TestGetProxyFromContextInvalidType(t *testing.T) {
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, proxyURL, "lalala")
 	proxy := GetProxyFromContext(ctx)
-	assert.Equal(t, Proxy(0), proxy)
+	assert.Equal(t, Proxy{}, proxy)
 }
 
 func TestContextualHttpTransport(t *testing.T) {
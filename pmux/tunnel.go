@@ -0,0 +1,113 @@
+package pmux
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ContextDialer establishes outgoing connections to proxies
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// SupportsConnect tells if raw TCP connection could be established through
+// this proxy. HTTP proxies are only verified for plain HTTP requests, so they
+// may not support CONNECT method.
+func (p Proxy) SupportsConnect() bool {
+	return p.Proto() != HTTP
+}
+
+// Tunnel establishes raw TCP connection to addr through the proxy. Deadline of
+// the context is applied only to connection establishment and handshakes.
+func Tunnel(ctx context.Context, forward ContextDialer, p Proxy, addr string) (net.Conn, error) {
+	switch p.Proto() {
+	case SOCKS4, SOCKS5:
+		dialer, err := proxy.FromURL(p.URL(), contextForward{ctx, forward})
+		if err != nil {
+			return nil, err
+		}
+		if cd, ok := dialer.(proxy.ContextDialer); ok {
+			return cd.DialContext(ctx, "tcp", addr)
+		}
+		return dialer.Dial("tcp", addr)
+	case HTTPS:
+		conn, err := forward.DialContext(ctx, "tcp", p.Address())
+		if err != nil {
+			return nil, fmt.Errorf("dial https: %w", err)
+		}
+		return httpConnect(ctx, tls.Client(conn, DefaultTlsConfig), addr, p.proxyAuthorization())
+	default:
+		return nil, fmt.Errorf("%s proxies do not support tunnels", p.Scheme())
+	}
+}
+
+// httpConnect sends CONNECT request over an established connection to the proxy
+func httpConnect(ctx context.Context, conn net.Conn, addr, auth string) (net.Conn, error) {
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	err := req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	buf := bufio.NewReader(conn)
+	res, err := http.ReadResponse(buf, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	// body is not closed, as some proxies send chunked encoding header
+	// on CONNECT and closing would block until the tunnel is closed
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %s", res.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	if buf.Buffered() == 0 {
+		return conn, nil
+	}
+	// some protocols, like SSH, have servers speaking first
+	return &bufferedConn{conn, buf}, nil
+}
+
+// contextForward adapts ContextDialer to dialers registered in golang.org/x/net/proxy
+type contextForward struct {
+	ctx     context.Context
+	forward ContextDialer
+}
+
+func (cf contextForward) Dial(network, addr string) (net.Conn, error) {
+	return cf.forward.DialContext(cf.ctx, network, addr)
+}
+
+func (cf contextForward) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return cf.forward.DialContext(ctx, network, addr)
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
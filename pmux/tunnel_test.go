@@ -0,0 +1,74 @@
+package pmux
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportsConnect(t *testing.T) {
+	assert.False(t, HttpProxy("127.0.0.1:1").SupportsConnect())
+	assert.True(t, HttpsProxy("127.0.0.1:1").SupportsConnect())
+	assert.True(t, Socks4Proxy("127.0.0.1:1").SupportsConnect())
+	assert.True(t, Socks5Proxy("127.0.0.1:1").SupportsConnect())
+}
+
+func TestTunnel_HTTP(t *testing.T) {
+	_, err := Tunnel(context.Background(), DefaultDialer,
+		HttpProxy("127.0.0.1:1"), "example.com:443")
+	assert.EqualError(t, err, "http proxies do not support tunnels")
+}
+
+func TestTunnel_SOCKS5_Refused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err = Tunnel(context.Background(), DefaultDialer,
+		Socks5Proxy(addr), "example.com:443")
+	assert.Error(t, err)
+}
+
+func TestTunnel_HTTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Host != "example.com:22" {
+				w.WriteHeader(403)
+				return
+			}
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			defer conn.Close()
+			// server speaks first, like SSH does
+			conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\nSSH-2.0-Fake\r\n"))
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte(strings.ToUpper(line)))
+		}))
+	defer srv.Close()
+	proxy := HttpsProxy(srv.Listener.Addr().String())
+
+	_, err := Tunnel(context.Background(), DefaultDialer, proxy, "example.com:443")
+	assert.EqualError(t, err, "connect: 403 Forbidden")
+
+	conn, err := Tunnel(context.Background(), DefaultDialer, proxy, "example.com:22")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	buf := bufio.NewReader(conn)
+	banner, err := buf.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "SSH-2.0-Fake\r\n", banner)
+
+	conn.Write([]byte("hello\n"))
+	echo, err := buf.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO\n", echo)
+}
@@ -8,7 +8,11 @@ import (
 type ApiEntryDataset []ApiEntry
 
 func (d ApiEntryDataset) Query(query string) (*eval.QueryResult[ApiEntry], error) {
-	return (&eval.Dataset[ApiEntry, ApiEntryDataset]{
+	return d.Dataset().Query(query)
+}
+
+func (d ApiEntryDataset) Dataset() *eval.Dataset[ApiEntry, ApiEntryDataset] {
+	return &eval.Dataset[ApiEntry, ApiEntryDataset]{
 		Source: d,
 		Accessors: eval.Accessors{
 			"Proxy":          eval.StringGetter{Name: "Proxy", Func: d.getProxy},
@@ -24,6 +28,8 @@ func (d ApiEntryDataset) Query(query string) (*eval.QueryResult[ApiEntry], error
 			"Country":        eval.StringGetter{Name: "Country", Func: d.getCountry},
 			"Provider":       eval.StringGetter{Name: "Provider", Func: d.getProvider},
 			"ASN":            eval.NumberGetter{Name: "ASN", Func: d.getASN},
+			"Pinned":         eval.BooleanGetter{Name: "Pinned", Func: d.getPinned},
+			"Latency":        eval.NumberGetter{Name: "Latency", Func: d.getLatency},
 		},
 		Sorters: eval.Sorters[ApiEntry]{
 			"Proxy":          {Asc: d.sortAscProxy, Desc: d.sortDescProxy},
@@ -39,6 +45,8 @@ func (d ApiEntryDataset) Query(query string) (*eval.QueryResult[ApiEntry], error
 			"Country":        {Asc: d.sortAscCountry, Desc: d.sortDescCountry},
 			"Provider":       {Asc: d.sortAscProvider, Desc: d.sortDescProvider},
 			"ASN":            {Asc: d.sortAscASN, Desc: d.sortDescASN},
+			"Pinned":         {Asc: d.sortAscPinned, Desc: d.sortDescPinned},
+			"Latency":        {Asc: d.sortAscLatency, Desc: d.sortDescLatency},
 		},
 		Facets: func(filtered ApiEntryDataset, topN int) []eval.Facet {
 			return eval.FacetRetrievers[ApiEntry]{
@@ -82,7 +90,7 @@ func (d ApiEntryDataset) Query(query string) (*eval.QueryResult[ApiEntry], error
 				},
 			}.Facets(filtered, topN)
 		},
-	}).Query(query)
+	}
 }
 
 func (d ApiEntryDataset) getProxy(record int) string {
@@ -240,3 +248,27 @@ func (_ ApiEntryDataset) sortAscASN(left, right ApiEntry) bool {
 func (_ ApiEntryDataset) sortDescASN(left, right ApiEntry) bool {
 	return left.ASN > right.ASN
 }
+
+func (d ApiEntryDataset) getPinned(record int) bool {
+	return d[record].Pinned
+}
+
+func (_ ApiEntryDataset) sortAscPinned(left, right ApiEntry) bool {
+	return left.Pinned == right.Pinned
+}
+
+func (_ ApiEntryDataset) sortDescPinned(left, right ApiEntry) bool {
+	return left.Pinned != right.Pinned
+}
+
+func (d ApiEntryDataset) getLatency(record int) float64 {
+	return float64(d[record].Latency)
+}
+
+func (_ ApiEntryDataset) sortAscLatency(left, right ApiEntry) bool {
+	return left.Latency < right.Latency
+}
+
+func (_ ApiEntryDataset) sortDescLatency(left, right ApiEntry) bool {
+	return left.Latency > right.Latency
+}
@@ -0,0 +1,232 @@
+package pool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// blockRule detects responses, that come from blocked proxies even though
+// they are technically successful, like captchas served with 200 OK. All
+// conditions of a rule have to match.
+type blockRule struct {
+	Name string `json:"name"`
+	// Hosts limit the rule to destination hosts and their subdomains
+	Hosts []string `json:"hosts,omitempty"`
+	// Status matches any of the response status codes
+	Status []int `json:"status,omitempty"`
+	// Headers match values of response headers with regular expressions
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body matches the beginning of response body with a regular expression
+	Body      string `json:"body,omitempty"`
+	EmptyBody bool   `json:"empty_body,omitempty"`
+	// MaxBody is the number of bytes of the body, that Body is matched with
+	MaxBody int `json:"max_body,omitempty"`
+
+	headers map[string]*regexp.Regexp
+	body    *regexp.Regexp
+}
+
+// defaultMaxBody keeps rules from buffering large downloads and streams
+const defaultMaxBody = 64 << 10
+
+// defaultBlockRules are used, unless there's block_rules_file configured
+var defaultBlockRules = []blockRule{
+	{
+		Name:    "cloudflare-challenge",
+		Headers: map[string]string{"Cf-Mitigated": "challenge"},
+	},
+}
+
+func (r *blockRule) compile() (err error) {
+	if r.Name == "" {
+		return fmt.Errorf("block rule has no name")
+	}
+	if len(r.Status) == 0 && len(r.Headers) == 0 && r.Body == "" && !r.EmptyBody {
+		return fmt.Errorf("block rule %s has no conditions", r.Name)
+	}
+	r.headers = map[string]*regexp.Regexp{}
+	for k, v := range r.Headers {
+		r.headers[http.CanonicalHeaderKey(k)], err = regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("block rule %s: header %s: %w", r.Name, k, err)
+		}
+	}
+	if r.Body != "" {
+		r.body, err = regexp.Compile(r.Body)
+		if err != nil {
+			return fmt.Errorf("block rule %s: body: %w", r.Name, err)
+		}
+	}
+	for i, v := range r.Hosts {
+		r.Hosts[i] = strings.ToLower(v)
+	}
+	if r.MaxBody == 0 {
+		r.MaxBody = defaultMaxBody
+	}
+	return nil
+}
+
+func (r *blockRule) needsBody() bool {
+	return r.body != nil || r.EmptyBody
+}
+
+// matchHead checks conditions, that don't need the body
+func (r *blockRule) matchHead(host string, res *http.Response) bool {
+	if len(r.Hosts) > 0 && !matchesHost(host, r.Hosts) {
+		return false
+	}
+	if len(r.Status) > 0 && !containsStatus(r.Status, res.StatusCode) {
+		return false
+	}
+	for k, re := range r.headers {
+		if !re.MatchString(res.Header.Get(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *blockRule) matchBody(body *peekedBody) (bool, error) {
+	if !r.needsBody() {
+		return true, nil
+	}
+	prefix, err := body.peek(r.MaxBody)
+	if err != nil {
+		return false, err
+	}
+	if r.EmptyBody && len(prefix) > 0 {
+		return false, nil
+	}
+	if r.body != nil && !r.body.Match(prefix) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func matchesHost(host string, hosts []string) bool {
+	for _, v := range hosts {
+		if host == v || strings.HasSuffix(host, "."+v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(status []int, code int) bool {
+	for _, v := range status {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBlockRules reads YAML list of rules from the file or returns defaults
+func loadBlockRules(file string) ([]blockRule, error) {
+	rules := append([]blockRule{}, defaultBlockRules...)
+	if file != "" {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rules = nil
+		err = yaml.Unmarshal(raw, &rules)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	for i := range rules {
+		err := rules[i].compile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// blockDetector marks responses, that match block rules, with X-Proxy-Blocked
+// header, so that history records the rule and the pool retries the request
+// through another proxy
+type blockDetector struct {
+	rules     []blockRule
+	transport http.RoundTripper
+}
+
+func (d *blockDetector) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := d.transport.RoundTrip(req)
+	if err != nil || req.Method == http.MethodConnect {
+		return res, err
+	}
+	host := requestHost(req)
+	body := &peekedBody{res: res}
+	defer body.restore()
+	for i := range d.rules {
+		rule := &d.rules[i]
+		if !rule.matchHead(host, res) {
+			continue
+		}
+		match, err := rule.matchBody(body)
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		if match {
+			res.Header.Set("X-Proxy-Blocked", rule.Name)
+			break
+		}
+	}
+	return res, nil
+}
+
+// peekedBody reads only the beginning of the response body, once a rule
+// needs it, and puts it back in front of the unread rest
+type peekedBody struct {
+	res      *http.Response
+	raw      []byte
+	complete bool
+}
+
+// peek returns up to n bytes of the body. Bodies with gzip encoding are
+// decoded, other encodings are matched as they are.
+func (p *peekedBody) peek(n int) ([]byte, error) {
+	if !p.complete && len(p.raw) < n && p.res.Body != nil {
+		more, err := io.ReadAll(io.LimitReader(p.res.Body, int64(n-len(p.raw))))
+		p.raw = append(p.raw, more...)
+		if err != nil {
+			return nil, err
+		}
+		p.complete = len(p.raw) < n
+	}
+	if p.res.Header.Get("Content-Encoding") != "gzip" || len(p.raw) == 0 {
+		if len(p.raw) > n {
+			return p.raw[:n], nil
+		}
+		return p.raw, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(p.raw))
+	if err != nil {
+		// not really gzip, so match it as it is
+		return p.raw, nil
+	}
+	// prefix of the stream is truncated, so errors are expected
+	decoded, _ := io.ReadAll(io.LimitReader(gz, int64(n)))
+	return decoded, nil
+}
+
+func (p *peekedBody) restore() {
+	if len(p.raw) == 0 || p.res.Body == nil {
+		return
+	}
+	p.res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(p.raw), p.res.Body), p.res.Body}
+}
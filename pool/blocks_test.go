@@ -0,0 +1,220 @@
+package pool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type transportFunc func(req *http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func writeBlockRules(t *testing.T, raw string) string {
+	file := filepath.Join(t.TempDir(), "blocks.yml")
+	err := os.WriteFile(file, []byte(raw), 0o600)
+	require.NoError(t, err)
+	return file
+}
+
+func TestLoadBlockRules(t *testing.T) {
+	rules, err := loadBlockRules("")
+	require.NoError(t, err)
+	assert.Len(t, rules, len(defaultBlockRules))
+
+	rules, err = loadBlockRules(writeBlockRules(t, `
+- name: captcha
+  hosts: [Example.COM]
+  status: [200, 403]
+  headers:
+    content-type: ^text/html
+  body: (?i)are you a robot
+- name: empty
+  empty_body: true`))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, []string{"example.com"}, rules[0].Hosts)
+
+	_, err = loadBlockRules(writeBlockRules(t, `- name: nothing`))
+	assert.EqualError(t, err, "block rule nothing has no conditions")
+
+	_, err = loadBlockRules(writeBlockRules(t, `- status: [403]`))
+	assert.EqualError(t, err, "block rule has no name")
+
+	_, err = loadBlockRules(writeBlockRules(t, `- {name: broken, body: "("}`))
+	assert.ErrorContains(t, err, "block rule broken: body")
+
+	_, err = loadBlockRules("/nonexistent/blocks.yml")
+	assert.Error(t, err)
+}
+
+func TestBlockDetector(t *testing.T) {
+	rules, err := loadBlockRules(writeBlockRules(t, `
+- name: captcha
+  hosts: [example.com]
+  status: [200]
+  body: are you a robot
+- name: forbidden-header
+  headers:
+    X-Deny: "^yes$"
+- name: empty
+  hosts: [empty.org]
+  empty_body: true`))
+	require.NoError(t, err)
+	reply := func(status int, header http.Header, body string) *blockDetector {
+		return &blockDetector{
+			rules: rules,
+			transport: transportFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: status,
+					Header:     header.Clone(),
+					Body:       io.NopCloser(strings.NewReader(body)),
+				}, nil
+			}),
+		}
+	}
+	blocked := func(d *blockDetector, url string) string {
+		req, _ := http.NewRequest("GET", url, nil)
+		res, err := d.RoundTrip(req)
+		require.NoError(t, err)
+		// body remains readable after inspection
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "are you a robot?", string(body))
+		return res.Header.Get("X-Proxy-Blocked")
+	}
+	captcha := reply(200, http.Header{}, "are you a robot?")
+	assert.Equal(t, "captcha", blocked(captcha, "http://example.com/"))
+	assert.Equal(t, "captcha", blocked(captcha, "http://www.Example.com/"))
+	assert.Equal(t, "", blocked(captcha, "http://notexample.com/"))
+	assert.Equal(t, "", blocked(reply(404, http.Header{}, "are you a robot?"), "http://example.com/"))
+
+	header := http.Header{}
+	header.Set("X-Deny", "yes")
+	assert.Equal(t, "forbidden-header", blocked(reply(200, header, "are you a robot?"), "http://a.com/"))
+
+	req, _ := http.NewRequest("GET", "http://empty.org/", nil)
+	res, err := reply(200, http.Header{}, "").RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "empty", res.Header.Get("X-Proxy-Blocked"))
+}
+
+// untouchedBody fails the test, if it's read
+type untouchedBody struct {
+	t *testing.T
+}
+
+func (b untouchedBody) Read([]byte) (int, error) {
+	b.t.Fatal("body must not be read")
+	return 0, io.EOF
+}
+
+func (b untouchedBody) Close() error {
+	return nil
+}
+
+func TestBlockDetectorReadsBodyLazily(t *testing.T) {
+	rules, err := loadBlockRules(writeBlockRules(t, `
+- name: captcha
+  hosts: [example.com]
+  body: are you a robot
+  max_body: 16
+- name: compressed
+  hosts: [gzip.org]
+  body: are you a robot`))
+	require.NoError(t, err)
+	respond := func(header http.Header, body io.ReadCloser) *blockDetector {
+		return &blockDetector{
+			rules: rules,
+			transport: transportFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Header: header, Body: body}, nil
+			}),
+		}
+	}
+
+	// other hosts don't read the body
+	req, _ := http.NewRequest("GET", "http://other.org/", nil)
+	res, err := respond(http.Header{}, untouchedBody{t}).RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "", res.Header.Get("X-Proxy-Blocked"))
+
+	// only the beginning of the body is matched, but all of it is returned
+	long := strings.Repeat("x", 32) + "are you a robot?"
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	res, err = respond(http.Header{}, io.NopCloser(strings.NewReader(long))).RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "", res.Header.Get("X-Proxy-Blocked"))
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, long, string(body))
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("are you a robot?"))
+	gz.Close()
+	raw := compressed.String()
+	header := http.Header{}
+	header.Set("Content-Encoding", "gzip")
+	req, _ = http.NewRequest("GET", "http://gzip.org/", nil)
+	res, err = respond(header, io.NopCloser(strings.NewReader(raw))).RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "compressed", res.Header.Get("X-Proxy-Blocked"))
+	body, _ = io.ReadAll(res.Body)
+	assert.Equal(t, raw, string(body))
+}
+
+func TestRoundTripBlocked(t *testing.T) {
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), ipinfo.NoopIpInfo{}, &net.Dialer{}))
+	defer runtime.Stop()
+
+	ctx := context.Background()
+	captcha := pmux.HttpProxy("127.0.0.1:1")
+	good := pmux.HttpProxy("127.0.0.1:2")
+	pool.Add(ctx, captcha, time.Second)
+	pool.Add(ctx, good, time.Second)
+
+	var tried []pmux.Proxy
+	pool.client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		proxy := pmux.GetProxyFromContext(req.Context())
+		tried = append(tried, proxy)
+		header := http.Header{}
+		if proxy == captcha {
+			header.Set("X-Proxy-Blocked", "captcha")
+		}
+		return &http.Response{StatusCode: 200, Header: header}, nil
+	})
+	for i := 0; i < 5; i++ {
+		tried = nil
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		res, err := pool.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, good.String(), res.Header.Get("X-Proxy-Through"))
+		assert.Equal(t, good, tried[len(tried)-1])
+	}
+}
+
+func TestConfigureBlockRules(t *testing.T) {
+	pool := NewPool(history.NewHistory(), ipinfo.NoopIpInfo{}, &net.Dialer{})
+	err := pool.Configure(app.Config{"block_rules_file": "/nonexistent/blocks.yml"})
+	assert.ErrorContains(t, err, "block rules: ")
+
+	err = pool.Configure(app.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, "cloudflare-challenge", pool.blocks.rules[0].Name)
+}
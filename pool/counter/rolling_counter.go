@@ -46,6 +46,25 @@ func (r *RollingCounter) Add(what int32) {
 	r.sum += what
 }
 
+// Resize changes the number of intervals and keeps the most recent ones
+func (r *RollingCounter) Resize(window int16) {
+	if window <= 0 || window == r.window && len(r.buf) == int(window) {
+		return
+	}
+	buf := make([]int32, window)
+	var sum int32
+	// walk from the current interval back to the oldest one
+	for i := 0; i < len(r.buf) && i < int(window); i++ {
+		v := r.buf[(int(r.pos)-i+len(r.buf))%len(r.buf)]
+		buf[int(window)-1-i] = v
+		sum += v
+	}
+	r.buf = buf
+	r.sum = sum
+	r.window = window
+	r.pos = window - 1
+}
+
 func (r *RollingCounter) Increment() {
 	r.Add(1)
 }
@@ -52,3 +52,22 @@ func TestRollingCounter(t *testing.T) {
 		}
 	}
 }
+
+func TestRollingCounterResize(t *testing.T) {
+	rc := NewRollingCounter(5, time.Minute)
+	rc.buf = []int32{4, 5, 1, 2, 3}
+	rc.sum = 15
+	rc.pos = 1
+
+	rc.Resize(3)
+	assert.Equal(t, []int32{3, 4, 5}, rc.buf)
+	assert.Equal(t, 12, rc.Sum())
+	assert.Equal(t, int16(2), rc.pos)
+
+	rc.Resize(5)
+	assert.Equal(t, []int32{0, 0, 3, 4, 5}, rc.buf)
+	assert.Equal(t, 12, rc.Sum())
+
+	rc.Add(1)
+	assert.Equal(t, 13, rc.Sum())
+}
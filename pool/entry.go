@@ -38,8 +38,18 @@ type entry struct {
 
 	HourOffered [24]int
 	HourSucceed [24]int
+
+	// Pinned entries are never evicted from the pool
+	Pinned bool
+
+	LastOffered time.Time
+	// Latency is the moving average of successful request durations
+	Latency time.Duration
 }
 
+// weight of the latest observation in Latency
+const latencyAlpha = 0.3
+
 func newEntry(proxy pmux.Proxy, speed time.Duration, evictSpanMinutes int16) *entry {
 	now := now()
 	return &entry{
@@ -61,6 +71,14 @@ func newEntry(proxy pmux.Proxy, speed time.Duration, evictSpanMinutes int16) *en
 	}
 }
 
+// resizeShort adapts counters from the snapshot to the new evict_span_minutes
+func (e *entry) resizeShort(evictSpanMinutes int16) {
+	e.OfferShort.Resize(evictSpanMinutes)
+	e.SuccessShort.Resize(evictSpanMinutes)
+	e.TimeoutShort.Resize(evictSpanMinutes)
+	e.FailureShort.Resize(evictSpanMinutes)
+}
+
 func (e *entry) MarkSuccess() {
 	e.SuccessShort.Increment()
 	e.Success1D.Increment()
@@ -81,6 +99,15 @@ func (e *entry) MarkSuccess() {
 	e.ReanimateAfter = time.Time{}
 }
 
+// ObserveLatency updates exponentially weighted moving average of durations
+func (e *entry) ObserveLatency(took time.Duration) {
+	if e.Latency == 0 {
+		e.Latency = took
+		return
+	}
+	e.Latency = time.Duration(latencyAlpha*float64(took) + (1-latencyAlpha)*float64(e.Latency))
+}
+
 func (e *entry) MarkFailure(err error, shortTimeoutSleep time.Duration) {
 	t, ok := err.(interface {
 		Timeout() bool
@@ -140,16 +167,25 @@ func (e *entry) Eviction(evictThresholdTimeouts, evictThresholdFailures, evictTh
 		return false
 	}
 	if suceeded == 0 && failed > evictThresholdFailures {
-		e.Ok = false
-		return true
+		return e.evict(longTimeoutSleep)
 	}
 	if suceeded == 0 && e.Reanimated > evictThresholdReanimations && (timedOut > 0 || failed > 0) {
-		e.Ok = false
-		return true
+		return e.evict(longTimeoutSleep)
 	}
 	return false
 }
 
+// evict marks entry as not ok and tells if it has to be removed from the pool.
+// Pinned entries are not removed, but sleep for longer instead.
+func (e *entry) evict(longTimeoutSleep time.Duration) bool {
+	e.Ok = false
+	if e.Pinned {
+		e.ReanimateAfter = now().Add(longTimeoutSleep)
+		return false
+	}
+	return true
+}
+
 // TODO: bug in offering: plenty of 551 errors, even though they should have been limited.
 // perhaps we can do LastOffered and check it to be more than 3s (checker.Timeout) ago.
 func (e *entry) ConsiderSkip(ctx context.Context, offerLimit int) bool {
@@ -189,6 +225,7 @@ func (e *entry) ConsiderSkip(ctx context.Context, offerLimit int) bool {
 	e.Offered += 1
 	e.OfferShort.Increment()
 	e.Offer1D.Increment()
+	e.LastOffered = now
 	log.Trace().Int("new_offered", e.Offered).Msg("offered")
 	return false
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nfx/slrp/pmux"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -128,3 +129,27 @@ func TestConsiderSkip_Reanimate(t *testing.T) {
 	assert.Equal(t, 1, e.Reanimated)
 	assert.Equal(t, time.Time{}, e.ReanimateAfter)
 }
+
+func TestEntryEviction_Pinned(t *testing.T) {
+	now = func() time.Time {
+		return ti(0, 2, 0)
+	}
+	failing := func(pinned bool) *entry {
+		e := newEntry(pmux.HttpProxy("127.0.0.1:1"), time.Second, 5)
+		e.Pinned = pinned
+		for i := 0; i < 4; i++ {
+			e.OfferShort.Increment()
+			e.FailureShort.Increment()
+		}
+		return e
+	}
+
+	e := failing(false)
+	assert.True(t, e.Eviction(3, 3, 10, 1*time.Hour))
+	assert.False(t, e.Ok)
+
+	e = failing(true)
+	assert.False(t, e.Eviction(3, 3, 10, 1*time.Hour))
+	assert.False(t, e.Ok)
+	assert.Equal(t, ti(1, 2, 0), e.ReanimateAfter)
+}
@@ -0,0 +1,238 @@
+package pool
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/ql/eval"
+)
+
+// exportFormat writes proxies with their credentials, as other software has to
+// connect through them
+type exportFormat struct {
+	contentType string
+	extension   string
+	write       func(w io.Writer, entries []ApiEntry) error
+}
+
+var exportFormats = map[string]exportFormat{
+	"txt":         {"text/plain", "txt", exportText},
+	"csv":         {"text/csv", "csv", exportCSV},
+	"json":        {"application/json", "json", exportJSON},
+	"clash":       {"application/yaml", "yaml", exportClash},
+	"proxychains": {"text/plain", "conf", exportProxychains},
+}
+
+// ExportFormats are the formats, that proxies can be exported in
+var ExportFormats = []string{"txt", "csv", "json", "clash", "proxychains"}
+
+// Export writes all proxies, that match the filter, in one of ExportFormats.
+// Working proxies are exported, if the filter is empty. Proxies with
+// credentials are written only if secrets are allowed, as formats of other
+// software have no way to mask passwords.
+func (d ApiEntryDataset) Export(w io.Writer, format, filter string, secrets bool) error {
+	f, entries, err := d.exported(format, filter, secrets)
+	if err != nil {
+		return err
+	}
+	return f.write(w, entries)
+}
+
+// exported returns the format and proxies, so that errors are known before
+// anything is written
+func (d ApiEntryDataset) exported(format, filter string, secrets bool) (exportFormat, []ApiEntry, error) {
+	f, ok := exportFormats[format]
+	if !ok {
+		return f, nil, fmt.Errorf("unknown format: %s", format)
+	}
+	if filter == "" {
+		filter = "Ok"
+	}
+	filter, err := eval.Unlimited(filter, len(d))
+	if err != nil {
+		return f, nil, err
+	}
+	res, err := d.Query(filter)
+	if err != nil {
+		return f, nil, err
+	}
+	if secrets {
+		return f, res.Records, nil
+	}
+	entries := res.Records[:0]
+	for _, v := range res.Records {
+		if v.Proxy.HasAuth() {
+			continue
+		}
+		entries = append(entries, v)
+	}
+	return f, entries, nil
+}
+
+// export serves /api/pool/export and streams proxies to the client. Proxies
+// with credentials are exported only for admin role.
+func (pool *Pool) export(r *http.Request) (any, error) {
+	format := r.FormValue("format")
+	if format == "" {
+		format = "txt"
+	}
+	f, entries, err := pool.apiEntries().exported(format, r.FormValue("filter"), app.IsAdmin(r))
+	if err != nil {
+		return nil, err
+	}
+	return app.Stream{
+		ContentType: f.contentType,
+		Filename:    "slrp-proxies." + f.extension,
+		Write: func(w io.Writer) error {
+			return f.write(w, entries)
+		},
+	}, nil
+}
+
+// exportedURL has credentials of the proxy, unlike its String()
+func exportedURL(proxy pmux.Proxy) string {
+	return proxy.URL().String()
+}
+
+// exportText writes one proxy URL per line
+func exportText(w io.Writer, entries []ApiEntry) error {
+	for _, v := range entries {
+		_, err := fmt.Fprintln(w, exportedURL(v.Proxy))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportCSV(w io.Writer, entries []ApiEntry) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"Proxy", "Ok", "Country", "Provider", "ASN", "Speed", "Latency",
+		"Offered", "Succeed", "Timeouts", "Pinned", "FirstSeen", "LastSeen",
+	})
+	for _, v := range entries {
+		out.Write([]string{
+			exportedURL(v.Proxy),
+			strconv.FormatBool(v.Ok),
+			v.Country,
+			v.Provider,
+			strconv.Itoa(int(v.ASN)),
+			v.Speed.String(),
+			v.Latency.String(),
+			strconv.Itoa(v.Offered),
+			strconv.Itoa(v.Succeed),
+			strconv.Itoa(v.Timeouts),
+			strconv.FormatBool(v.Pinned),
+			time.Unix(v.FirstSeen, 0).UTC().Format(time.RFC3339),
+			time.Unix(v.LastSeen, 0).UTC().Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// exportedEntry replaces masked proxy of the entry in JSON
+type exportedEntry struct {
+	Proxy string
+	ApiEntry
+}
+
+// exportJSON writes an array of entries one by one
+func exportJSON(w io.Writer, entries []ApiEntry) error {
+	_, err := io.WriteString(w, "[")
+	if err != nil {
+		return err
+	}
+	for i, v := range entries {
+		if i > 0 {
+			_, err = io.WriteString(w, ",")
+			if err != nil {
+				return err
+			}
+		}
+		raw, err := json.Marshal(exportedEntry{exportedURL(v.Proxy), v})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// exportClash writes proxies section of Clash configuration. Clash doesn't
+// support SOCKS4, and HTTPS proxies are HTTP proxies, that are reached over TLS.
+func exportClash(w io.Writer, entries []ApiEntry) error {
+	_, err := fmt.Fprintln(w, "proxies:")
+	if err != nil {
+		return err
+	}
+	for _, v := range entries {
+		kind := "http"
+		switch v.Proxy.Proto() {
+		case pmux.SOCKS4:
+			continue
+		case pmux.SOCKS5:
+			kind = "socks5"
+		}
+		name := strings.TrimSpace(fmt.Sprintf("%s %s", v.Country, v.Proxy.Address()))
+		_, err = fmt.Fprintf(w, "  - name: %q\n    type: %s\n    server: %q\n    port: %d\n",
+			name, kind, v.Proxy.Addr(), v.Proxy.Port())
+		if err != nil {
+			return err
+		}
+		if v.Proxy.Proto() == pmux.HTTPS {
+			_, err = fmt.Fprintln(w, "    tls: true")
+			if err != nil {
+				return err
+			}
+		}
+		user := v.Proxy.User()
+		if user == nil {
+			continue
+		}
+		password, _ := user.Password()
+		_, err = fmt.Fprintf(w, "    username: %q\n    password: %q\n", user.Username(), password)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportProxychains writes ProxyList section of proxychains configuration.
+// HTTPS proxies are skipped, as proxychains can't reach proxies over TLS.
+func exportProxychains(w io.Writer, entries []ApiEntry) error {
+	_, err := fmt.Fprintln(w, "[ProxyList]")
+	if err != nil {
+		return err
+	}
+	for _, v := range entries {
+		if v.Proxy.Proto() == pmux.HTTPS {
+			continue
+		}
+		line := fmt.Sprintf("%s %s %d", v.Proxy.Scheme(), v.Proxy.Addr(), v.Proxy.Port())
+		user := v.Proxy.User()
+		if user != nil {
+			password, _ := user.Password()
+			line = fmt.Sprintf("%s %s %s", line, user.Username(), password)
+		}
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
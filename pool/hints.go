@@ -0,0 +1,105 @@
+package pool
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/ipinfo"
+)
+
+// hintHeaders are set by clients of the MITM proxy to restrict proxies,
+// that are picked for their requests. They never reach the destination.
+var hintHeaders = []string{
+	"X-Proxy-Country",
+	"X-Proxy-Protocol",
+	"X-Proxy-Max-Speed",
+	"X-Proxy-ASN",
+	"X-Proxy-Filter",
+}
+
+// parseHints removes routing hints from headers and returns them as a single
+// query over pool entries, so that it's also understood by /api/pool
+func parseHints(h http.Header) (string, error) {
+	var conditions []string
+	for _, k := range hintHeaders {
+		v := strings.TrimSpace(h.Get(k))
+		h.Del(k)
+		if v == "" {
+			continue
+		}
+		switch k {
+		case "X-Proxy-Country":
+			conditions = append(conditions, "Country = "+strconv.Quote(strings.ToUpper(v)))
+		case "X-Proxy-Protocol":
+			proto := strings.ToLower(v)
+			switch proto {
+			case "http", "https", "socks4", "socks5":
+			default:
+				return "", fmt.Errorf("%s: unknown protocol: %s", k, v)
+			}
+			conditions = append(conditions, "Proxy ~ "+strconv.Quote(proto+"://"))
+		case "X-Proxy-Max-Speed":
+			speed, err := time.ParseDuration(v)
+			if err != nil || speed <= 0 {
+				return "", fmt.Errorf("%s: invalid duration: %s", k, v)
+			}
+			conditions = append(conditions, fmt.Sprintf("Speed < %d", speed))
+		case "X-Proxy-ASN":
+			asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(v), "AS"), 10, 16)
+			if err != nil {
+				return "", fmt.Errorf("%s: invalid number: %s", k, v)
+			}
+			conditions = append(conditions, fmt.Sprintf("ASN = %d", asn))
+		case "X-Proxy-Filter":
+			// filter is checked on its own, so that it can't escape parentheses
+			_, err := ApiEntryDataset{}.Dataset().Predicate(v)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", k, err)
+			}
+			conditions = append(conditions, "("+v+")")
+		}
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// hint matches entries against routing hints one by one, so that only the
+// entries, that a shard walks through, are looked up. Requests visit shards
+// one at a time, so the hint is never used concurrently.
+type hint struct {
+	record   ApiEntryDataset
+	match    func(int) (bool, error)
+	ipLookup ipinfo.IpInfoGetter
+}
+
+func (pool *Pool) newHint(hints string) (*hint, error) {
+	record := make(ApiEntryDataset, 1)
+	match, err := record.Dataset().Predicate(hints)
+	if err != nil {
+		return nil, err
+	}
+	return &hint{
+		record:   record,
+		match:    match,
+		ipLookup: pool.ipLookup,
+	}, nil
+}
+
+func (h *hint) allows(e *entry) bool {
+	h.record[0] = newApiEntry(e, h.ipLookup)
+	ok, err := h.match(0)
+	return err == nil && ok
+}
+
+func invalidHints(req *http.Request, err error) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Status:     "Invalid Proxy Hints",
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(err.Error())),
+		Request:    req,
+	}
+}
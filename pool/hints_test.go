@@ -0,0 +1,159 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHints(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Proxy-Country", "de")
+	h.Set("X-Proxy-Protocol", "SOCKS5")
+	h.Set("X-Proxy-Max-Speed", "2s")
+	h.Set("X-Proxy-ASN", "AS3320")
+	h.Set("X-Proxy-Filter", "Offered > 1 OR Pinned")
+	h.Set("Accept", "*/*")
+
+	hints, err := parseHints(h)
+	require.NoError(t, err)
+	assert.Equal(t, `Country = "DE" AND Proxy ~ "socks5://" AND `+
+		`Speed < 2000000000 AND ASN = 3320 AND (Offered > 1 OR Pinned)`, hints)
+	assert.Equal(t, http.Header{"Accept": {"*/*"}}, h)
+
+	hints, err = parseHints(http.Header{})
+	require.NoError(t, err)
+	assert.Equal(t, "", hints)
+
+	for k, v := range map[string]string{
+		"X-Proxy-Protocol":  "gopher",
+		"X-Proxy-Max-Speed": "fast",
+		"X-Proxy-ASN":       "AS99999999",
+		"X-Proxy-Filter":    "Pinned LIMIT 1",
+	} {
+		h := http.Header{}
+		h.Set(k, v)
+		_, err = parseHints(h)
+		assert.Error(t, err, k)
+	}
+}
+
+type clientFunc func(req *http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRoundTripHints(t *testing.T) {
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), ipinfo.NoopIpInfo{
+		Country: "ZW",
+	}, &net.Dialer{}))
+	defer runtime.Stop()
+
+	ctx := context.Background()
+	fast := pmux.HttpProxy("127.0.0.1:1")
+	slow := pmux.Socks5Proxy("127.0.0.1:2")
+	pool.Add(ctx, fast, 1*time.Second)
+	pool.Add(ctx, slow, 5*time.Second)
+
+	var through pmux.Proxy
+	pool.client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		through = pmux.GetProxyFromContext(req.Context())
+		assert.Equal(t, "", req.Header.Get("X-Proxy-Protocol"))
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+		}, nil
+	})
+
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("X-Proxy-Protocol", "socks5")
+		req.Header.Set("X-Proxy-Country", "zw")
+		res, err := pool.RoundTrip(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, slow, through)
+		assert.Equal(t, `Country = "ZW" AND Proxy ~ "socks5://"`, req.Header.Get("X-Proxy-Hints"))
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Max-Speed", "2s")
+	res, err := pool.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, fast, through)
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Filter", `NOT Proxy ~ "socks"`)
+	res, err = pool.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, fast, through)
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Country", "DE")
+	res, err = pool.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, 552, res.StatusCode)
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Filter", "Pinned) OR (Ok")
+	res, err = pool.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Filter", "Speed <")
+	res, err = pool.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.NotEmpty(t, body)
+}
+
+type countingIpInfo struct {
+	lookups atomic.Int32
+}
+
+func (c *countingIpInfo) Get(pmux.Proxy) ipinfo.Info {
+	c.lookups.Add(1)
+	return ipinfo.Info{Country: "ZW"}
+}
+
+func TestHintsMatchWalkedEntries(t *testing.T) {
+	lookup := &countingIpInfo{}
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), lookup, &net.Dialer{}))
+	defer runtime.Stop()
+	ctx := context.Background()
+	for i := 1; i <= 20; i++ {
+		pool.Add(ctx, pmux.HttpProxy(fmt.Sprintf("127.0.0.1:%d", i)), time.Second)
+	}
+	pool.client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+		}, nil
+	})
+	lookup.lookups.Store(0)
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Country", "ZW")
+	res, err := pool.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	// the first proxy, that the shard offers, matches
+	assert.Equal(t, int32(1), lookup.lookups.Load())
+}
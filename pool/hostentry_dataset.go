@@ -0,0 +1,143 @@
+// Code generated by go run github.com/nfx/slrp/ql/generator/main.go Foo. DO NOT EDIT.
+package pool
+
+import (
+	"github.com/nfx/slrp/ql/eval"
+)
+
+type HostEntryDataset []HostEntry
+
+func (d HostEntryDataset) Query(query string) (*eval.QueryResult[HostEntry], error) {
+	return d.Dataset().Query(query)
+}
+
+func (d HostEntryDataset) Dataset() *eval.Dataset[HostEntry, HostEntryDataset] {
+	return &eval.Dataset[HostEntry, HostEntryDataset]{
+		Source: d,
+		Accessors: eval.Accessors{
+			"Proxy":       eval.StringGetter{Name: "Proxy", Func: d.getProxy},
+			"Host":        eval.StringGetter{Name: "Host", Func: d.getHost},
+			"Succeed":     eval.NumberGetter{Name: "Succeed", Func: d.getSucceed},
+			"Failed":      eval.NumberGetter{Name: "Failed", Func: d.getFailed},
+			"Latency":     eval.NumberGetter{Name: "Latency", Func: d.getLatency},
+			"LastSuccess": eval.NumberGetter{Name: "LastSuccess", Func: d.getLastSuccess},
+			"LastFailure": eval.NumberGetter{Name: "LastFailure", Func: d.getLastFailure},
+			"Blocked":     eval.BooleanGetter{Name: "Blocked", Func: d.getBlocked},
+		},
+		Sorters: eval.Sorters[HostEntry]{
+			"Proxy":       {Asc: d.sortAscProxy, Desc: d.sortDescProxy},
+			"Host":        {Asc: d.sortAscHost, Desc: d.sortDescHost},
+			"Succeed":     {Asc: d.sortAscSucceed, Desc: d.sortDescSucceed},
+			"Failed":      {Asc: d.sortAscFailed, Desc: d.sortDescFailed},
+			"Latency":     {Asc: d.sortAscLatency, Desc: d.sortDescLatency},
+			"LastSuccess": {Asc: d.sortAscLastSuccess, Desc: d.sortDescLastSuccess, DescDefault: true},
+			"LastFailure": {Asc: d.sortAscLastFailure, Desc: d.sortDescLastFailure},
+			"Blocked":     {Asc: d.sortAscBlocked, Desc: d.sortDescBlocked},
+		},
+		Facets: func(filtered HostEntryDataset, topN int) []eval.Facet {
+			return eval.FacetRetrievers[HostEntry]{
+				eval.StringFacet{
+					Getter: filtered.getHost,
+					Field:  "Host",
+					Name:   "Host",
+				},
+			}.Facets(filtered, topN)
+		},
+	}
+}
+
+func (d HostEntryDataset) getProxy(record int) string {
+	return d[record].Proxy.String()
+}
+
+func (_ HostEntryDataset) sortAscProxy(left, right HostEntry) bool {
+	return left.Proxy.String() < right.Proxy.String()
+}
+
+func (_ HostEntryDataset) sortDescProxy(left, right HostEntry) bool {
+	return left.Proxy.String() > right.Proxy.String()
+}
+
+func (d HostEntryDataset) getHost(record int) string {
+	return d[record].Host
+}
+
+func (_ HostEntryDataset) sortAscHost(left, right HostEntry) bool {
+	return left.Host < right.Host
+}
+
+func (_ HostEntryDataset) sortDescHost(left, right HostEntry) bool {
+	return left.Host > right.Host
+}
+
+func (d HostEntryDataset) getSucceed(record int) float64 {
+	return float64(d[record].Succeed)
+}
+
+func (_ HostEntryDataset) sortAscSucceed(left, right HostEntry) bool {
+	return left.Succeed < right.Succeed
+}
+
+func (_ HostEntryDataset) sortDescSucceed(left, right HostEntry) bool {
+	return left.Succeed > right.Succeed
+}
+
+func (d HostEntryDataset) getFailed(record int) float64 {
+	return float64(d[record].Failed)
+}
+
+func (_ HostEntryDataset) sortAscFailed(left, right HostEntry) bool {
+	return left.Failed < right.Failed
+}
+
+func (_ HostEntryDataset) sortDescFailed(left, right HostEntry) bool {
+	return left.Failed > right.Failed
+}
+
+func (d HostEntryDataset) getLatency(record int) float64 {
+	return float64(d[record].Latency)
+}
+
+func (_ HostEntryDataset) sortAscLatency(left, right HostEntry) bool {
+	return left.Latency < right.Latency
+}
+
+func (_ HostEntryDataset) sortDescLatency(left, right HostEntry) bool {
+	return left.Latency > right.Latency
+}
+
+func (d HostEntryDataset) getLastSuccess(record int) float64 {
+	return float64(d[record].LastSuccess.Unix())
+}
+
+func (_ HostEntryDataset) sortAscLastSuccess(left, right HostEntry) bool {
+	return left.LastSuccess.Unix() < right.LastSuccess.Unix()
+}
+
+func (_ HostEntryDataset) sortDescLastSuccess(left, right HostEntry) bool {
+	return left.LastSuccess.Unix() > right.LastSuccess.Unix()
+}
+
+func (d HostEntryDataset) getLastFailure(record int) float64 {
+	return float64(d[record].LastFailure.Unix())
+}
+
+func (_ HostEntryDataset) sortAscLastFailure(left, right HostEntry) bool {
+	return left.LastFailure.Unix() < right.LastFailure.Unix()
+}
+
+func (_ HostEntryDataset) sortDescLastFailure(left, right HostEntry) bool {
+	return left.LastFailure.Unix() > right.LastFailure.Unix()
+}
+
+func (d HostEntryDataset) getBlocked(record int) bool {
+	return d[record].Blocked
+}
+
+func (_ HostEntryDataset) sortAscBlocked(left, right HostEntry) bool {
+	return left.Blocked == right.Blocked
+}
+
+func (_ HostEntryDataset) sortDescBlocked(left, right HostEntry) bool {
+	return left.Blocked != right.Blocked
+}
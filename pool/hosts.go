@@ -0,0 +1,212 @@
+package pool
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+type hostKey struct {
+	proxy pmux.Proxy
+	host  string
+}
+
+type hostStat struct {
+	key         hostKey
+	Succeed     int
+	Failed      int
+	Latency     time.Duration
+	LastSuccess time.Time
+	LastFailure time.Time
+}
+
+// blocked tells if the last request to the host failed within blockTime
+func (s *hostStat) blocked(blockTime time.Duration) bool {
+	if s.LastFailure.Before(s.LastSuccess) {
+		return false
+	}
+	return now().Sub(s.LastFailure) < blockTime
+}
+
+// hostScores keeps success, failure and latency of (proxy, destination host)
+// pairs within a shard. Memory is bounded by evicting the least recently
+// updated pairs.
+type hostScores struct {
+	limit int
+	items map[hostKey]*list.Element
+	// byHost indexes stats of proxies, that were used for the host
+	byHost map[string]map[pmux.Proxy]*hostStat
+	lru    *list.List
+}
+
+func newHostScores(limit int) *hostScores {
+	return &hostScores{
+		limit:  limit,
+		items:  map[hostKey]*list.Element{},
+		byHost: map[string]map[pmux.Proxy]*hostStat{},
+		lru:    list.New(),
+	}
+}
+
+// requestHost returns lowercase hostname of the destination
+func requestHost(r *http.Request) string {
+	if r == nil || r.URL == nil {
+		return ""
+	}
+	return strings.ToLower(r.URL.Hostname())
+}
+
+func (h *hostScores) get(proxy pmux.Proxy, host string) *hostStat {
+	elem, ok := h.items[hostKey{proxy, host}]
+	if !ok {
+		return nil
+	}
+	return elem.Value.(*hostStat)
+}
+
+func (h *hostScores) record(proxy pmux.Proxy, host string, err error, took time.Duration) {
+	if host == "" || h.limit <= 0 {
+		return
+	}
+	key := hostKey{proxy, host}
+	elem, ok := h.items[key]
+	if ok {
+		h.lru.MoveToFront(elem)
+	} else {
+		s := &hostStat{key: key}
+		elem = h.lru.PushFront(s)
+		h.items[key] = elem
+		if h.byHost[host] == nil {
+			h.byHost[host] = map[pmux.Proxy]*hostStat{}
+		}
+		h.byHost[host][proxy] = s
+	}
+	for h.lru.Len() > h.limit {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		h.forget(oldest.Value.(*hostStat).key)
+	}
+	s := elem.Value.(*hostStat)
+	if err != nil {
+		s.Failed++
+		s.LastFailure = now()
+		return
+	}
+	s.Succeed++
+	s.LastSuccess = now()
+	if s.Latency == 0 {
+		s.Latency = took
+		return
+	}
+	s.Latency = time.Duration(latencyAlpha*float64(took) + (1-latencyAlpha)*float64(s.Latency))
+}
+
+func (h *hostScores) forget(key hostKey) {
+	delete(h.items, key)
+	proxies := h.byHost[key.host]
+	delete(proxies, key.proxy)
+	if len(proxies) == 0 {
+		delete(h.byHost, key.host)
+	}
+}
+
+// groups of proxies for the destination host, in the order they are offered
+const (
+	hostSucceeded = iota
+	hostUnknown
+	hostBlocked
+	hostGroups
+)
+
+// prefer walks the order, so that proxies, that previously succeeded for the
+// host, go first and the ones recently blocked there go last. Order within
+// every group is kept as is. Only the scores of the host are looked at, so
+// that the order is walked just once for hosts without history.
+func (h *hostScores) prefer(order cursor, entries []*entry, host string, blockTime time.Duration) hostOrder {
+	res := hostOrder{
+		order:     order,
+		walk:      order,
+		entries:   entries,
+		stats:     h.byHost[host],
+		blockTime: blockTime,
+	}
+	res.groups[hostUnknown] = true
+	for _, s := range res.stats {
+		res.groups[res.groupOf(s)] = true
+	}
+	return res
+}
+
+// hostOrder walks the order of the strategy once for every group of proxies
+type hostOrder struct {
+	order     cursor
+	walk      cursor
+	entries   []*entry
+	stats     map[pmux.Proxy]*hostStat
+	blockTime time.Duration
+	groups    [hostGroups]bool
+	group     int
+}
+
+func (o *hostOrder) groupOf(s *hostStat) int {
+	switch {
+	case s == nil:
+		return hostUnknown
+	case s.blocked(o.blockTime):
+		return hostBlocked
+	case s.Succeed > 0:
+		return hostSucceeded
+	default:
+		return hostUnknown
+	}
+}
+
+func (o *hostOrder) next() (int, bool) {
+	for o.group < hostGroups {
+		if o.groups[o.group] {
+			for idx, ok := o.walk.next(); ok; idx, ok = o.walk.next() {
+				if len(o.stats) == 0 {
+					return idx, true
+				}
+				if o.groupOf(o.stats[o.entries[idx].Proxy]) == o.group {
+					return idx, true
+				}
+			}
+		}
+		o.group++
+		o.walk = o.order
+	}
+	return 0, false
+}
+
+func (h *hostScores) snapshot(blockTime time.Duration) (res []HostEntry) {
+	for elem := h.lru.Front(); elem != nil; elem = elem.Next() {
+		s := elem.Value.(*hostStat)
+		res = append(res, HostEntry{
+			Proxy:       s.key.proxy,
+			Host:        s.key.host,
+			Succeed:     s.Succeed,
+			Failed:      s.Failed,
+			Latency:     s.Latency,
+			LastSuccess: s.LastSuccess,
+			LastFailure: s.LastFailure,
+			Blocked:     s.blocked(blockTime),
+		})
+	}
+	return res
+}
+
+//go:generate go run ../ql/generator/main.go HostEntry
+type HostEntry struct {
+	Proxy       pmux.Proxy
+	Host        string `facet:"Host"`
+	Succeed     int
+	Failed      int
+	Latency     time.Duration
+	LastSuccess time.Time
+	LastFailure time.Time
+	Blocked     bool
+}
@@ -0,0 +1,169 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/ql/eval"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostScoresBounded(t *testing.T) {
+	h := newHostScores(2)
+	a := pmux.HttpProxy("127.0.0.1:1")
+	h.record(a, "a.com", nil, time.Second)
+	h.record(a, "b.com", nil, time.Second)
+	h.record(a, "a.com", nil, 2*time.Second)
+	h.record(a, "c.com", nil, time.Second)
+
+	assert.Len(t, h.items, 2)
+	assert.Nil(t, h.get(a, "b.com"))
+	s := h.get(a, "a.com")
+	require.NotNil(t, s)
+	assert.Equal(t, 2, s.Succeed)
+	assert.Equal(t, 1300*time.Millisecond, s.Latency)
+
+	h.record(a, "", nil, time.Second)
+	assert.Len(t, h.items, 2)
+}
+
+func preferred(h *hostScores, entries []*entry, host string) (res []int) {
+	order := h.prefer(rotation(0, len(entries)), entries, host, time.Minute)
+	for idx, ok := order.next(); ok; idx, ok = order.next() {
+		res = append(res, idx)
+	}
+	return res
+}
+
+func TestHostScoresPrefer(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	now = func() time.Time {
+		return ti(0, 0, 0)
+	}
+	entries := []*entry{
+		{Proxy: pmux.HttpProxy("127.0.0.1:1")},
+		{Proxy: pmux.HttpProxy("127.0.0.1:2")},
+		{Proxy: pmux.HttpProxy("127.0.0.1:3")},
+		{Proxy: pmux.HttpProxy("127.0.0.1:4")},
+	}
+	h := newHostScores(100)
+	assert.Equal(t, []int{0, 1, 2, 3}, preferred(h, entries, "a.com"))
+
+	h.record(entries[0].Proxy, "a.com", fmt.Errorf("blocked"), 0)
+	h.record(entries[2].Proxy, "a.com", nil, time.Second)
+	h.record(entries[3].Proxy, "b.com", nil, time.Second)
+	assert.Equal(t, []int{2, 1, 3, 0}, preferred(h, entries, "a.com"))
+	assert.Equal(t, []int{3, 0, 1, 2}, preferred(h, entries, "b.com"))
+
+	now = func() time.Time {
+		return ti(0, 2, 0)
+	}
+	// block is over
+	assert.Equal(t, []int{2, 0, 1, 3}, preferred(h, entries, "a.com"))
+
+	h.record(entries[2].Proxy, "a.com", fmt.Errorf("blocked"), 0)
+	assert.Equal(t, []int{0, 1, 3, 2}, preferred(h, entries, "a.com"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		order := h.prefer(rotation(1, len(entries)), entries, "a.com", time.Minute)
+		for _, ok := order.next(); ok; _, ok = order.next() {
+		}
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestHostScoresIndex(t *testing.T) {
+	h := newHostScores(2)
+	a := pmux.HttpProxy("127.0.0.1:1")
+	b := pmux.HttpProxy("127.0.0.1:2")
+	h.record(a, "a.com", nil, time.Second)
+	h.record(b, "a.com", nil, time.Second)
+	assert.Len(t, h.byHost["a.com"], 2)
+
+	h.record(a, "b.com", nil, time.Second)
+	assert.Len(t, h.byHost["a.com"], 1)
+	assert.NotNil(t, h.byHost["a.com"][b])
+
+	h.record(b, "b.com", nil, time.Second)
+	assert.NotContains(t, h.byHost, "a.com")
+	assert.Len(t, h.byHost["b.com"], 2)
+}
+
+func TestRoundTripHostScores(t *testing.T) {
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), ipinfo.NoopIpInfo{}, &net.Dialer{}))
+	defer runtime.Stop()
+	pool.config.hostScoresLimit = 100
+	for i := range pool.shards {
+		pool.shards[i].hosts = newHostScores(100)
+	}
+
+	ctx := context.Background()
+	banned := pmux.HttpProxy("127.0.0.1:1")
+	good := pmux.HttpProxy("127.0.0.1:2")
+	pool.Add(ctx, banned, time.Second)
+	pool.Add(ctx, good, time.Second)
+
+	var through pmux.Proxy
+	pool.client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		through = pmux.GetProxyFromContext(req.Context())
+		if through == banned && req.URL.Host == "banned.example.com" {
+			return &http.Response{
+				StatusCode: 403,
+				Status:     "403 Forbidden",
+				Header:     http.Header{},
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+		}, nil
+	})
+	req, _ := http.NewRequest("GET", "http://banned.example.com/", nil)
+	req.Header.Set("X-Proxy-Filter", `Proxy = "http://127.0.0.1:1"`)
+	res, err := pool.RoundTrip(req)
+	require.NoError(t, err)
+	// the only allowed proxy failed and there's nothing else to retry with
+	assert.Equal(t, 552, res.StatusCode)
+	// banned proxy is still fine for other hosts
+	pool.shards[0].reanimate <- true
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", "http://banned.example.com/", nil)
+		res, err := pool.RoundTrip(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, good, through)
+	}
+
+	out, err := pool.HttpGetByID("hosts", &http.Request{URL: &url.URL{
+		RawQuery: url.Values{"filter": {`Host = "banned.example.com" ORDER BY Succeed DESC`}}.Encode(),
+	}})
+	require.NoError(t, err)
+	hosts := out.(*eval.QueryResult[HostEntry])
+	require.Len(t, hosts.Records, 2)
+	assert.Equal(t, good, hosts.Records[0].Proxy)
+	assert.Equal(t, 10, hosts.Records[0].Succeed)
+	assert.Equal(t, banned, hosts.Records[1].Proxy)
+	assert.Equal(t, 0, hosts.Records[1].Succeed)
+	assert.True(t, hosts.Records[1].Blocked)
+
+	out, err = pool.HttpGetByID("hosts", &http.Request{URL: &url.URL{}})
+	require.NoError(t, err)
+	hosts = out.(*eval.QueryResult[HostEntry])
+	assert.Len(t, hosts.Records, 2)
+
+	_, err = pool.HttpGetByID("nope", &http.Request{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package pool
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/pool/counter"
+)
+
+// legacyEntry mirrors the entry, as it was persisted before IPv6 support,
+// when proxies were packed into uint64
+type legacyEntry struct {
+	Proxy          uint64
+	FirstSeen      int64
+	LastSeen       int64
+	ReanimateAfter time.Time
+	Ok             bool
+	Speed          time.Duration
+	Timeouts       int
+	Failures       int
+	Offered        int
+	Reanimated     int
+	Succeed        int
+
+	OfferShort   counter.RollingCounter
+	SuccessShort counter.RollingCounter
+	TimeoutShort counter.RollingCounter
+	FailureShort counter.RollingCounter
+
+	Offer1D   counter.RollingCounter
+	Success1D counter.RollingCounter
+	Timeout1D counter.RollingCounter
+	Failure1D counter.RollingCounter
+
+	HourOffered [24]int
+	HourSucceed [24]int
+}
+
+func (le *legacyEntry) entry() *entry {
+	return &entry{
+		Proxy:          pmux.LegacyProxy(le.Proxy),
+		FirstSeen:      le.FirstSeen,
+		LastSeen:       le.LastSeen,
+		ReanimateAfter: le.ReanimateAfter,
+		Ok:             le.Ok,
+		Speed:          le.Speed,
+		Timeouts:       le.Timeouts,
+		Failures:       le.Failures,
+		Offered:        le.Offered,
+		Reanimated:     le.Reanimated,
+		Succeed:        le.Succeed,
+		OfferShort:     le.OfferShort,
+		SuccessShort:   le.SuccessShort,
+		TimeoutShort:   le.TimeoutShort,
+		FailureShort:   le.FailureShort,
+		Offer1D:        le.Offer1D,
+		Success1D:      le.Success1D,
+		Timeout1D:      le.Timeout1D,
+		Failure1D:      le.Failure1D,
+		HourOffered:    le.HourOffered,
+		HourSucceed:    le.HourSucceed,
+	}
+}
+
+func decodeLegacySnapshot(data []byte) ([]*entry, error) {
+	var legacy []*legacyEntry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make([]*entry, len(legacy))
+	for i, v := range legacy {
+		snapshot[i] = v.entry()
+	}
+	return snapshot, nil
+}
+
+// poolStateVersion is incremented on every change of the persisted layout:
+//
+//	0 - list of entries, optionally with proxies packed into uint64
+//	1 - entries along with evict_span_minutes, that sized their counters
+const poolStateVersion = 1
+
+type poolState struct {
+	EvictSpanMinutes int
+	Entries          []*entry
+}
+
+func (pool *Pool) StateVersion() uint32 {
+	return poolStateVersion
+}
+
+// MigrateState converts snapshots of previous versions into the current one
+func (pool *Pool) MigrateState(from uint32, data []byte) ([]byte, error) {
+	return migrateState(from, data)
+}
+
+func migrateState(from uint32, data []byte) ([]byte, error) {
+	if from != 0 {
+		return nil, fmt.Errorf("unknown pool state version: %d", from)
+	}
+	var snapshot []*entry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot)
+	if err != nil {
+		// state may still be in the format before IPv6 support
+		var legacyErr error
+		snapshot, legacyErr = decodeLegacySnapshot(data)
+		if legacyErr != nil {
+			return nil, err
+		}
+	}
+	var b bytes.Buffer
+	// span of counters is unknown, so that they are resized on load
+	err = gob.NewEncoder(&b).Encode(poolState{
+		Entries: snapshot,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
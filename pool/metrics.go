@@ -0,0 +1,78 @@
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nfx/slrp/app"
+)
+
+// poolCounters are updated by workers and request goroutines, so they are
+// safe for concurrent use and don't go through the shard channels
+type poolCounters struct {
+	active    atomic.Int64
+	serial    atomic.Int64
+	mu        sync.Mutex
+	responses map[int]int
+}
+
+func (c *poolCounters) response(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.responses == nil {
+		c.responses = map[int]int{}
+	}
+	c.responses[status]++
+}
+
+func (c *poolCounters) statuses() (codes []int, counts map[int]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts = map[int]int{}
+	for k, v := range c.responses {
+		codes = append(codes, k)
+		counts[k] = v
+	}
+	sort.Ints(codes)
+	return codes, counts
+}
+
+type poolSize struct {
+	protocol string
+	country  string
+	ok       bool
+}
+
+func (pool *Pool) CollectMetrics(m *app.Metrics) {
+	sizes := map[poolSize]int{}
+	for _, v := range pool.apiEntries() {
+		sizes[poolSize{v.Proxy.Scheme(), v.Country, v.Ok}]++
+	}
+	keys := []poolSize{}
+	for k := range sizes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	for _, k := range keys {
+		m.Gauge("slrp_pool_proxies", "Number of proxies in the pool",
+			float64(sizes[k]),
+			"protocol", k.protocol,
+			"country", k.country,
+			"ok", fmt.Sprint(k.ok))
+	}
+	m.Gauge("slrp_pool_active_requests", "Number of workers forwarding requests right now",
+		float64(pool.counters.active.Load()))
+	m.Gauge("slrp_pool_workers", "Number of request workers", float64(cap(pool.work)))
+	m.Counter("slrp_pool_serials_total", "Number of serial numbers issued for forwarded requests",
+		float64(pool.counters.serial.Load()))
+	codes, counts := pool.counters.statuses()
+	for _, code := range codes {
+		m.Counter("slrp_pool_responses_total", "Number of forwarded requests by status code of the final attempt",
+			float64(counts[code]), "code", fmt.Sprint(code))
+	}
+	m.Gauge("slrp_pool_sessions", "Number of active sticky sessions", float64(len(pool.sessions.list())))
+}
@@ -0,0 +1,53 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectMetrics(t *testing.T) {
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), ipinfo.NoopIpInfo{
+		Country: "DE",
+	}, &net.Dialer{}))
+	defer runtime.Stop()
+
+	ctx := context.Background()
+	pool.Add(ctx, pmux.HttpProxy("127.0.0.1:1"), time.Second)
+	pool.Add(ctx, pmux.HttpProxy("127.0.0.1:2"), time.Second)
+	pool.Add(ctx, pmux.Socks5Proxy("127.0.0.1:3"), time.Second)
+
+	pool.client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Header: http.Header{}}, nil
+	})
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	_, err := pool.RoundTrip(req)
+	require.NoError(t, err)
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Proxy-Country", "US")
+	res, err := pool.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, 552, res.StatusCode)
+
+	m := app.NewMetrics()
+	pool.CollectMetrics(m)
+	var sb strings.Builder
+	m.WriteTo(&sb)
+	out := sb.String()
+	assert.Contains(t, out, `slrp_pool_proxies{protocol="http",country="DE",ok="true"} 2`)
+	assert.Contains(t, out, `slrp_pool_proxies{protocol="socks5",country="DE",ok="true"} 1`)
+	assert.Contains(t, out, `slrp_pool_serials_total 2`)
+	assert.Contains(t, out, `slrp_pool_responses_total{code="200"} 1`)
+	assert.Contains(t, out, `slrp_pool_responses_total{code="552"} 1`)
+	assert.Contains(t, out, `slrp_pool_active_requests 0`)
+}
@@ -0,0 +1,34 @@
+package pool
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/nfx/slrp/ipinfo"
+)
+
+// Persisted is the state of the pool, as it is written to disk. It is read
+// by commands, that work without starting the application.
+type Persisted struct {
+	poolState
+}
+
+func (p *Persisted) StateVersion() uint32 {
+	return poolStateVersion
+}
+
+func (p *Persisted) MigrateState(from uint32, data []byte) ([]byte, error) {
+	return migrateState(from, data)
+}
+
+func (p *Persisted) UnmarshalBinary(data []byte) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(&p.poolState)
+}
+
+// Entries returns proxies in the same form, as /api/pool does
+func (p *Persisted) Entries(ipLookup ipinfo.IpInfoGetter) (tmp ApiEntryDataset) {
+	for _, v := range p.poolState.Entries {
+		tmp = append(tmp, newApiEntry(v, ipLookup))
+	}
+	return tmp
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/gob"
 	"fmt"
+	"math"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -16,6 +18,8 @@ import (
 	"github.com/nfx/slrp/ipinfo"
 	"github.com/nfx/slrp/pmux"
 
+	"github.com/rs/zerolog/log"
+
 	_ "github.com/bdandy/go-socks4"
 )
 
@@ -26,13 +30,21 @@ type Pool struct {
 	pressure        chan int
 	halt            chan time.Duration
 	client          httpClient
+	tunnel          http.RoundTripper
+	tunnelTimeout   time.Duration
 	shards          []shard
-	workerCancels   []context.CancelFunc
 	workerProgress  chan int
 	pendingEviction []pmux.Proxy // TODO: keep in state
 	eviction        chan chan []pmux.Proxy
 	minute          *time.Ticker
+	configMu        sync.RWMutex
 	config          *monitorConfig
+	upstream        []pmux.Proxy
+	sessions        *sessions
+	blocks          *blockDetector
+	counters        poolCounters
+	workers         app.Group
+	loops           app.Group
 }
 
 type httpClient interface {
@@ -44,6 +56,13 @@ type dialer interface {
 }
 
 func NewPool(history *history.History, ipLookup ipinfo.IpInfoGetter, dialer dialer) *Pool {
+	blocks := &blockDetector{
+		transport: &http.Transport{
+			DialContext:     dialer.DialContext,
+			Proxy:           pmux.ProxyFromContext,
+			TLSClientConfig: pmux.DefaultTlsConfig,
+		},
+	}
 	return &Pool{
 		ipLookup:       ipLookup,
 		serial:         make(chan int),
@@ -52,13 +71,13 @@ func NewPool(history *history.History, ipLookup ipinfo.IpInfoGetter, dialer dial
 		minute:         time.NewTicker(1 * time.Minute),
 		eviction:       make(chan chan []pmux.Proxy),
 		workerProgress: make(chan int),
+		shards:         newShards(1),
+		sessions:       newSessions(),
+		blocks:         blocks,
 		client: &http.Client{
-			Transport: history.Wrap(&http.Transport{
-				DialContext:     dialer.DialContext,
-				Proxy:           pmux.ProxyFromContext,
-				TLSClientConfig: pmux.DefaultTlsConfig,
-			}),
+			Transport: history.Wrap(blocks),
 		},
+		tunnel: history.Wrap(tunnelTransport{dialer}),
 	}
 }
 
@@ -71,58 +90,216 @@ type monitorConfig struct {
 	evictThresholdTimeouts     int           // 3
 	evictThresholdFailures     int           // 3
 	evictThresholdReanimations int           // 10
+	selection                  string        // random
+	hostScoresLimit            int           // 10000
+	hostBlockTime              time.Duration // 10m
+	readyMinProxies            int           // 1
+}
+
+// evict_span_minutes is a config, that is not compatible with previous state snapshot:
+// count circular buffers will become of a different size and would cause comparison
+// errors in certain edge cases. to prevent this, the config is stored along with the
+// snapshot and counters are resized on load and on reconfiguration.
+func newMonitorConfig(c app.Config, shards int) (*monitorConfig, error) {
+	config := &monitorConfig{
+		shards:                     shards,
+		offerLimit:                 c.IntOr("offer_limit", 25),
+		evictSpanMinutes:           c.IntOr("evict_span_minutes", 5),
+		shortTimeoutSleep:          c.DurOr("short_timeout_sleep", 1*time.Minute),
+		longTimeoutSleep:           c.DurOr("long_timeout_sleep", 1*time.Hour),
+		evictThresholdTimeouts:     c.IntOr("evict_threshold_timeouts", 3),
+		evictThresholdFailures:     c.IntOr("evict_threshold_failures", 3),
+		evictThresholdReanimations: c.IntOr("evict_threshold_reanimations", 10),
+		selection:                  c.StrOr("selection", defaultSelection),
+		hostScoresLimit:            c.IntOr("host_scores_limit", 10000),
+		hostBlockTime:              c.DurOr("host_block_time", 10*time.Minute),
+		readyMinProxies:            c.IntOr("ready_min_proxies", 1),
+	}
+	if config.evictSpanMinutes <= 0 || config.evictSpanMinutes > math.MaxInt16 {
+		return nil, fmt.Errorf("invalid evict_span_minutes: %d", config.evictSpanMinutes)
+	}
+	err := validSelection(config.selection)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 func (pool *Pool) Configure(c app.Config) error {
 	poolWorkSize := c.IntOr("request_workers", 512)
 	pool.work = make(chan work, poolWorkSize)
 
+	requestTimeout := c.DurOr("request_timeout", 10*time.Second)
 	if hc, ok := pool.client.(*http.Client); ok {
-		requestTimeout := c.DurOr("request_timeout", 10*time.Second)
 		hc.Timeout = requestTimeout
 	}
+	pool.tunnelTimeout = requestTimeout
 
 	// see https://github.com/nfx/slrp/issues/130
 	poolShards := c.IntOr("shards", 1) // 31
-	pool.shards = make([]shard, poolShards)
-
-	// evict_span_minutes is a config, that is not compatible with previous state snapshot:
-	// count circular buffers will become of a different size and would cause comparison
-	// errors in certain edge cases. to prevent this, we can store the config as data
-	// and alert early.
-	pool.config = &monitorConfig{
-		shards:                     poolShards,
-		offerLimit:                 c.IntOr("offer_limit", 25),
-		evictSpanMinutes:           c.IntOr("evict_span_minutes", 5),
-		shortTimeoutSleep:          c.DurOr("short_timeout_sleep", 1*time.Minute),
-		longTimeoutSleep:           c.DurOr("long_timeout_sleep", 1*time.Hour),
-		evictThresholdTimeouts:     c.IntOr("evict_threshold_timeouts", 3),
-		evictThresholdFailures:     c.IntOr("evict_threshold_failures", 3),
-		evictThresholdReanimations: c.IntOr("evict_threshold_reanimations", 10),
+	if poolShards != len(pool.shards) {
+		pool.shards = newShards(poolShards)
+	}
+
+	config, err := newMonitorConfig(c, poolShards)
+	if err != nil {
+		return err
 	}
+	pool.config = config
 
+	pool.sessions.ttl = c.DurOr("session_ttl", 30*time.Minute)
+
+	pool.blocks.rules, err = loadBlockRules(c.StrOr("block_rules_file", ""))
+	if err != nil {
+		return fmt.Errorf("block rules: %w", err)
+	}
+
+	pool.upstream = nil
+	for _, v := range c.ListOr("upstream") {
+		proxy := pmux.NewProxyFromURL(v)
+		if !proxy.Valid() {
+			return fmt.Errorf("invalid upstream proxy: %s", redacted(v))
+		}
+		pool.upstream = append(pool.upstream, proxy)
+	}
 	return nil
 }
 
-func (pool *Pool) Start(ctx app.Context) {
+func (pool *Pool) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "request_workers", Type: app.TypeInt, Default: "512",
+			Doc: "number of workers to perform outgoing HTTP requests"},
+		{Name: "request_timeout", Type: app.TypeDuration, Default: "10s",
+			Doc: "outgoing HTTP request timeout"},
+		{Name: "shards", Type: app.TypeInt, Default: "1",
+			Doc: "number of shards"},
+		{Name: "offer_limit", Type: app.TypeInt, Default: "25",
+			Doc: "number of proxies to try for a single request"},
+		{Name: "evict_span_minutes", Type: app.TypeInt, Default: "5",
+			Doc: "number of minutes in the latest span of time for rolling counters"},
+		{Name: "short_timeout_sleep", Type: app.TypeDuration, Default: "1m",
+			Doc: "time to remove a proxy from routing after the first timeout or error"},
+		{Name: "long_timeout_sleep", Type: app.TypeDuration, Default: "1h",
+			Doc: "time to remove a proxy from routing after evict_threshold_timeouts"},
+		{Name: "evict_threshold_timeouts", Type: app.TypeInt, Default: "3",
+			Doc: "number of timeouts within evict_span_minutes to use long_timeout_sleep"},
+		{Name: "evict_threshold_failures", Type: app.TypeInt, Default: "3",
+			Doc: "number of failures within evict_span_minutes to evict proxy from the pool"},
+		{Name: "evict_threshold_reanimations", Type: app.TypeInt, Default: "10",
+			Doc: "number of any proxy sleeps ever to evict proxy from the pool"},
+		{Name: "upstream", Type: app.TypeList, Secret: true,
+			Doc: "proxies with credentials, that are added to the pool on start"},
+		{Name: "selection", Type: app.TypeString, Default: defaultSelection,
+			Doc:    "strategy to pick a proxy within a shard",
+			Values: selectionNames()},
+		{Name: "host_scores_limit", Type: app.TypeInt, Default: "10000",
+			Doc: "number of (proxy, destination host) pairs to keep scores for in every shard"},
+		{Name: "host_block_time", Type: app.TypeDuration, Default: "10m",
+			Doc: "time to offer a proxy last for the host, where its latest request failed"},
+		{Name: "session_ttl", Type: app.TypeDuration, Default: "30m",
+			Doc: "time to keep the proxy of a sticky session since its last successful request"},
+		{Name: "ready_min_proxies", Type: app.TypeInt, Default: "1",
+			Doc: "number of working proxies, starting from which the pool is ready"},
+		{Name: "block_rules_file", Type: app.TypeString,
+			Doc: "YAML file with rules, that detect blocked responses"},
+	}
+}
+
+// redacted masks password in proxy URL, so that it doesn't end up in logs
+func redacted(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<unparseable>"
+	}
+	return u.Redacted()
+}
+
+// Reconfigure applies thresholds, selection and host scoring to running shards.
+// Number of shards and workers, timeouts, upstream proxies, sessions and block
+// rules require a restart.
+func (pool *Pool) Reconfigure(c app.Config) error {
+	config, err := newMonitorConfig(c, len(pool.shards))
+	if err != nil {
+		return err
+	}
+	if c.IntOr("shards", 1) != len(pool.shards) || c.IntOr("request_workers", 512) != cap(pool.work) {
+		log.Warn().Msg("restart required to change shards or request_workers")
+	}
+	pool.configMu.Lock()
+	pool.config = config
+	pool.configMu.Unlock()
+	for i := range pool.shards {
+		pool.shards[i].reconfigure <- config
+	}
+	log.Info().
+		Str("selection", config.selection).
+		Int("evict_span_minutes", config.evictSpanMinutes).
+		Msg("reconfigured pool")
+	return nil
+}
+
+func (pool *Pool) currentConfig() *monitorConfig {
+	pool.configMu.RLock()
+	defer pool.configMu.RUnlock()
+	return pool.config
+}
+
+func (pool *Pool) Start(ctx app.Context) error {
 	if pool.config == nil {
-		panic("pool is not configured")
+		return fmt.Errorf("pool is not configured")
+	}
+	upstream := map[pmux.Proxy]bool{}
+	for _, proxy := range pool.upstream {
+		upstream[proxy] = true
 	}
-	go pool.counter(ctx)
-	go pool.halter(ctx)
-	go pool.gatherEvictions(ctx)
+	loops := pool.loops.Start(ctx)
+	pool.loops.Go(func() { pool.counter(loops) })
+	pool.loops.Go(func() { pool.halter(loops) })
+	pool.loops.Go(func() { pool.gatherEvictions(loops) })
 	for i := range pool.shards {
 		shard := &pool.shards[i]
 		shard.init(pool.config, pool.work)
-		go shard.main(ctx)
+		// every shard gets the same read-only map
+		shard.upstream = upstream
+		pool.loops.Go(func() { shard.main(loops) })
 		shard.reanimate <- true
 	}
 	parallelRequests := cap(pool.work)
-	go pool.workerMonitor(ctx.Ctx())
+	pool.loops.Go(func() { pool.workerMonitor(loops.Ctx()) })
+	workers := pool.workers.Start(ctx)
 	for i := 0; i < parallelRequests; i++ {
-		ctx, cancel := context.WithCancel(ctx.Ctx())
-		pool.workerCancels = append(pool.workerCancels, cancel)
-		go pool.worker(ctx)
+		pool.workers.Go(func() { pool.worker(workers.Ctx()) })
+	}
+	pool.workers.Go(func() { pool.addUpstream(workers.Ctx(), pool.upstream) })
+	return nil
+}
+
+// Stop lets workers finish in-flight requests and then stops shards,
+// so that the state doesn't change after it's flushed
+func (pool *Pool) Stop(ctx context.Context) error {
+	err := pool.workers.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("workers: %w", err)
+	}
+	return pool.loops.Stop(ctx)
+}
+
+// addUpstream adds configured proxies with credentials, that are not coming
+// from any source, unless they were already restored from the state. They
+// are pinned, so that they sleep instead of being evicted.
+func (pool *Pool) addUpstream(ctx context.Context, upstream []pmux.Proxy) {
+	if len(upstream) == 0 {
+		return
+	}
+	present := map[pmux.Proxy]bool{}
+	for _, e := range pool.snapshot() {
+		present[e.Proxy] = true
+	}
+	for _, proxy := range upstream {
+		if present[proxy] {
+			continue
+		}
+		pool.Add(ctx, proxy, 0)
 	}
 }
 
@@ -198,8 +375,16 @@ func (pool *Pool) worker(ctx context.Context) {
 		case w := <-pool.work:
 			start := time.Now()
 			pool.workerProgress <- 1
-			res, err := pool.client.Do(w.r.in)
+			pool.counters.active.Add(1)
+			var res *http.Response
+			var err error
+			if w.r.in.Method == http.MethodConnect {
+				res, err = pool.connect(w.r.in)
+			} else {
+				res, err = pool.client.Do(w.r.in)
+			}
 			pool.workerProgress <- -1
+			pool.counters.active.Add(-1)
 			w.reply <- reply{
 				start:    start,
 				response: res,
@@ -211,6 +396,14 @@ func (pool *Pool) worker(ctx context.Context) {
 	}
 }
 
+// connect establishes the tunnel within the same timeout as regular requests
+// have, though the connection itself stays open after the timeout
+func (pool *Pool) connect(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), pool.tunnelTimeout)
+	defer cancel()
+	return pool.tunnel.RoundTrip(req.WithContext(ctx))
+}
+
 func (pool *Pool) halter(ctx app.Context) {
 	var pressure int
 	// TODO: make configurable
@@ -267,7 +460,12 @@ func (pool *Pool) counter(ctx app.Context) {
 			log.Warn().Stringer("delay", delay).Msg("slowing down")
 		case <-start:
 			serial++
-			pool.serial <- serial
+			select {
+			case <-ctx.Done():
+				return
+			case pool.serial <- serial:
+			}
+			pool.counters.serial.Store(int64(serial))
 			if delayed {
 				// otherwise we'll have one request per minute
 				delay = 0
@@ -277,6 +475,14 @@ func (pool *Pool) counter(ctx app.Context) {
 }
 
 func (pool *Pool) snapshot() (entries []*entry) {
+	if pool.loops.Stopped() {
+		// shards are not running, so entries are safe to read
+		for i := range pool.shards {
+			entries = append(entries, pool.shards[i].Entries...)
+		}
+		defaultSorting(entries)
+		return
+	}
 	// https://github.com/orcaman/concurrent-map/blob/893feb299719d9cbb2cfbe08b6dd4eb567d8039d/concurrent_map.go#L161-L240
 	var wg sync.WaitGroup
 	bc := make(chan []*entry)
@@ -332,6 +538,8 @@ type ApiEntry struct {
 	Country        string `facet:"Country"`
 	Provider       string
 	ASN            uint16
+	Pinned         bool
+	Latency        time.Duration
 }
 
 func (d ApiEntryDataset) getProxyProtocol(record int) string {
@@ -343,39 +551,123 @@ func (pool *Pool) HttpGet(r *http.Request) (any, error) {
 	if filter == "" {
 		filter = "Ok ORDER BY LastSeen DESC"
 	}
-	var tmp ApiEntryDataset
+	return pool.apiEntries().Query(filter)
+}
+
+// HttpGetByID serves /api/pool/hosts with scores of proxies per destination host
+// and /api/pool/export with proxies in formats of other software
+func (pool *Pool) HttpGetByID(id string, r *http.Request) (any, error) {
+	switch id {
+	case "hosts":
+		return pool.hostEntries().Query(r.FormValue("filter"))
+	case "export":
+		return pool.export(r)
+	default:
+		return nil, app.NotFound("not found: " + id)
+	}
+}
+
+func (pool *Pool) hostEntries() (tmp HostEntryDataset) {
+	for i := range pool.shards {
+		out := make(chan []HostEntry)
+		pool.shards[i].hostsSnapshot <- out
+		tmp = append(tmp, <-out...)
+	}
+	return tmp
+}
+
+func (pool *Pool) apiEntries() (tmp ApiEntryDataset) {
 	for _, v := range pool.snapshot() {
-		info := pool.ipLookup.Get(v.Proxy)
-		tmp = append(tmp, ApiEntry{
-			Proxy:          v.Proxy,
-			FirstSeen:      v.FirstSeen,
-			LastSeen:       v.LastSeen,
-			ReanimateAfter: v.ReanimateAfter,
-			Ok:             v.Ok,
-			Speed:          v.Speed,
-			Timeouts:       v.TimeoutShort.Sum(),
-			Offered:        v.RequestsShort(), // TODO: make sure the same time interval
-			Reanimated:     v.Reanimated,
-			Succeed:        v.SuccessShort.Sum(),
-			HourOffered:    v.HourOffered,
-			HourSucceed:    v.HourSucceed,
-			Country:        info.Country,
-			Provider:       info.Provider,
-			ASN:            info.ASN,
-		})
-	}
-	return tmp.Query(filter)
+		tmp = append(tmp, newApiEntry(v, pool.ipLookup))
+	}
+	return tmp
+}
+
+func newApiEntry(v *entry, ipLookup ipinfo.IpInfoGetter) ApiEntry {
+	info := ipLookup.Get(v.Proxy)
+	return ApiEntry{
+		Proxy:          v.Proxy,
+		FirstSeen:      v.FirstSeen,
+		LastSeen:       v.LastSeen,
+		ReanimateAfter: v.ReanimateAfter,
+		Ok:             v.Ok,
+		Speed:          v.Speed,
+		Timeouts:       v.TimeoutShort.Sum(),
+		Offered:        v.RequestsShort(), // TODO: make sure the same time interval
+		Reanimated:     v.Reanimated,
+		Succeed:        v.SuccessShort.Sum(),
+		HourOffered:    v.HourOffered,
+		HourSucceed:    v.HourSucceed,
+		Country:        info.Country,
+		Provider:       info.Provider,
+		ASN:            info.ASN,
+		Pinned:         v.Pinned,
+		Latency:        v.Latency,
+	}
 }
 
 func (pool *Pool) Len() (res int) {
 	return len(pool.snapshot())
 }
 
+// Ping goes through main loops of all shards
+func (pool *Pool) Ping(ctx context.Context) error {
+	for i := range pool.shards {
+		out := make(chan []*entry, 1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case pool.shards[i].snapshot <- out:
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-out:
+		}
+	}
+	return nil
+}
+
+// Ready tells if there are enough working proxies to forward requests
+func (pool *Pool) Ready() error {
+	config := pool.currentConfig()
+	if config == nil {
+		return fmt.Errorf("pool is not configured")
+	}
+	var working int
+	for _, v := range pool.snapshot() {
+		if v.Ok {
+			working++
+		}
+	}
+	if working < config.readyMinProxies {
+		return fmt.Errorf("%d working proxies, but %d required", working, config.readyMinProxies)
+	}
+	return nil
+}
+
 func (pool *Pool) Add(ctx context.Context, proxy pmux.Proxy, speed time.Duration) {
 	shard := proxy.Bucket(len(pool.shards))
 	pool.shards[shard].incoming <- incoming{ctx, proxy, speed}
 }
 
+// Pin replaces the set of proxies, that are never evicted from the pool.
+// It waits for shards to start, unless ctx is done first.
+func (pool *Pool) Pin(ctx context.Context, proxies []pmux.Proxy) {
+	pinned := make(map[pmux.Proxy]bool, len(proxies))
+	for _, proxy := range proxies {
+		pinned[proxy] = true
+	}
+	for i := range pool.shards {
+		// every shard gets the same read-only map
+		select {
+		case <-ctx.Done():
+			return
+		case pool.shards[i].pin <- pinned:
+		}
+	}
+}
+
 func (pool *Pool) Remove(proxy pmux.Proxy) bool {
 	out := make(chan bool)
 	defer close(out)
@@ -436,16 +728,45 @@ func (pool *Pool) nextSerial(ctx context.Context) int {
 	return serial
 }
 
+// RoundTrip forwards request through one of the proxies in the pool. CONNECT
+// requests are offered only to proxies, that support tunnelling, and response
+// body is the raw connection to the host from request URL. Proxies are further
+// narrowed down by X-Proxy-* routing hints from request headers. Requests with
+// the same session key go through the same proxy, until it fails.
 func (pool *Pool) RoundTrip(req *http.Request) (res *http.Response, err error) {
 	// get sequence number and do some throttling if needed
 	ctx := req.Context()
 	start := time.Now()
 	serial := pool.nextSerial(ctx)
+	defer func() {
+		if res != nil {
+			pool.counters.response(res.StatusCode)
+		}
+	}()
 	// add trace information deep to all other places
 	ctx = app.Log.WithInt(ctx, "serial", serial)
 	req = req.WithContext(ctx)
 	attempt := 0
 	log := app.Log.From(ctx)
+	hints, err := parseHints(req.Header)
+	if err != nil {
+		return invalidHints(req, err), nil
+	}
+	var hint *hint
+	if hints != "" {
+		hint, err = pool.newHint(hints)
+		if err != nil {
+			return invalidHints(req, err), nil
+		}
+	}
+	selection, err := parseSelection(req.Header)
+	if err != nil {
+		return invalidHints(req, err), nil
+	}
+	session := sessionKey(req.Header)
+	sticky, hasSticky := pool.sessions.get(session)
+	// sticky proxy gets one extra attempt outside of shard rotation
+	var stickyAttempts int
 	for {
 		attempt++
 		log := log.With().Int("attempt", attempt).Logger()
@@ -462,26 +783,55 @@ func (pool *Pool) RoundTrip(req *http.Request) (res *http.Response, err error) {
 			// shard := rand.Intn(len(pool.shards))
 			// shart from the first shard to reduce the number of test attempts
 			shard := (serial - 1 + attempt - 1) % len(pool.shards)
+			var only pmux.Proxy
+			stick := hasSticky && attempt == 1
+			if stick {
+				shard = sticky.Bucket(len(pool.shards))
+				only = sticky
+				stickyAttempts = 1
+			}
 			log.Trace().Int("shard", shard).Msg("try")
 			// set attempt and serial for history wrapper to pick up
 			req.Header.Set("X-Proxy-Serial", fmt.Sprint(serial))
 			req.Header.Set("X-Proxy-Attempt", fmt.Sprint(attempt))
+			if hints != "" {
+				req.Header.Set("X-Proxy-Hints", hints)
+			}
+			if session != "" {
+				req.Header.Set("X-Proxy-Session", session)
+			}
+			if selection != "" {
+				req.Header.Set("X-Proxy-Selection", selection)
+			}
 			// send over the request to one of the shards for randomization purposes
 			pool.shards[shard].requests <- request{
-				in:      req,
-				out:     out,
-				start:   start,
-				serial:  serial,
-				attempt: attempt,
+				in:        req,
+				out:       out,
+				start:     start,
+				serial:    serial,
+				attempt:   attempt,
+				hint:      hint,
+				sticky:    only,
+				selection: selection,
 			}
 			res := <-out
+			if stick && (res == nil || res.StatusCode == 552) {
+				log.Info().Str("session", session).Stringer("proxy", sticky).Msg("session failover")
+				continue
+			}
 			if res == nil {
 				continue
 			}
 			// when no response is returned or proxy pool is exhausted
-			if attempt < len(pool.shards) && res.StatusCode == 552 {
+			if attempt < len(pool.shards)+stickyAttempts && res.StatusCode == 552 {
 				continue
 			}
+			if session != "" && res.StatusCode < 400 && res.Request != nil {
+				through := pmux.GetProxyFromContext(res.Request.Context())
+				if through.Valid() {
+					pool.sessions.bind(session, through)
+				}
+			}
 			// if res.StatusCode == 552 && pool.pressure != nil {
 			// 	// this could mean either no proxies left or all attempts exhausted
 			// 	s := time.Now()
@@ -495,21 +845,33 @@ func (pool *Pool) RoundTrip(req *http.Request) (res *http.Response, err error) {
 }
 
 func (pool *Pool) MarshalBinary() ([]byte, error) {
+	state := poolState{
+		Entries: pool.snapshot(),
+	}
+	config := pool.currentConfig()
+	if config != nil {
+		state.EvictSpanMinutes = config.evictSpanMinutes
+	}
 	var b bytes.Buffer
-	snapshot := pool.snapshot()
-	gob.NewEncoder(&b).Encode(snapshot)
+	err := gob.NewEncoder(&b).Encode(state)
+	if err != nil {
+		return nil, err
+	}
 	return b.Bytes(), nil
 }
 
 func (pool *Pool) UnmarshalBinary(data []byte) error {
-	b := bytes.NewReader(data)
-	var snapshot []*entry
-	err := gob.NewDecoder(b).Decode(&snapshot)
+	var state poolState
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state)
 	if err != nil {
 		return err
 	}
-	for _, v := range snapshot {
+	resize := pool.config != nil && state.EvictSpanMinutes != pool.config.evictSpanMinutes
+	for _, v := range state.Entries {
 		local := v
+		if resize {
+			local.resizeShort(int16(pool.config.evictSpanMinutes))
+		}
 		shard := local.Proxy.Bucket(len(pool.shards))
 		pool.shards[shard].Entries = append(pool.shards[shard].Entries, local)
 	}
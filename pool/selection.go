@@ -0,0 +1,237 @@
+package pool
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// selection decides the order, in which a shard offers its entries. Every
+// shard has its own instances, so implementations may keep unguarded state.
+type selection interface {
+	// order returns the cursor over entries from the most preferred one
+	order(entries []*entry) cursor
+	// offered is called with the index of entry, that is picked for request
+	offered(idx int)
+	// refresh is called on the minute tick and whenever entries change, so
+	// that orders depending on stats of entries are not sorted per request
+	refresh(entries []*entry)
+}
+
+// cursor walks indexes of entries, starting from the position and wrapping
+// around, either directly or through the cached order
+type cursor struct {
+	sorted []int // nil walks entries as they are
+	start  int
+	size   int
+	i      int
+}
+
+// rotation walks all indexes starting from the offset
+func rotation(offset, size int) cursor {
+	return cursor{start: offset, size: size}
+}
+
+func (c *cursor) next() (int, bool) {
+	if c.i >= c.size {
+		return 0, false
+	}
+	pos := (c.start + c.i) % c.size
+	c.i++
+	if c.sorted == nil {
+		return pos, true
+	}
+	return c.sorted[pos], true
+}
+
+// sortedOrder keeps indexes of entries sorted between refreshes
+type sortedOrder []int
+
+// reset resizes the order to entries, reusing the memory
+func (s *sortedOrder) reset(entries []*entry) []int {
+	res := (*s)[:0]
+	for i := range entries {
+		res = append(res, i)
+	}
+	*s = res
+	return res
+}
+
+// stale tells if the shard changed without refresh
+func (s sortedOrder) stale(entries []*entry) bool {
+	return len(s) != len(entries)
+}
+
+var selections = map[string]func() selection{
+	"random":              func() selection { return randomSelection{} },
+	"round-robin":         func() selection { return &roundRobinSelection{} },
+	"least-recently-used": func() selection { return &leastRecentlyUsedSelection{} },
+	"success-rate":        func() selection { return &successRateSelection{} },
+	"latency":             func() selection { return &latencySelection{} },
+}
+
+const defaultSelection = "random"
+
+func newSelections() map[string]selection {
+	res := map[string]selection{}
+	for name, factory := range selections {
+		res[name] = factory()
+	}
+	return res
+}
+
+func selectionNames() (names []string) {
+	for name := range selections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validSelection(name string) error {
+	_, ok := selections[name]
+	if !ok {
+		return fmt.Errorf("unknown selection strategy: %s", name)
+	}
+	return nil
+}
+
+// parseSelection removes X-Proxy-Selection header and returns the strategy,
+// that overrides the one configured for the pool
+func parseSelection(h http.Header) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(h.Get("X-Proxy-Selection")))
+	h.Del("X-Proxy-Selection")
+	if name == "" {
+		return "", nil
+	}
+	return name, validSelection(name)
+}
+
+// randomSelection starts from a random entry
+type randomSelection struct{}
+
+func (randomSelection) order(entries []*entry) cursor {
+	return rotation(rand.Intn(len(entries)), len(entries))
+}
+
+func (randomSelection) offered(int) {}
+
+func (randomSelection) refresh([]*entry) {}
+
+// roundRobinSelection starts right after the previously offered entry
+type roundRobinSelection struct {
+	next int
+}
+
+func (s *roundRobinSelection) order(entries []*entry) cursor {
+	return rotation(s.next%len(entries), len(entries))
+}
+
+func (s *roundRobinSelection) offered(idx int) {
+	s.next = idx + 1
+}
+
+func (*roundRobinSelection) refresh([]*entry) {}
+
+// leastRecentlyUsedSelection prefers entries, that weren't offered for the
+// longest. Offered entry moves to the end of the order, which is sorted by
+// the time of the last offer only on refresh.
+type leastRecentlyUsedSelection struct {
+	sorted sortedOrder
+}
+
+func (s *leastRecentlyUsedSelection) order(entries []*entry) cursor {
+	if s.sorted.stale(entries) {
+		s.refresh(entries)
+	}
+	return cursor{sorted: s.sorted, size: len(s.sorted)}
+}
+
+func (s *leastRecentlyUsedSelection) offered(idx int) {
+	for pos, v := range s.sorted {
+		if v != idx {
+			continue
+		}
+		copy(s.sorted[pos:], s.sorted[pos+1:])
+		s.sorted[len(s.sorted)-1] = idx
+		return
+	}
+}
+
+func (s *leastRecentlyUsedSelection) refresh(entries []*entry) {
+	res := s.sorted.reset(entries)
+	sort.SliceStable(res, func(i, j int) bool {
+		return entries[res[i]].LastOffered.Before(entries[res[j]].LastOffered)
+	})
+}
+
+// successRateSelection randomly picks entries with the probability proportional
+// to their success rate, so that proxies without history still get some traffic.
+// Entries with lower success rate than the picked one are tried next.
+type successRateSelection struct {
+	sorted sortedOrder
+	// cumulative weights of entries in the sorted order
+	cumulative []float64
+}
+
+func (s *successRateSelection) order(entries []*entry) cursor {
+	if s.sorted.stale(entries) {
+		s.refresh(entries)
+	}
+	total := s.cumulative[len(s.cumulative)-1]
+	pos := sort.SearchFloat64s(s.cumulative, rand.Float64()*total)
+	if pos >= len(s.sorted) {
+		pos = len(s.sorted) - 1
+	}
+	return cursor{sorted: s.sorted, start: pos, size: len(s.sorted)}
+}
+
+func (*successRateSelection) offered(int) {}
+
+func (s *successRateSelection) refresh(entries []*entry) {
+	weight := func(e *entry) float64 {
+		// Laplace smoothing gives 50% to entries, that were never offered
+		return float64(e.Succeed+1) / float64(e.Offered+2)
+	}
+	res := s.sorted.reset(entries)
+	sort.SliceStable(res, func(i, j int) bool {
+		return weight(entries[res[i]]) > weight(entries[res[j]])
+	})
+	s.cumulative = s.cumulative[:0]
+	total := 0.0
+	for _, idx := range res {
+		total += weight(entries[idx])
+		s.cumulative = append(s.cumulative, total)
+	}
+}
+
+// latencySelection prefers entries with the lowest moving average of request
+// durations, falling back to the speed measured by the probe
+type latencySelection struct {
+	sorted sortedOrder
+}
+
+func (s *latencySelection) order(entries []*entry) cursor {
+	if s.sorted.stale(entries) {
+		s.refresh(entries)
+	}
+	return cursor{sorted: s.sorted, size: len(s.sorted)}
+}
+
+func (*latencySelection) offered(int) {}
+
+func (s *latencySelection) refresh(entries []*entry) {
+	latency := func(e *entry) time.Duration {
+		if e.Latency == 0 {
+			return e.Speed
+		}
+		return e.Latency
+	}
+	res := s.sorted.reset(entries)
+	sort.SliceStable(res, func(i, j int) bool {
+		return latency(entries[res[i]]) < latency(entries[res[j]])
+	})
+}
@@ -0,0 +1,182 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func selectionShard(t *testing.T, selection string, entries ...*entry) *shard {
+	cfg := *testPoolCfg
+	cfg.offerLimit = 1_000_000
+	cfg.selection = selection
+	s := newShard()
+	s.init(&cfg, make(chan work))
+	t.Cleanup(s.minute.Stop)
+	for i, e := range entries {
+		e.Ok = true
+		e.Proxy = pmux.HttpProxy(fmt.Sprintf("127.0.0.1:%d", i+1))
+		s.Entries = append(s.Entries, e)
+	}
+	return s
+}
+
+func newTestEntries(n int) (res []*entry) {
+	for i := 0; i < n; i++ {
+		res = append(res, newEntry(pmux.Proxy{}, time.Second, 5))
+	}
+	return res
+}
+
+// picks offers entries from the shard and returns how many times each of them was picked
+func picks(s *shard, n int, selection string) (seq []int, counts map[int]int) {
+	counts = map[int]int{}
+	index := map[*entry]int{}
+	for i, e := range s.Entries {
+		index[e] = i
+	}
+	for i := 0; i < n; i++ {
+		e := s.firstAvailableProxy(request{
+			in:        (&http.Request{}).WithContext(context.Background()),
+			selection: selection,
+		})
+		seq = append(seq, index[e])
+		counts[index[e]]++
+	}
+	return seq, counts
+}
+
+func TestSelection_RoundRobin(t *testing.T) {
+	s := selectionShard(t, "round-robin", newTestEntries(4)...)
+	seq, counts := picks(s, 400, "")
+	assert.Equal(t, []int{0, 1, 2, 3, 0, 1}, seq[:6])
+	assert.Equal(t, map[int]int{0: 100, 1: 100, 2: 100, 3: 100}, counts)
+}
+
+func TestSelection_Random(t *testing.T) {
+	s := selectionShard(t, "random", newTestEntries(4)...)
+	_, counts := picks(s, 4000, "")
+	for i := 0; i < 4; i++ {
+		// expected 1000 per entry
+		assert.InDelta(t, 1000, counts[i], 200, "entry %d", i)
+	}
+}
+
+func TestSelection_LeastRecentlyUsed(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	var tick int
+	now = func() time.Time {
+		tick++
+		return ti(0, 0, tick)
+	}
+	s := selectionShard(t, "least-recently-used", newTestEntries(5)...)
+	seq, counts := picks(s, 50, "")
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4}, seq[:5])
+	// once everything was offered, the order repeats
+	assert.Equal(t, seq[:5], seq[5:10])
+	assert.Equal(t, map[int]int{0: 10, 1: 10, 2: 10, 3: 10, 4: 10}, counts)
+}
+
+func TestSelection_SuccessRate(t *testing.T) {
+	entries := newTestEntries(2)
+	// high numbers keep rates stable while picking
+	entries[0].Offered, entries[0].Succeed = 100_000, 90_000
+	entries[1].Offered, entries[1].Succeed = 100_000, 10_000
+	s := selectionShard(t, "success-rate", entries...)
+	_, counts := picks(s, 2000, "")
+	// weighted sampling of the first pick gives 90% to the first entry
+	assert.InDelta(t, 1800, counts[0], 100)
+	assert.InDelta(t, 200, counts[1], 100)
+}
+
+func TestSelection_Latency(t *testing.T) {
+	entries := newTestEntries(3)
+	entries[0].Speed = 3 * time.Second
+	entries[1].Speed = 2 * time.Second
+	entries[2].Speed = 1 * time.Second
+	entries[2].ObserveLatency(5 * time.Second)
+	s := selectionShard(t, "latency", entries...)
+
+	_, counts := picks(s, 10, "")
+	assert.Equal(t, map[int]int{1: 10}, counts)
+
+	s.Entries[1].ReanimateAfter = time.Now().Add(time.Hour)
+	_, counts = picks(s, 10, "")
+	assert.Equal(t, map[int]int{0: 10}, counts)
+}
+
+func TestSelection_CachedOrder(t *testing.T) {
+	entries := newTestEntries(2)
+	entries[0].Speed = 2 * time.Second
+	entries[1].Speed = 1 * time.Second
+	s := selectionShard(t, "latency", entries...)
+	_, counts := picks(s, 1, "")
+	assert.Equal(t, map[int]int{1: 1}, counts)
+
+	// stats are sorted again only on the minute tick
+	entries[0].ObserveLatency(100 * time.Millisecond)
+	_, counts = picks(s, 1, "")
+	assert.Equal(t, map[int]int{1: 1}, counts)
+	s.refreshSelections()
+	_, counts = picks(s, 1, "")
+	assert.Equal(t, map[int]int{0: 1}, counts)
+}
+
+func TestSelection_NoAllocations(t *testing.T) {
+	entries := newTestEntries(100)
+	for name, strategy := range newSelections() {
+		strategy.refresh(entries)
+		allocs := testing.AllocsPerRun(100, func() {
+			order := strategy.order(entries)
+			for idx, ok := order.next(); ok; idx, ok = order.next() {
+				strategy.offered(idx)
+			}
+		})
+		assert.Zero(t, allocs, name)
+	}
+}
+
+func TestSelection_PerRequest(t *testing.T) {
+	s := selectionShard(t, "random", newTestEntries(3)...)
+	seq, _ := picks(s, 6, "round-robin")
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2}, seq)
+}
+
+func TestObserveLatency(t *testing.T) {
+	e := &entry{}
+	e.ObserveLatency(10 * time.Second)
+	assert.Equal(t, 10*time.Second, e.Latency)
+	e.ObserveLatency(0)
+	assert.Equal(t, 7*time.Second, e.Latency)
+}
+
+func TestParseSelection(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Proxy-Selection", "Round-Robin")
+	selection, err := parseSelection(h)
+	require.NoError(t, err)
+	assert.Equal(t, "round-robin", selection)
+	assert.Equal(t, http.Header{}, h)
+
+	h.Set("X-Proxy-Selection", "fastest")
+	_, err = parseSelection(h)
+	assert.EqualError(t, err, "unknown selection strategy: fastest")
+}
+
+func TestConfigureSelection(t *testing.T) {
+	pool := NewPool(history.NewHistory(), ipinfo.NoopIpInfo{}, &net.Dialer{})
+	err := pool.Configure(app.Config{"selection": "nope"})
+	assert.EqualError(t, err, "unknown selection strategy: nope")
+}
@@ -0,0 +1,129 @@
+package pool
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// sessions keep the same exit proxy for requests with the same session key,
+// so that scrapers can log in or paginate from the same IP address
+type sessions struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]*session
+}
+
+type session struct {
+	ID        string
+	Proxy     pmux.Proxy
+	Created   time.Time
+	LastUsed  time.Time
+	Expires   time.Time
+	Requests  int
+	Failovers int
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		ttl:   30 * time.Minute,
+		items: map[string]*session{},
+	}
+}
+
+// get returns proxy, that is bound to the session, unless it's expired
+func (s *sessions) get(id string) (pmux.Proxy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.items[id]
+	if !ok || now().After(v.Expires) {
+		return pmux.Proxy{}, false
+	}
+	return v.Proxy, true
+}
+
+// bind records a successful request through the proxy and extends the session.
+// Different proxy for the existing session means, that the previous one failed.
+func (s *sessions) bind(id string, proxy pmux.Proxy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := now()
+	for k, v := range s.items {
+		if now.After(v.Expires) {
+			delete(s.items, k)
+		}
+	}
+	v, ok := s.items[id]
+	if !ok {
+		v = &session{
+			ID:      id,
+			Proxy:   proxy,
+			Created: now,
+		}
+		s.items[id] = v
+	}
+	if v.Proxy != proxy {
+		v.Proxy = proxy
+		v.Failovers++
+	}
+	v.Requests++
+	v.LastUsed = now
+	v.Expires = now.Add(s.ttl)
+}
+
+// list returns active sessions, recently used first
+func (s *sessions) list() (res []session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := now()
+	for _, v := range s.items {
+		if now.After(v.Expires) {
+			continue
+		}
+		res = append(res, *v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastUsed.After(res[j].LastUsed)
+	})
+	return res
+}
+
+// sessionKey removes session headers and returns either X-Proxy-Session
+// header or username from Proxy-Authorization header, if there's any
+func sessionKey(h http.Header) string {
+	key := h.Get("X-Proxy-Session")
+	auth := h.Get("Proxy-Authorization")
+	h.Del("X-Proxy-Session")
+	// credentials for this server must never reach upstream proxies
+	h.Del("Proxy-Authorization")
+	if key != "" {
+		return key
+	}
+	encoded, ok := strings.CutPrefix(auth, "Basic ")
+	if !ok {
+		return ""
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(raw), ":")
+	return user
+}
+
+type sessionsApi struct {
+	pool *Pool
+}
+
+func NewSessionsApi(pool *Pool) *sessionsApi {
+	return &sessionsApi{pool}
+}
+
+func (a *sessionsApi) HttpGet(r *http.Request) (any, error) {
+	return a.pool.sessions.list(), nil
+}
@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionKey(t *testing.T) {
+	h := http.Header{}
+	h.Set("Proxy-Authorization", "Basic c2NvdHQ6dGlnZXI=")
+	assert.Equal(t, "scott", sessionKey(h))
+	assert.Equal(t, http.Header{}, h)
+
+	h.Set("Proxy-Authorization", "Basic c2NvdHQ6dGlnZXI=")
+	h.Set("X-Proxy-Session", "abc")
+	assert.Equal(t, "abc", sessionKey(h))
+
+	h.Set("Proxy-Authorization", "Bearer xyz")
+	assert.Equal(t, "", sessionKey(h))
+	assert.Equal(t, "", sessionKey(http.Header{}))
+}
+
+func TestSessionsExpire(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	start := time.Now()
+	now = func() time.Time {
+		return start
+	}
+	s := newSessions()
+	s.ttl = time.Minute
+	a := pmux.HttpProxy("127.0.0.1:1")
+	b := pmux.HttpProxy("127.0.0.1:2")
+
+	s.bind("abc", a)
+	s.bind("abc", a)
+	s.bind("abc", b)
+	proxy, ok := s.get("abc")
+	assert.True(t, ok)
+	assert.Equal(t, b, proxy)
+	sessions := s.list()
+	require.Len(t, sessions, 1)
+	assert.Equal(t, 3, sessions[0].Requests)
+	assert.Equal(t, 1, sessions[0].Failovers)
+
+	now = func() time.Time {
+		return start.Add(2 * time.Minute)
+	}
+	_, ok = s.get("abc")
+	assert.False(t, ok)
+	assert.Len(t, s.list(), 0)
+
+	s.bind("xyz", a)
+	assert.Len(t, s.items, 1)
+}
+
+func TestRoundTripSession(t *testing.T) {
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), ipinfo.NoopIpInfo{
+		Country: "ZW",
+	}, &net.Dialer{}))
+	defer runtime.Stop()
+
+	ctx := context.Background()
+	for _, v := range []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"} {
+		pool.Add(ctx, pmux.HttpProxy(v), 1*time.Second)
+	}
+
+	var failing pmux.Proxy
+	var through pmux.Proxy
+	pool.client = clientFunc(func(req *http.Request) (*http.Response, error) {
+		through = pmux.GetProxyFromContext(req.Context())
+		if through == failing {
+			return &http.Response{
+				StatusCode: 503,
+				Status:     "503 Service Unavailable",
+				Header:     http.Header{},
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+		}, nil
+	})
+	get := func() pmux.Proxy {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("X-Proxy-Session", "abc")
+		res, err := pool.RoundTrip(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "abc", req.Header.Get("X-Proxy-Session"))
+		return through
+	}
+
+	first := get()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, get())
+	}
+
+	failing = first
+	second := get()
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, second, get())
+
+	raw, err := NewSessionsApi(pool).HttpGet(&http.Request{})
+	require.NoError(t, err)
+	sessions := raw.([]session)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "abc", sessions[0].ID)
+	assert.Equal(t, second, sessions[0].Proxy)
+	assert.Equal(t, 8, sessions[0].Requests)
+	assert.Equal(t, 1, sessions[0].Failovers)
+}
@@ -3,7 +3,6 @@ package pool
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"sort"
 	"time"
@@ -26,6 +25,18 @@ type request struct {
 	start   time.Time
 	attempt int
 	serial  int
+	hint    *hint      // nil if there are no routing hints
+	sticky  pmux.Proxy // the only proxy offered for the session, if valid
+	// selection overrides the strategy configured for the pool
+	selection string
+}
+
+// allows tells if the entry could be offered for the request
+func (r request) allows(e *entry) bool {
+	if r.sticky.Valid() && e.Proxy != r.sticky {
+		return false
+	}
+	return r.hint == nil || r.hint.allows(e)
 }
 
 type reply struct {
@@ -48,30 +59,57 @@ type removal struct {
 }
 
 type shard struct {
-	Entries   []*entry
-	incoming  chan incoming
-	remove    chan removal
-	requests  chan request
-	snapshot  chan chan []*entry
-	reanimate chan bool
-	reply     chan reply
-	work      chan work //todo channel in pool
-	minute    *time.Ticker
-	evictions []pmux.Proxy
-	eviction  chan chan []pmux.Proxy
-	config    *monitorConfig
+	Entries       []*entry
+	incoming      chan incoming
+	remove        chan removal
+	requests      chan request
+	snapshot      chan chan []*entry
+	reanimate     chan bool
+	reply         chan reply
+	work          chan work //todo channel in pool
+	minute        *time.Ticker
+	evictions     []pmux.Proxy
+	eviction      chan chan []pmux.Proxy
+	config        *monitorConfig
+	reconfigure   chan *monitorConfig
+	pin           chan map[pmux.Proxy]bool
+	pinned        map[pmux.Proxy]bool
+	upstream      map[pmux.Proxy]bool // never evicted, like pinned ones
+	selections    map[string]selection
+	hosts         *hostScores
+	hostsSnapshot chan chan []HostEntry
+}
+
+// newShards creates shards with their channels, so that other services can
+// send to them before the pool is started, without racing with init
+func newShards(count int) []shard {
+	shards := make([]shard, count)
+	for i := range shards {
+		shards[i] = *newShard()
+	}
+	return shards
+}
+
+func newShard() *shard {
+	return &shard{
+		incoming:      make(chan incoming),
+		remove:        make(chan removal),
+		requests:      make(chan request),
+		reanimate:     make(chan bool),
+		snapshot:      make(chan chan []*entry),
+		reply:         make(chan reply),
+		eviction:      make(chan chan []pmux.Proxy),
+		pin:           make(chan map[pmux.Proxy]bool),
+		reconfigure:   make(chan *monitorConfig),
+		hostsSnapshot: make(chan chan []HostEntry),
+	}
 }
 
 func (pool *shard) init(config *monitorConfig, work chan work) {
 	pool.work = work
-	pool.incoming = make(chan incoming)
-	pool.remove = make(chan removal)
-	pool.requests = make(chan request)
-	pool.reanimate = make(chan bool)
-	pool.snapshot = make(chan chan []*entry)
-	pool.reply = make(chan reply)
-	pool.eviction = make(chan chan []pmux.Proxy)
 	pool.minute = time.NewTicker(1 * time.Minute)
+	pool.selections = newSelections()
+	pool.hosts = newHostScores(config.hostScoresLimit)
 	pool.config = config
 }
 
@@ -82,6 +120,8 @@ func (pool *shard) main(ctx app.Context) {
 			return
 		case res := <-pool.snapshot:
 			res <- pool.Entries
+		case res := <-pool.hostsSnapshot:
+			res <- pool.hosts.snapshot(pool.config.hostBlockTime)
 		case <-pool.minute.C:
 			if pool.handleReanimate() {
 				ctx.Heartbeat()
@@ -89,6 +129,7 @@ func (pool *shard) main(ctx app.Context) {
 			if pool.checkEviction(ctx.Ctx()) {
 				ctx.Heartbeat()
 			}
+			pool.refreshSelections()
 		case <-pool.reanimate:
 			pool.forceReanimate()
 		case v := <-pool.remove:
@@ -104,10 +145,31 @@ func (pool *shard) main(ctx app.Context) {
 		case r := <-pool.eviction:
 			r <- pool.evictions
 			pool.evictions = []pmux.Proxy{}
+		case v := <-pool.pin:
+			if pool.handlePin(v) {
+				ctx.Heartbeat()
+			}
+		case c := <-pool.reconfigure:
+			if pool.applyConfig(c) {
+				ctx.Heartbeat()
+			}
 		}
 	}
 }
 
+// applyConfig resizes counters of all entries, if evict_span_minutes changed
+func (pool *shard) applyConfig(config *monitorConfig) bool {
+	resized := config.evictSpanMinutes != pool.config.evictSpanMinutes
+	if resized {
+		for _, e := range pool.Entries {
+			e.resizeShort(int16(config.evictSpanMinutes))
+		}
+	}
+	pool.hosts.limit = config.hostScoresLimit
+	pool.config = config
+	return resized
+}
+
 func (pool *shard) checkEviction(ctx context.Context) bool {
 	log := app.Log.From(ctx)
 	replace := []*entry{}
@@ -137,6 +199,13 @@ func (pool *shard) checkEviction(ctx context.Context) bool {
 	return false
 }
 
+// refreshSelections rebuilds orders, that strategies cache between requests
+func (pool *shard) refreshSelections() {
+	for _, v := range pool.selections {
+		v.refresh(pool.Entries)
+	}
+}
+
 func (pool *shard) handleReanimate() bool {
 	heartbeat := false
 	for i := range pool.Entries {
@@ -165,6 +234,7 @@ func (pool *shard) removeProxy(r removal) {
 		newEntries = append(newEntries, local)
 	}
 	pool.Entries = newEntries
+	pool.refreshSelections()
 	if found {
 		log := app.Log.From(context.TODO())
 		log.Info().Stringer("proxy", r.proxy).Msg("removed")
@@ -172,11 +242,33 @@ func (pool *shard) removeProxy(r removal) {
 	r.reply <- found
 }
 
+// handlePin replaces the set of pinned proxies and tells if any entry changed
+func (pool *shard) handlePin(pinned map[pmux.Proxy]bool) bool {
+	pool.pinned = pinned
+	changed := false
+	for _, e := range pool.Entries {
+		if e.Pinned != pool.isPinned(e.Proxy) {
+			e.Pinned = pool.isPinned(e.Proxy)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// isPinned tells if the proxy is pinned by probe or is one of upstream proxies,
+// which don't come from any source and would never be added back
+func (pool *shard) isPinned(proxy pmux.Proxy) bool {
+	return pool.pinned[proxy] || pool.upstream[proxy]
+}
+
 func (pool *shard) add(v incoming) {
-	pool.Entries = append(pool.Entries, newEntry(v.Proxy, v.Speed, int16(pool.config.evictSpanMinutes)))
+	e := newEntry(v.Proxy, v.Speed, int16(pool.config.evictSpanMinutes))
+	e.Pinned = pool.isPinned(v.Proxy)
+	pool.Entries = append(pool.Entries, e)
 	sort.Slice(pool.Entries, func(i, j int) bool {
 		return pool.Entries[i].Speed < pool.Entries[j].Speed
 	})
+	pool.refreshSelections()
 	log := app.Log.From(v.ctx)
 	log.Info().Stringer("proxy", v.Proxy).Dur("speed", v.Speed).Msg("added")
 }
@@ -186,25 +278,33 @@ func (pool *shard) firstAvailableProxy(r request) *entry {
 	if size == 0 {
 		return nil
 	}
-	if size == 1 {
+	tunnel := r.in.Method == http.MethodConnect
+	if size == 1 && !tunnel && r.hint == nil && !r.sticky.Valid() {
 		return pool.Entries[0]
 	}
-	// offset := 0
-	// defaultSorting(pool.Entries)
-
-	offset := rand.Intn(size)
-	// offset := r.serial % len(pool.Entries)
-
-	// TODO: per-request offset selection strategy -
-	// scrapes are encouraged to refresh the old or
-	// the least offered proxies, but relays need fresher pool
-	available := pool.Entries[offset:size]
+	name := r.selection
+	if name == "" {
+		name = pool.config.selection
+	}
+	strategy, ok := pool.selections[name]
+	if !ok {
+		strategy = pool.selections[defaultSelection]
+	}
+	order := pool.hosts.prefer(strategy.order(pool.Entries), pool.Entries,
+		requestHost(r.in), pool.config.hostBlockTime)
 	ctx := r.in.Context()
-	for idx := range available {
-		e := pool.Entries[offset+idx]
+	for idx, ok := order.next(); ok; idx, ok = order.next() {
+		e := pool.Entries[idx]
+		if tunnel && !e.Proxy.SupportsConnect() {
+			continue
+		}
+		if !r.allows(e) {
+			continue
+		}
 		if e.ConsiderSkip(ctx, pool.config.offerLimit) {
 			continue
 		}
+		strategy.offered(idx)
 		return e
 	}
 	return nil
@@ -257,18 +357,25 @@ func (pool *shard) handleReply(r reply) {
 	log := app.Log.From(r.r.in.Context())
 	err := r.err
 	entry := r.e
+	if err == nil && res.Header.Get("X-Proxy-Blocked") != "" {
+		err = fmt.Errorf("blocked: %s", res.Header.Get("X-Proxy-Blocked"))
+	}
 	if err == nil && res.StatusCode >= 400 {
 		err = fmt.Errorf(res.Status)
 	}
+	pool.hosts.record(entry.Proxy, requestHost(request.in), err, time.Since(r.start))
 	// TODO: special error codes for timeouts
 	if err == nil {
 		entry.MarkSuccess()
+		entry.ObserveLatency(time.Since(r.start))
 		// TODO: Bytes1D & Bytes5M
 		res.Header.Set("X-Proxy-Through", entry.Proxy.String())
 		res.Header.Set("X-Proxy-Attempt", fmt.Sprint(request.attempt))
 		res.Header.Set("X-Proxy-Offered", fmt.Sprint(entry.Offered))
 		res.Header.Set("X-Proxy-Succeed", fmt.Sprint(entry.Succeed))
 		res.Header.Set("X-Proxy-Serial", fmt.Sprint(request.serial))
+		// request carries the proxy in context for sticky sessions
+		res.Request = request.in
 		log.Debug().
 			Stringer("t", time.Since(request.start)).
 			Int("offered", entry.Offered).
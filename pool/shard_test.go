@@ -1,22 +1,24 @@
 package pool
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestShardHandleReanimate(t *testing.T) {
 	now = func() time.Time {
 		return ti(0, 2, 0)
 	}
-	s := &shard{
-		Entries: []*entry{
-			{ReanimateAfter: ti(0, 1, 0)},
-		},
+	s := newShard()
+	s.Entries = []*entry{
+		{ReanimateAfter: ti(0, 1, 0)},
 	}
 	s.init(testPoolCfg, make(chan work))
 	s.minute = time.NewTicker(500 * time.Millisecond)
@@ -34,10 +36,9 @@ func TestShardHandleReply(t *testing.T) {
 	now = func() time.Time {
 		return ti(0, 2, 0)
 	}
-	s := &shard{
-		Entries: []*entry{
-			{ReanimateAfter: ti(0, 1, 0)},
-		},
+	s := newShard()
+	s.Entries = []*entry{
+		{ReanimateAfter: ti(0, 1, 0)},
 	}
 	s.init(testPoolCfg, make(chan work))
 
@@ -66,3 +67,64 @@ func TestShardHandleReply(t *testing.T) {
 	assert.Equal(t, "123", response.Header.Get("X-Proxy-Serial"))
 	assert.Equal(t, "I'm a teapot", response.Status)
 }
+
+func TestShardHandlePin(t *testing.T) {
+	pinned := pmux.HttpProxy("127.0.0.1:1")
+	other := pmux.HttpProxy("127.0.0.1:2")
+	s := newShard()
+	s.Entries = []*entry{
+		{Proxy: pinned},
+		{Proxy: other, Pinned: true},
+	}
+	s.init(testPoolCfg, make(chan work))
+
+	assert.True(t, s.handlePin(map[pmux.Proxy]bool{pinned: true}))
+	assert.True(t, s.Entries[0].Pinned)
+	assert.False(t, s.Entries[1].Pinned)
+	assert.False(t, s.handlePin(map[pmux.Proxy]bool{pinned: true}))
+
+	s.add(incoming{context.Background(), pinned.AsHttps(), time.Second})
+	s.add(incoming{context.Background(), pinned, time.Second})
+	for _, e := range s.Entries[2:] {
+		assert.Equal(t, e.Proxy == pinned, e.Pinned)
+	}
+}
+
+func TestShardKeepsUpstream(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	now = func() time.Time {
+		return ti(0, 2, 0)
+	}
+	upstream := pmux.HttpProxy("127.0.0.1:1").WithAuth("scott", "tiger")
+	other := pmux.HttpProxy("127.0.0.1:2")
+	s := newShard()
+	s.init(testPoolCfg, make(chan work))
+	t.Cleanup(s.minute.Stop)
+	s.upstream = map[pmux.Proxy]bool{upstream: true}
+	s.add(incoming{context.Background(), upstream, 0})
+	s.add(incoming{context.Background(), other, time.Second})
+	// probe pins its own proxies, but upstream ones stay pinned
+	s.handlePin(map[pmux.Proxy]bool{})
+	for _, e := range s.Entries {
+		assert.Equal(t, e.Proxy == upstream, e.Pinned)
+		for i := 0; i < 4; i++ {
+			e.OfferShort.Increment()
+			e.FailureShort.Increment()
+		}
+	}
+
+	assert.True(t, s.checkEviction(context.Background()))
+	assert.Equal(t, []pmux.Proxy{other}, s.evictions)
+	require.Len(t, s.Entries, 1)
+	assert.Equal(t, upstream, s.Entries[0].Proxy)
+	assert.False(t, s.Entries[0].Ok)
+
+	// upstream proxy comes back after the long sleep
+	now = func() time.Time {
+		return ti(0, 2, 0).Add(testPoolCfg.longTimeoutSleep + time.Second)
+	}
+	assert.True(t, s.handleReanimate())
+	assert.True(t, s.Entries[0].Ok)
+}
@@ -0,0 +1,34 @@
+package pool
+
+import (
+	"net/http"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// tunnelTransport handles CONNECT requests by establishing raw TCP connection
+// through the proxy from request context. Connection is returned as a body
+// of the response, so that retries and accounting are shared with all other
+// requests going through the pool.
+type tunnelTransport struct {
+	dialer dialer
+}
+
+func (t tunnelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	proxy := pmux.GetProxyFromContext(ctx)
+	conn, err := pmux.Tunnel(ctx, t.dialer, proxy, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 Connection Established",
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       conn,
+		Request:    req,
+	}, nil
+}
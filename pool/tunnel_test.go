@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tunnelFunc func(req *http.Request) (*http.Response, error)
+
+func (f tunnelFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func connectRequest(host string) *http.Request {
+	return (&http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: host},
+		Host:   host,
+		Header: http.Header{},
+	}).WithContext(context.Background())
+}
+
+func TestRoundTripConnect_OnlyTunnels(t *testing.T) {
+	pool, runtime := app.MockStartSpin(NewPool(history.NewHistory(), ipinfo.NoopIpInfo{
+		Country: "Zimbabwe",
+	}, &net.Dialer{}))
+	defer runtime.Stop()
+
+	ctx := context.Background()
+	pool.Add(ctx, pmux.HttpProxy("127.0.0.1:1"), 1*time.Second)
+
+	res, err := pool.RoundTrip(connectRequest("example.com:443"))
+	require.NoError(t, err)
+	assert.Equal(t, 552, res.StatusCode)
+
+	client, upstream := net.Pipe()
+	defer client.Close()
+	var through pmux.Proxy
+	pool.tunnel = tunnelFunc(func(req *http.Request) (*http.Response, error) {
+		through = pmux.GetProxyFromContext(req.Context())
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{},
+			Body:       upstream,
+			Request:    req,
+		}, nil
+	})
+	https := pmux.HttpsProxy("127.0.0.1:2")
+	pool.Remove(pmux.HttpProxy("127.0.0.1:1"))
+	pool.Add(ctx, https, 1*time.Second)
+
+	res, err = pool.RoundTrip(connectRequest("example.com:443"))
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, https, through)
+	assert.Equal(t, https.String(), res.Header.Get("X-Proxy-Through"))
+
+	conn, ok := res.Body.(io.ReadWriteCloser)
+	require.True(t, ok)
+	go client.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestTunnelTransport_Error(t *testing.T) {
+	req := connectRequest("example.com:443")
+	req = req.WithContext(pmux.HttpProxy("127.0.0.1:1").InContext(req.Context()))
+	_, err := tunnelTransport{&net.Dialer{}}.RoundTrip(req)
+	assert.EqualError(t, err, "http proxies do not support tunnels")
+}
@@ -7,12 +7,13 @@ import (
 
 	"github.com/nfx/slrp/ipinfo"
 	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/ql/eval"
 	"github.com/nfx/slrp/sources"
 )
 
 type blacklistDashboard struct {
-	probe *Probe
-	info  *ipinfo.Lookup
+	probe probeSnapshot
+	info  ipinfo.IpInfoGetter
 }
 
 func NewBlacklistApi(probe *Probe, info *ipinfo.Lookup) *blacklistDashboard {
@@ -40,6 +41,10 @@ func (d blacklistedDataset) getFailureFacet(record int) string {
 }
 
 func (d *blacklistDashboard) HttpGet(r *http.Request) (interface{}, error) {
+	return d.query(r.FormValue("filter"))
+}
+
+func (d *blacklistDashboard) query(filter string) (*eval.QueryResult[blacklisted], error) {
 	probe := d.probe.Snapshot()
 	snapshot := blacklistedDataset{}
 	for proxy, failureIndex := range probe.Blacklist {
@@ -60,5 +65,5 @@ func (d *blacklistDashboard) HttpGet(r *http.Request) (interface{}, error) {
 	if len(snapshot) == 0 {
 		return nil, fmt.Errorf("blacklist is empty")
 	}
-	return snapshot.Query(r.FormValue("filter"))
+	return snapshot.Query(filter)
 }
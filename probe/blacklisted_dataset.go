@@ -8,7 +8,11 @@ import (
 type blacklistedDataset []blacklisted
 
 func (d blacklistedDataset) Query(query string) (*eval.QueryResult[blacklisted], error) {
-	return (&eval.Dataset[blacklisted, blacklistedDataset]{
+	return d.Dataset().Query(query)
+}
+
+func (d blacklistedDataset) Dataset() *eval.Dataset[blacklisted, blacklistedDataset] {
+	return &eval.Dataset[blacklisted, blacklistedDataset]{
 		Source: d,
 		Accessors: eval.Accessors{
 			"Proxy":    eval.StringGetter{Name: "Proxy", Func: d.getProxy},
@@ -45,7 +49,7 @@ func (d blacklistedDataset) Query(query string) (*eval.QueryResult[blacklisted],
 				},
 			}.Facets(filtered, topN)
 		},
-	}).Query(query)
+	}
 }
 
 func (d blacklistedDataset) getProxy(record int) string {
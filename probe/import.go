@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/sources"
+)
+
+// maxImportSize limits the body of a single import request
+const maxImportSize = 32 << 20
+
+// maxInvalidReported limits the number of invalid entries in the response
+const maxInvalidReported = 100
+
+// imported is the outcome of POST /api/probe/import
+type imported struct {
+	Scheduled int
+	// Invalid are 1-based numbers of entries, that could not be parsed.
+	// Entries themselves are not returned, as they may contain credentials.
+	Invalid []int `json:",omitempty"`
+}
+
+// HttpPostByID serves POST /api/probe/import, that schedules proxies pushed
+// by external crawlers under the import source.
+func (p *Probe) HttpPostByID(id string, r *http.Request) (any, error) {
+	if id != "import" {
+		return nil, app.NotFound("unknown command: " + id)
+	}
+	protocol := strings.ToLower(r.FormValue("protocol"))
+	if protocol == "" {
+		protocol = "http"
+	}
+	if !sources.IsProtocol(protocol) {
+		return nil, fmt.Errorf("unknown protocol: %s", protocol)
+	}
+	if r.Body == nil {
+		return nil, fmt.Errorf("empty body")
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxImportSize))
+	if err != nil {
+		return nil, err
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = importFormat(r.Header.Get("Content-Type"), body)
+	}
+	entries, err := sources.ParseList(format, body)
+	if err != nil {
+		return nil, err
+	}
+	return p.schedule(entries, protocol), nil
+}
+
+func (p *Probe) schedule(entries []sources.ListEntry, protocol string) imported {
+	res := imported{}
+	proxies := []pmux.Proxy{}
+	for i, v := range entries {
+		proxy := v.Proxy(protocol)
+		if !proxy.Valid() {
+			if len(res.Invalid) < maxInvalidReported {
+				res.Invalid = append(res.Invalid, i+1)
+			}
+			continue
+		}
+		proxies = append(proxies, proxy)
+	}
+	if len(proxies) == 0 {
+		return res
+	}
+	// every import is shown on the dashboard as a run of the source,
+	// unless the previous one is still probing proxies
+	if !p.stats.Snapshot().IsRunning(sources.Import) {
+		p.stats.LaunchAnticipated(sources.Import, len(proxies))
+	}
+	ctx := app.Log.WithStr(p.ctx, "source", "import")
+	for _, proxy := range proxies {
+		if p.Schedule(ctx, proxy, sources.Import) {
+			res.Scheduled++
+		}
+	}
+	p.stats.Finish(sources.Import, nil)
+	return res
+}
+
+// importFormat detects format by the content type or by the first character
+func importFormat(contentType string, body []byte) string {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return "json"
+	case strings.Contains(contentType, "csv"):
+		return "csv"
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return "json"
+	}
+	return "txt"
+}
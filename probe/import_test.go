@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/pool"
+	"github.com/nfx/slrp/sources"
+	"github.com/nfx/slrp/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportFormat(t *testing.T) {
+	assert.Equal(t, "json", importFormat("application/json", nil))
+	assert.Equal(t, "csv", importFormat("text/csv; charset=utf-8", nil))
+	assert.Equal(t, "json", importFormat("", []byte(" [\"127.0.0.1:80\"]")))
+	assert.Equal(t, "txt", importFormat("", []byte("127.0.0.1:80")))
+}
+
+func TestImportEndpoint(t *testing.T) {
+	first := pmux.HttpProxy("127.0.0.1:2345")
+	second := pmux.Socks5Proxy("127.0.0.2:1080")
+	checker := approvingChecker{
+		first:  1 * time.Second,
+		second: 2 * time.Second,
+	}
+
+	stats := stats.NewStats()
+	history := history.NewHistory()
+	pool := pool.NewPool(history, ipinfo.NoopIpInfo{
+		Country: "Zimbabwe",
+	}, &net.Dialer{})
+	probe := NewProbe(stats, pool, checker)
+
+	runtime := app.Singletons{
+		"probe": probe,
+		"hist":  history,
+		"pool":  pool,
+		"stats": stats,
+	}.MockStart()
+	defer runtime.Stop()
+	runtime["stats"].Spin()
+	runtime["pool"].Spin()
+
+	_, err := probe.HttpPostByID("export", httptest.NewRequest("POST", "/api/probe/export", nil))
+	assert.EqualError(t, err, "unknown command: export")
+
+	_, err = probe.HttpPostByID("import", httptest.NewRequest("POST", "/api/probe/import?protocol=gopher", nil))
+	assert.EqualError(t, err, "unknown protocol: gopher")
+
+	body := strings.NewReader("127.0.0.1:2345\nnot a proxy\nftp://127.0.0.3:21\n127.0.0.2:1080 socks5\n")
+	res, err := probe.HttpPostByID("import", httptest.NewRequest("POST", "/api/probe/import", body))
+	require.NoError(t, err)
+	assert.Equal(t, imported{
+		Scheduled: 2,
+		Invalid:   []int{2, 3},
+	}, res)
+
+	<-runtime["probe"].Wait
+	<-runtime["probe"].Wait
+	assert.Equal(t, 2, pool.Len())
+
+	stat := stats.Snapshot()[sources.Import]
+	assert.Equal(t, 2, stat.Found)
+	assert.Equal(t, "import", sources.ByID(sources.Import).Name())
+}
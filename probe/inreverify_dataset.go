@@ -8,7 +8,11 @@ import (
 type inReverifyDataset []inReverify
 
 func (d inReverifyDataset) Query(query string) (*eval.QueryResult[inReverify], error) {
-	return (&eval.Dataset[inReverify, inReverifyDataset]{
+	return d.Dataset().Query(query)
+}
+
+func (d inReverifyDataset) Dataset() *eval.Dataset[inReverify, inReverifyDataset] {
+	return &eval.Dataset[inReverify, inReverifyDataset]{
 		Source: d,
 		Accessors: eval.Accessors{
 			"Proxy":    eval.StringGetter{Name: "Proxy", Func: d.getProxy},
@@ -45,7 +49,7 @@ func (d inReverifyDataset) Query(query string) (*eval.QueryResult[inReverify], e
 				},
 			}.Facets(filtered, topN)
 		},
-	}).Query(query)
+	}
 }
 
 func (d inReverifyDataset) getProxy(record int) string {
@@ -68,6 +68,9 @@ type internal struct {
 	stats            *stats.Stats
 	found            chan verify
 	snapshot         chan chan internal
+	sizes            chan chan stateSizes
+	pin              chan map[pmux.Proxy]bool
+	pinned           map[pmux.Proxy]bool
 }
 
 func newInternal(stats *stats.Stats, probing chan verify, buffer int) internal {
@@ -82,6 +85,9 @@ func newInternal(stats *stats.Stats, probing chan verify, buffer int) internal {
 		timeout:          make(chan failure, buffer),
 		found:            make(chan verify, buffer),
 		snapshot:         make(chan chan internal),
+		sizes:            make(chan chan stateSizes),
+		pin:              make(chan map[pmux.Proxy]bool),
+		pinned:           map[pmux.Proxy]bool{},
 		SeenSources:      make(map[pmux.Proxy]map[int]bool),
 		Seen:             make(map[pmux.Proxy]bool),
 		Blacklist:        make(map[pmux.Proxy]int),
@@ -108,6 +114,16 @@ func (i *internal) main(ctx app.Context) {
 		case response := <-i.snapshot:
 			i.hanldeSnapshot(response)
 
+		case response := <-i.sizes:
+			response <- stateSizes{
+				Reverify:  len(i.LastReverified),
+				Blacklist: len(i.Blacklist),
+				Seen:      len(i.Seen),
+			}
+
+		case pinned := <-i.pin:
+			i.pinned = pinned
+
 		case f := <-i.forget:
 			i.handleForget(f)
 			ctx.Heartbeat()
@@ -131,7 +147,7 @@ func (i *internal) main(ctx app.Context) {
 
 func (i *internal) handleScheduled(v verify) {
 	log := app.Log.From(v.ctx)
-	if v.Proxy == 0 {
+	if !v.Proxy.Valid() {
 		i.stats.Update(v.Source, stats.Ignored)
 		log.Trace().Msg("empty ip")
 		return
@@ -142,6 +158,10 @@ func (i *internal) handleScheduled(v verify) {
 	} else {
 		i.SeenSources[v.Proxy] = map[int]bool{v.Source: true}
 	}
+	if i.pinned[v.Proxy] {
+		// pinned proxies are probed, even if they failed before
+		delete(i.Blacklist, v.Proxy)
+	}
 	_, ok = i.Blacklist[v.Proxy]
 	if ok {
 		i.stats.Update(v.Source, stats.Ignored)
@@ -169,6 +189,20 @@ func (i *internal) handleScheduled(v verify) {
 	i.probing <- v
 }
 
+// stateSizes is a cheap alternative to snapshot for metrics
+type stateSizes struct {
+	Reverify  int
+	Blacklist int
+	Seen      int
+}
+
+func (p *internal) requestSizes() stateSizes {
+	request := make(chan stateSizes)
+	defer close(request)
+	p.sizes <- request
+	return <-request
+}
+
 func (p *internal) requestSnapshot() internal {
 	request := make(chan internal)
 	defer close(request)
@@ -177,6 +211,12 @@ func (p *internal) requestSnapshot() internal {
 }
 
 func (i *internal) hanldeSnapshot(response chan internal) {
+	response <- i.copy()
+}
+
+// copy returns the state without channels, that is safe to use outside
+// of the main loop
+func (i *internal) copy() internal {
 	snapshot := internal{
 		ReverifyCounter:  i.ReverifyCounter,
 		ReverifyAttempts: i.ReverifyAttempts,
@@ -204,14 +244,25 @@ func (i *internal) hanldeSnapshot(response chan internal) {
 			snapshot.SeenSources[k][s] = t
 		}
 	}
-	response <- snapshot
+	return snapshot
 }
 
 const Reverify int = 0
 
 func (i *internal) handleForget(f failure) {
-	i.stats.Update(f.v.Source, stats.Blacklisted)
 	log := app.Log.From(f.v.ctx)
+	if i.pinned[f.v.Proxy] {
+		// pinned proxies are never blacklisted, but retried later
+		i.stats.Update(f.v.Source, stats.Timeout)
+		i.LastReverified[f.v.Proxy] = reVerify{
+			Proxy:   f.v.Proxy,
+			Attempt: 1,
+			After:   time.Now().Add(30 * time.Minute).Unix(),
+		}
+		log.Info().Err(f.err).Msg("pinned proxy failed")
+		return
+	}
+	i.stats.Update(f.v.Source, stats.Blacklisted)
 	delete(i.LastReverified, f.v.Proxy)
 	if f.v.Source == Reverify {
 		i.ReverifyAttempts += int64(f.v.Attempt)
@@ -266,6 +317,10 @@ func (i *internal) handleReverify(ctx context.Context) {
 		// 	continue
 		// }
 		reverify[k] = v
+		if i.pinned[v.Proxy] {
+			// protocol of pinned proxies is known
+			continue
+		}
 		if v.Proxy.Proto() == pmux.HTTP {
 			reverify[k] = reVerify{
 				Proxy:   pmux.HttpsProxy(v.Proxy.Address()),
@@ -1,6 +1,7 @@
 package probe
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/nfx/slrp/app"
@@ -123,3 +124,47 @@ func TestInternalScheduleHandleReverify(t *testing.T) {
 	assert.Equal(t, "exceeded 5 reverifies", internal.Failures[0])
 	assert.Equal(t, 0, internal.Blacklist[proxy])
 }
+
+func TestInternalSchedulePinnedWasBlacklisted(t *testing.T) {
+	stats, runtime := app.MockStartSpin(stats.NewStats())
+	defer runtime.Stop()
+
+	probing := make(chan verify, 1)
+	internal := newInternal(stats, probing, 1)
+
+	proxy := pmux.HttpProxy("127.0.0.2:2345")
+	internal.Blacklist[proxy] = 0
+	internal.pinned = map[pmux.Proxy]bool{proxy: true}
+
+	internal.handleScheduled(verify{
+		ctx:    runtime.Context(),
+		Proxy:  proxy,
+		Source: 1,
+	})
+
+	assert.NotContains(t, internal.Blacklist, proxy)
+	assert.Equal(t, proxy, (<-probing).Proxy)
+}
+
+func TestInternalForgetPinned(t *testing.T) {
+	stats, runtime := app.MockStartSpin(stats.NewStats())
+	defer runtime.Stop()
+
+	internal := newInternal(stats, make(chan verify), 1)
+
+	proxy := pmux.HttpProxy("127.0.0.2:2345")
+	internal.pinned = map[pmux.Proxy]bool{proxy: true}
+
+	internal.handleForget(failure{
+		err: fmt.Errorf("evicted"),
+		v: verify{
+			ctx:     runtime.Context(),
+			Proxy:   proxy,
+			Attempt: 6,
+		},
+	})
+
+	assert.NotContains(t, internal.Blacklist, proxy)
+	assert.Equal(t, 1, internal.LastReverified[proxy].Attempt)
+	assert.Equal(t, proxy, internal.LastReverified[proxy].Proxy)
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// legacyInternal mirrors the state, as it was persisted before IPv6 support,
+// when proxies were packed into uint64
+type legacyInternal struct {
+	LastReverified   map[uint64]legacyReVerify
+	Blacklist        map[uint64]int
+	Seen             map[uint64]bool
+	SeenSources      map[uint64]map[int]bool
+	Failures         []string
+	ReverifyCounter  int64
+	ReverifyAttempts int64
+}
+
+type legacyReVerify struct {
+	Proxy   uint64
+	Attempt int
+	After   int64
+}
+
+// decode restores the state, that may still be in the format before IPv6 support
+func (i *internal) decode(data []byte) error {
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(i)
+	if err != nil {
+		legacyErr := i.decodeLegacy(data)
+		if legacyErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *internal) decodeLegacy(data []byte) error {
+	var legacy legacyInternal
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy)
+	if err != nil {
+		return err
+	}
+	i.LastReverified = make(map[pmux.Proxy]reVerify, len(legacy.LastReverified))
+	for k, v := range legacy.LastReverified {
+		i.LastReverified[pmux.LegacyProxy(k)] = reVerify{
+			Proxy:   pmux.LegacyProxy(v.Proxy),
+			Attempt: v.Attempt,
+			After:   v.After,
+		}
+	}
+	i.Blacklist = make(map[pmux.Proxy]int, len(legacy.Blacklist))
+	for k, v := range legacy.Blacklist {
+		i.Blacklist[pmux.LegacyProxy(k)] = v
+	}
+	i.Seen = make(map[pmux.Proxy]bool, len(legacy.Seen))
+	for k, v := range legacy.Seen {
+		i.Seen[pmux.LegacyProxy(k)] = v
+	}
+	i.SeenSources = make(map[pmux.Proxy]map[int]bool, len(legacy.SeenSources))
+	for k, v := range legacy.SeenSources {
+		i.SeenSources[pmux.LegacyProxy(k)] = v
+	}
+	i.Failures = legacy.Failures
+	i.ReverifyCounter = legacy.ReverifyCounter
+	i.ReverifyAttempts = legacy.ReverifyAttempts
+	return nil
+}
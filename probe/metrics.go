@@ -0,0 +1,69 @@
+package probe
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/sources"
+)
+
+// sourceName returns the name of the source or its ID, if the source is gone
+func sourceName(id int) string {
+	if id == Reverify {
+		return "reverify"
+	}
+	for _, v := range sources.All() {
+		if v.ID == id {
+			return v.Name()
+		}
+	}
+	return fmt.Sprint(id)
+}
+
+func (p *Probe) CollectMetrics(m *app.Metrics) {
+	queues := []struct {
+		name  string
+		depth int
+	}{
+		{"scheduled", len(p.state.scheduled)},
+		{"probing", len(p.probing)},
+		{"found", len(p.state.found)},
+		{"timeout", len(p.state.timeout)},
+		{"forget", len(p.state.forget)},
+	}
+	for _, q := range queues {
+		m.Gauge("slrp_probe_queue_depth", "Number of proxies waiting in probe queues",
+			float64(q.depth), "queue", q.name)
+	}
+	sizes := p.state.requestSizes()
+	m.Gauge("slrp_probe_reverify", "Number of proxies waiting to be verified again", float64(sizes.Reverify))
+	m.Gauge("slrp_probe_blacklist", "Number of blacklisted proxies", float64(sizes.Blacklist))
+	m.Gauge("slrp_probe_seen", "Number of proxies, that were found working", float64(sizes.Seen))
+
+	snapshot := p.stats.Snapshot()
+	ids := []int{}
+	for id := range snapshot {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		v := snapshot[id]
+		outcomes := []struct {
+			name  string
+			count int
+		}{
+			{"scheduled", v.Scheduled},
+			{"new", v.New},
+			{"probing", v.Probing},
+			{"found", v.Found},
+			{"timeout", v.Timeouts},
+			{"blacklisted", v.Blacklisted},
+			{"ignored", v.Ignored},
+		}
+		for _, o := range outcomes {
+			m.Gauge("slrp_probe_source_proxies", "Number of proxies from the latest refresh of a source by probe outcome",
+				float64(o.count), "source", sourceName(id), "outcome", o.name)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+)
+
+// Persisted is the state of the probe, as it is written to disk. It is read
+// and changed by commands, that work without starting the application.
+type Persisted struct {
+	internal
+}
+
+func (p *Persisted) UnmarshalBinary(data []byte) error {
+	return p.internal.decode(data)
+}
+
+func (p *Persisted) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(p.internal)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (p *Persisted) Snapshot() internal {
+	return p.internal
+}
+
+// Query returns proxies from "blacklist" or "reverify" dataset in the same
+// form, as the API does
+func (p *Persisted) Query(dataset, filter string, ipLookup ipinfo.IpInfoGetter) (any, error) {
+	switch dataset {
+	case "blacklist":
+		return (&blacklistDashboard{probe: p, info: ipLookup}).query(filter)
+	case "reverify":
+		return (&reverifyDashboard{Probe: p, Lookup: ipLookup}).query(filter)
+	default:
+		return nil, fmt.Errorf("unknown dataset: %s", dataset)
+	}
+}
+
+// Unblacklist removes the proxy from the blacklist, so that it is probed
+// again, once any of the sources finds it
+func (p *Persisted) Unblacklist(proxy pmux.Proxy) bool {
+	_, ok := p.Blacklist[proxy]
+	delete(p.Blacklist, proxy)
+	return ok
+}
@@ -0,0 +1,123 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// pinnedList holds proxies, that are always kept in rotation. They are
+// configured inline or in a file with one proxy URL per line, that is
+// re-read once it's modified.
+type pinnedList struct {
+	inline  []pmux.Proxy
+	file    string
+	refresh time.Duration
+	modTime time.Time
+	loaded  bool
+}
+
+func newPinnedList(c app.Config) (*pinnedList, error) {
+	pl := &pinnedList{
+		file:    c.StrOr("pinned_file", ""),
+		refresh: c.DurOr("pinned_refresh", 1*time.Minute),
+	}
+	for i, v := range c.ListOr("pinned") {
+		proxy := pmux.NewProxyFromURL(v)
+		if !proxy.Valid() {
+			// value is not logged, as it may contain credentials
+			return nil, fmt.Errorf("invalid pinned proxy #%d", i+1)
+		}
+		pl.inline = append(pl.inline, proxy)
+	}
+	return pl, nil
+}
+
+// load returns all pinned proxies and tells if they changed since the last call
+func (pl *pinnedList) load() ([]pmux.Proxy, bool, error) {
+	if pl.file == "" {
+		changed := !pl.loaded
+		pl.loaded = true
+		return pl.inline, changed, nil
+	}
+	info, err := os.Stat(pl.file)
+	if err != nil {
+		return nil, false, err
+	}
+	if pl.loaded && info.ModTime().Equal(pl.modTime) {
+		return nil, false, nil
+	}
+	raw, err := os.ReadFile(pl.file)
+	if err != nil {
+		return nil, false, err
+	}
+	proxies := append([]pmux.Proxy{}, pl.inline...)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	var line int
+	for scanner.Scan() {
+		line++
+		v := strings.TrimSpace(scanner.Text())
+		if v == "" || strings.HasPrefix(v, "#") {
+			continue
+		}
+		proxy := pmux.NewProxyFromURL(v)
+		if !proxy.Valid() {
+			return nil, false, fmt.Errorf("%s:%d: invalid proxy", pl.file, line)
+		}
+		proxies = append(proxies, proxy)
+	}
+	pl.modTime = info.ModTime()
+	pl.loaded = true
+	return proxies, true, nil
+}
+
+// watchPinned keeps pinned proxies in the pool and state, re-reading
+// the file once it changes
+func (p *Probe) watchPinned(ctx app.Context) {
+	log := app.Log.From(ctx.Ctx())
+	var tick <-chan time.Time
+	if p.pinned.file != "" {
+		ticker := time.NewTicker(p.pinned.refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		proxies, changed, err := p.pinned.load()
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot load pinned proxies")
+		} else if changed {
+			log.Info().Int("count", len(proxies)).Msg("pinned proxies")
+			p.pin(ctx.Ctx(), proxies)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		}
+	}
+}
+
+// pin replaces pinned proxies and schedules them for probing. Proxies
+// already in the pool are not probed again.
+func (p *Probe) pin(ctx context.Context, proxies []pmux.Proxy) {
+	pinned := make(map[pmux.Proxy]bool, len(proxies))
+	for _, proxy := range proxies {
+		pinned[proxy] = true
+	}
+	select {
+	case <-ctx.Done():
+		return
+	case p.state.pin <- pinned:
+	}
+	p.pool.Pin(ctx, proxies)
+	for _, proxy := range proxies {
+		p.Schedule(ctx, proxy, Reverify)
+	}
+}
@@ -32,12 +32,16 @@ type failure struct {
 }
 
 type Probe struct {
+	ctx     context.Context
 	pool    *pool.Pool
 	stats   *stats.Stats
 	checker checker.Checker
 	probing chan verify
 	state   internal
 	minute  *time.Ticker
+	pinned  *pinnedList
+	workers app.Group
+	loops   app.Group
 
 	// experimental feature to enable rescuing HTTP proxies,
 	// that were presented as SOCKS5 or HTTPS. Detected based
@@ -49,17 +53,19 @@ func NewProbe(stats *stats.Stats, p *pool.Pool, c checker.Checker) *Probe {
 	buffer := 512 // TODO: make configurable
 	probing := make(chan verify, buffer)
 	return &Probe{
+		ctx:     context.Background(),
 		pool:    p,
 		checker: c,
 		probing: probing,
 		stats:   stats,
 		minute:  time.NewTicker(1 * time.Minute),
 		state:   newInternal(stats, probing, buffer),
+		pinned:  &pinnedList{},
 	}
 }
 
 func (p *Probe) Schedule(ctx context.Context, proxy pmux.Proxy, source int) bool {
-	if proxy == 0 {
+	if !proxy.Valid() {
 		return false
 	}
 	p.stats.Update(source, stats.Scheduled)
@@ -68,7 +74,7 @@ func (p *Probe) Schedule(ctx context.Context, proxy pmux.Proxy, source int) bool
 }
 
 func (p *Probe) Forget(ctx context.Context, proxy pmux.Proxy, err error) bool {
-	if proxy == 0 {
+	if !proxy.Valid() {
 		return false
 	}
 	p.pool.Remove(proxy)
@@ -85,16 +91,58 @@ func (p *Probe) Forget(ctx context.Context, proxy pmux.Proxy, err error) bool {
 
 func (p *Probe) Configure(c app.Config) error {
 	p.enableHttpRescue = c.BoolOr("enable_http_rescue", false)
+	pinned, err := newPinnedList(c)
+	if err != nil {
+		return err
+	}
+	p.pinned = pinned
+	return nil
+}
+
+func (p *Probe) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "enable_http_rescue", Type: app.TypeBool, Default: "false",
+			Doc: "rescue HTTP proxies, that were presented as SOCKS5 or HTTPS"},
+		{Name: "pinned", Type: app.TypeList,
+			Doc: "proxy URLs, that are always kept in rotation"},
+		{Name: "pinned_file", Type: app.TypeString,
+			Doc: "file with one pinned proxy URL per line"},
+		{Name: "pinned_refresh", Type: app.TypeDuration, Default: "1m",
+			Doc: "how often to check pinned_file for changes"},
+	}
+}
+
+func (p *Probe) Start(ctx app.Context) error {
+	// imported proxies are probed after the request is served
+	p.ctx = ctx.Ctx()
+	loops := p.loops.Start(ctx)
+	p.loops.Go(func() { p.state.main(loops) })
+	workers := p.workers.Start(ctx)
+	p.workers.Go(func() { p.gatherEvictions(workers) })
+	p.workers.Go(func() { p.watchPinned(workers) })
+	for w := 0; w < 128; w++ { // TODO: make configurable
+		p.workers.Go(func() { p.worker(workers.Ctx()) })
+	}
 	return nil
 }
 
-func (p *Probe) Start(ctx app.Context) {
-	go p.state.main(ctx)
-	go p.gatherEvictions(ctx)
-	workers := 128 // TODO: make configurable
-	for w := 0; w < workers; w++ {
-		go p.worker(ctx.Ctx())
+// Stop lets workers finish in-flight checks and then stops the state loop,
+// so that results of checks are not lost before the state is flushed
+func (p *Probe) Stop(ctx context.Context) error {
+	err := p.workers.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("workers: %w", err)
 	}
+	return p.loops.Stop(ctx)
+}
+
+// snapshot copies the state through the main loop, or directly, once
+// the loop is stopped
+func (p *Probe) snapshot() internal {
+	if p.loops.Stopped() {
+		return p.state.copy()
+	}
+	return p.state.requestSnapshot()
 }
 
 func (p *Probe) gatherEvictions(ctx app.Context) {
@@ -122,14 +170,13 @@ func (p *Probe) gatherEvictions(ctx app.Context) {
 
 func (p *Probe) MarshalBinary() ([]byte, error) {
 	var b bytes.Buffer
-	state := p.state.requestSnapshot()
+	state := p.snapshot()
 	gob.NewEncoder(&b).Encode(state)
 	return b.Bytes(), nil
 }
 
 func (p *Probe) UnmarshalBinary(data []byte) error {
-	b := bytes.NewReader(data)
-	err := gob.NewDecoder(b).Decode(&p.state)
+	err := p.state.decode(data)
 	if err != nil {
 		return err
 	}
@@ -152,13 +199,35 @@ type Stats2 struct {
 }
 
 func (p *Probe) Snapshot() internal {
-	return p.state.requestSnapshot()
+	return p.snapshot()
+}
+
+// Ping goes through the main loop of probe state
+func (p *Probe) Ping(ctx context.Context) error {
+	out := make(chan stateSizes, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.state.sizes <- out:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-out:
+		return nil
+	}
 }
 
 func (p *Probe) HttpDeletetByID(id string, r *http.Request) (interface{}, error) {
-	// TODO: harden it
-	split := strings.SplitN(id, ":", 3)
-	proxy := pmux.NewProxy(fmt.Sprintf("%s:%s", split[1], split[2]), split[0])
+	// id is protocol followed by address, like http:[2001:db8::1]:8080
+	split := strings.SplitN(id, ":", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid proxy: %s", id)
+	}
+	proxy := pmux.NewProxy(split[1], split[0])
+	if !proxy.Valid() {
+		return nil, fmt.Errorf("invalid proxy: %s", id)
+	}
 	p.state.forget <- failure{
 		err: fmt.Errorf("manual remove"),
 		v: verify{
@@ -170,7 +239,7 @@ func (p *Probe) HttpDeletetByID(id string, r *http.Request) (interface{}, error)
 }
 
 func (p *Probe) HttpGet(_ *http.Request) (interface{}, error) {
-	state := p.state.requestSnapshot()
+	state := p.snapshot()
 	attempts := make([]int, maxReverifies+1)
 	for _, v := range state.LastReverified {
 		attempts[v.Attempt-1]++
@@ -185,14 +254,15 @@ func (p *Probe) HttpGet(_ *http.Request) (interface{}, error) {
 	contribution := map[string]int{}
 	// now that we have gaps...
 	var maxId int
-	for _, v := range sources.Sources {
+	all := sources.All()
+	for _, v := range all {
 		if v.ID > maxId {
 			maxId = v.ID
 		}
 	}
 	names := make([]string, maxId+2) // deleting last source is bad...
 	names[0] = "reverify"
-	for _, v := range sources.Sources {
+	for _, v := range all {
 		names[v.ID] = v.Name()
 	}
 	for ip, v := range state.SeenSources {
@@ -1,11 +1,14 @@
 package probe
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +19,7 @@ import (
 	"github.com/nfx/slrp/pool"
 	"github.com/nfx/slrp/stats"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type failingChecker map[pmux.Proxy]error
@@ -76,6 +80,42 @@ func TestBasicProbe(t *testing.T) {
 	assert.Equal(t, 1, s.Blacklist)
 }
 
+func TestCollectMetrics(t *testing.T) {
+	firstProxy := pmux.HttpProxy("127.0.0.1:2345")
+	checker := failingChecker{
+		firstProxy: fmt.Errorf("test failure"),
+	}
+
+	stats := stats.NewStats()
+	history := history.NewHistory()
+	pool := pool.NewPool(history, ipinfo.NoopIpInfo{}, &net.Dialer{})
+	probe := NewProbe(stats, pool, checker)
+
+	runtime := app.Singletons{
+		"probe": probe,
+		"hist":  history,
+		"pool":  pool,
+		"stats": stats,
+	}.MockStart()
+	defer runtime.Stop()
+	runtime["pool"].Spin()
+	runtime["stats"].Spin()
+
+	probe.Schedule(runtime.Context("probe"), firstProxy, 0)
+	<-runtime["probe"].Wait
+	runtime["probe"].Spin()
+
+	m := app.NewMetrics()
+	probe.CollectMetrics(m)
+	var sb strings.Builder
+	m.WriteTo(&sb)
+	out := sb.String()
+	assert.Contains(t, out, `slrp_probe_queue_depth{queue="scheduled"} 0`)
+	assert.Contains(t, out, `slrp_probe_blacklist 1`)
+	assert.Contains(t, out, `slrp_probe_reverify 0`)
+	assert.Contains(t, out, `slrp_probe_source_proxies{source="reverify",outcome="blacklisted"} 1`)
+}
+
 func TestProbeMarshaling(t *testing.T) {
 	secondProxy := pmux.HttpProxy("127.0.0.2:2345")
 
@@ -115,6 +155,37 @@ func TestProbeMarshaling(t *testing.T) {
 	assert.Equal(t, 0, loaded.state.failuresInverted["test failure"])
 }
 
+func TestUnmarshalLegacy(t *testing.T) {
+	// 127.0.0.2:2345 over http, as it was packed in uint64
+	packed := uint64(0x7f000002)<<32 | uint64(2345)<<16 | uint64(pmux.HTTP)
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(legacyInternal{
+		LastReverified: map[uint64]legacyReVerify{
+			packed: {Proxy: packed, Attempt: 2, After: 3},
+		},
+		Blacklist:   map[uint64]int{packed: 0},
+		Seen:        map[uint64]bool{packed: true},
+		SeenSources: map[uint64]map[int]bool{packed: {1: true}},
+		Failures:    []string{"test failure"},
+	})
+	require.NoError(t, err)
+
+	stats := stats.NewStats()
+	pool := pool.NewPool(history.NewHistory(), ipinfo.NoopIpInfo{
+		Country: "Zimbabwe",
+	}, &net.Dialer{})
+	loaded := NewProbe(stats, pool, failingChecker{})
+	err = loaded.UnmarshalBinary(b.Bytes())
+	require.NoError(t, err)
+
+	proxy := pmux.HttpProxy("127.0.0.2:2345")
+	assert.Equal(t, reVerify{Proxy: proxy, Attempt: 2, After: 3}, loaded.state.LastReverified[proxy])
+	assert.Contains(t, loaded.state.Blacklist, proxy)
+	assert.True(t, loaded.state.Seen[proxy])
+	assert.True(t, loaded.state.SeenSources[proxy][1])
+	assert.Equal(t, 0, loaded.state.failuresInverted["test failure"])
+}
+
 func TestProbeDeleting(t *testing.T) {
 	secondProxy := pmux.HttpProxy("127.0.0.2:2345")
 
@@ -144,7 +215,10 @@ func TestProbeDeleting(t *testing.T) {
 	<-runtime["probe"].Wait
 	assert.Equal(t, 1, pool.Len())
 
-	_, err := probe.HttpDeletetByID("http:127.0.0.2:2345", &http.Request{})
+	_, err := probe.HttpDeletetByID("http:127.0.0.2", &http.Request{})
+	assert.EqualError(t, err, "invalid proxy: http:127.0.0.2")
+
+	_, err = probe.HttpDeletetByID("http:127.0.0.2:2345", &http.Request{})
 	assert.NoError(t, err)
 
 	<-runtime["probe"].Wait
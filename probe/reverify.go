@@ -7,6 +7,7 @@ import (
 
 	"github.com/nfx/slrp/ipinfo"
 	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/ql/eval"
 	"github.com/nfx/slrp/sources"
 )
 
@@ -60,9 +61,13 @@ func (d *reverifyDashboard) snapshot() (found inReverifyDataset) {
 }
 
 func (d *reverifyDashboard) HttpGet(r *http.Request) (any, error) {
+	return d.query(r.FormValue("filter"))
+}
+
+func (d *reverifyDashboard) query(filter string) (*eval.QueryResult[inReverify], error) {
 	snapshot := d.snapshot()
 	if len(snapshot) == 0 {
 		return nil, fmt.Errorf("reverify is empty")
 	}
-	return snapshot.Query(r.FormValue("filter"))
+	return snapshot.Query(filter)
 }
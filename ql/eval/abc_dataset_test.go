@@ -4,7 +4,11 @@ package eval
 type AbcDataset []Abc
 
 func (d AbcDataset) Query(query string) (*QueryResult[Abc], error) {
-	return (&Dataset[Abc, AbcDataset]{
+	return d.Dataset().Query(query)
+}
+
+func (d AbcDataset) Dataset() *Dataset[Abc, AbcDataset] {
+	return &Dataset[Abc, AbcDataset]{
 		Source: d,
 		Accessors: Accessors{
 			"Bar":    NumberGetter{"Bar", d.getBar},
@@ -39,7 +43,7 @@ func (d AbcDataset) Query(query string) (*QueryResult[Abc], error) {
 				},
 			}.Facets(r, i)
 		},
-	}).Query(query)
+	}
 }
 
 func (d AbcDataset) getBar(record int) float64 {
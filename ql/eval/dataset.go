@@ -72,3 +72,51 @@ func (d Dataset[T, D]) Query(query string) (*QueryResult[T], error) {
 		Facets:  d.Facets(result, plan.Limit),
 	}, nil
 }
+
+// Predicate compiles the boolean expression without ORDER BY and LIMIT, so
+// that records of the source are matched one by one
+func (d Dataset[T, D]) Predicate(expr string) (func(record int) (bool, error), error) {
+	plan, err := internal.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Sort != nil || plan.Limit != 0 {
+		return nil, fmt.Errorf("ORDER BY and LIMIT are not allowed: %s", expr)
+	}
+	optimized := d.Transform(*plan)
+	err, ok := d.IsFailure(optimized)
+	if ok {
+		return nil, err
+	}
+	filter := optimized
+	query, ok := filter.(ast.Query)
+	if ok {
+		filter = query.Filter
+	}
+	switch filter.(type) {
+	case ast.And, ast.Or:
+	default:
+		if !d.IsBoolean(filter) {
+			return nil, fmt.Errorf("not a boolean expression: %s", expr)
+		}
+	}
+	return func(record int) (bool, error) {
+		return Filter(record, optimized)
+	}, nil
+}
+
+// Unlimited appends LIMIT to the query, so that all records of the dataset with
+// the given size are returned, unless the query is empty or has its own LIMIT
+func Unlimited(query string, size int) (string, error) {
+	if query == "" || size == 0 {
+		return query, nil
+	}
+	plan, err := internal.Parse(query)
+	if err != nil {
+		return "", err
+	}
+	if plan.Limit > 0 {
+		return query, nil
+	}
+	return fmt.Sprintf("%s LIMIT %d", query, size), nil
+}
@@ -229,3 +229,45 @@ func (tt check) run(t *testing.T) {
 		t.Logf("PLEASE FIX:\n%s", strings.Join(x, "\n"))
 	}
 }
+
+func TestUnlimited(t *testing.T) {
+	for query, expected := range map[string]string{
+		"":                        "",
+		"Active":                  "Active LIMIT 7",
+		"Active ORDER BY Bar":     "Active ORDER BY Bar LIMIT 7",
+		"Active LIMIT 2":          "Active LIMIT 2",
+		"Active ORDER BY Bar ASC": "Active ORDER BY Bar ASC LIMIT 7",
+	} {
+		unlimited, err := Unlimited(query, len(fixture))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, unlimited)
+	}
+
+	_, err := Unlimited("x $ y", 1)
+	assert.EqualError(t, err, "syntax error: unexpected $unk: x <<<$>>> y")
+}
+
+func TestPredicate(t *testing.T) {
+	match, err := fixture.Dataset().Predicate("Active AND Zuul = xxx")
+	assert.NoError(t, err)
+	var matched []int
+	for i := range fixture {
+		ok, err := match(i)
+		assert.NoError(t, err)
+		if ok {
+			matched = append(matched, fixture[i].Bar)
+		}
+	}
+	assert.Equal(t, []int{1, 3}, matched)
+
+	for expr, msg := range map[string]string{
+		"Active LIMIT 2":      "ORDER BY and LIMIT are not allowed: Active LIMIT 2",
+		"Active ORDER BY Bar": "ORDER BY and LIMIT are not allowed: Active ORDER BY Bar",
+		"Bar":                 "not a boolean expression: Bar",
+		"Bar AND Active":      "incompatible branches: (Bar@number AND Active@bool)",
+		"x $ y":               "syntax error: unexpected $unk: x <<<$>>> y",
+	} {
+		_, err := fixture.Dataset().Predicate(expr)
+		assert.EqualError(t, err, msg, expr)
+	}
+}
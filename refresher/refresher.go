@@ -92,20 +92,28 @@ type req struct {
 }
 
 type Refresher struct {
-	probe        probeContract
-	pool         poolContract
-	stats        statsContract
-	client       *http.Client
-	next         atomic.Value
-	progress     chan progress
-	finish       chan finish
-	snapshot     chan chan plan
-	sources      func() []sources.Source
-	reqs         chan req
-	active       map[int]*task
-	plan         plan
-	enabled      bool
-	maxScheduled int
+	probe         probeContract
+	pool          poolContract
+	stats         statsContract
+	client        *http.Client
+	next          atomic.Value
+	progress      chan progress
+	finish        chan finish
+	snapshot      chan chan plan
+	sources       func() []sources.Source
+	reqs          chan req
+	settings      chan settings
+	active        map[int]*task
+	plan          plan
+	enabled       bool
+	maxScheduled  int
+	watch         *sources.Directory
+	watchInterval time.Duration
+	halt          chan struct{}
+	halted        bool
+	runCtx        context.Context
+	runs          app.Group
+	loops         app.Group
 }
 
 type probeContract interface {
@@ -133,11 +141,13 @@ func NewRefresher(stats *stats.Stats, pool *pool.Pool, probe probeContract) *Ref
 		snapshot:     make(chan chan plan),
 		plan:         plan{},
 		reqs:         make(chan req),
+		settings:     make(chan settings),
+		halt:         make(chan struct{}),
 		active:       map[int]*task{},
 		enabled:      true,
 		maxScheduled: 5,
 		sources: func() []sources.Source {
-			return sources.Sources
+			return sources.All()
 		},
 		client: &http.Client{
 			Transport: pool,
@@ -148,11 +158,143 @@ func NewRefresher(stats *stats.Stats, pool *pool.Pool, probe probeContract) *Ref
 func (ref *Refresher) Configure(c app.Config) error {
 	ref.enabled = c.BoolOr("enabled", true)
 	ref.maxScheduled = c.IntOr("max_scheduled", 5)
+	declared := []sources.Source{}
+	file := c.StrOr("sources_file", "")
+	if file != "" {
+		srcs, err := sources.LoadDeclared(file)
+		if err != nil {
+			return err
+		}
+		declared = append(declared, srcs...)
+	}
+	dir := c.StrOr("plugins_dir", "")
+	if dir != "" {
+		srcs, err := sources.LoadPlugins(dir, c.DurOr("plugin_timeout", 5*time.Minute))
+		if err != nil {
+			return err
+		}
+		declared = append(declared, srcs...)
+	}
+	watchDir := c.StrOr("watch_dir", "")
+	if watchDir != "" {
+		ref.watch = sources.NewDirectory(watchDir)
+		ref.watchInterval = c.DurOr("watch_interval", 1*time.Minute)
+	}
+	return sources.Declare(declared)
+}
+
+func (ref *Refresher) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "enabled", Type: app.TypeBool, Default: "true",
+			Doc: "run the refresher"},
+		{Name: "max_scheduled", Type: app.TypeInt, Default: "5",
+			Doc: "number of sources to refresh at the same time"},
+		{Name: "sources_file", Type: app.TypeString,
+			Doc: "YAML file with user-defined sources. Changes require restart"},
+		{Name: "plugins_dir", Type: app.TypeString,
+			Doc: "directory with sources written in JavaScript. Changes require restart"},
+		{Name: "plugin_timeout", Type: app.TypeDuration, Default: "5m",
+			Doc: "time limit for a single refresh of a JavaScript source. Changes require restart"},
+		{Name: "watch_dir", Type: app.TypeString,
+			Doc: "directory with *.txt and *.csv proxy lists, that are refreshed on change. Changes require restart"},
+		{Name: "watch_interval", Type: app.TypeDuration, Default: "1m",
+			Doc: "how often to check files in watch_dir for changes"},
+	}
+}
+
+type settings struct {
+	enabled      bool
+	maxScheduled int
+}
+
+// Reconfigure applies settings between checks of sources
+func (ref *Refresher) Reconfigure(c app.Config) error {
+	s := settings{
+		enabled:      c.BoolOr("enabled", true),
+		maxScheduled: c.IntOr("max_scheduled", 5),
+	}
+	done := ref.loops.Done()
+	if done == nil {
+		// main loop is not started yet and picks settings up on start
+		ref.enabled = s.enabled
+		ref.maxScheduled = s.maxScheduled
+		return nil
+	}
+	select {
+	case <-done:
+		return fmt.Errorf("refresher is stopped")
+	case ref.settings <- s:
+		return nil
+	}
+}
+
+func (ref *Refresher) Start(ctx app.Context) error {
+	ref.runCtx = ref.runs.Start(ctx).Ctx()
+	loops := ref.loops.Start(ctx)
+	ref.loops.Go(func() { ref.main(loops) })
+	if ref.watch != nil {
+		ref.loops.Go(func() { ref.watchFiles(loops) })
+	}
 	return nil
 }
 
-func (ref *Refresher) Start(ctx app.Context) {
-	go ref.main(ctx)
+// Stop prevents new refreshes, cancels the running ones and waits for them
+// to report the outcome to stats
+func (ref *Refresher) Stop(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ref.halt <- struct{}{}:
+	}
+	err := ref.runs.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("runs: %w", err)
+	}
+	return ref.loops.Stop(ctx)
+}
+
+// runContext is the parent of source refreshes, that is cancelled on Stop
+func (ref *Refresher) runContext() context.Context {
+	if ref.runCtx == nil {
+		return context.Background()
+	}
+	return ref.runCtx
+}
+
+// watchFiles polls the watched directory and starts sources of files,
+// that were changed. Files of sources, that are still running, stay
+// changed and are started on one of the next scans.
+func (ref *Refresher) watchFiles(ctx app.Context) {
+	log := app.Log.From(ctx.Ctx())
+	ticker := time.NewTicker(ref.watchInterval)
+	defer ticker.Stop()
+	for {
+		changed, err := ref.watch.Scan(ctx.Ctx())
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan watched directory")
+		}
+		for _, name := range changed {
+			res := make(chan error)
+			select {
+			case <-ctx.Done():
+				return
+			case ref.reqs <- req{
+				name: name,
+				cmd:  "start",
+				err:  res,
+			}:
+			}
+			err = <-res
+			if err != nil {
+				log.Debug().Err(err).Str("source", name).Msg("postponed refresh")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 func (ref *Refresher) main(ctx app.Context) {
@@ -206,11 +348,16 @@ func (ref *Refresher) main(ctx app.Context) {
 			ctx.Heartbeat()
 		case r := <-ref.reqs:
 			r.err <- ref.handleReq(r)
+		case s := <-ref.settings:
+			ref.enabled = s.enabled
+			ref.maxScheduled = s.maxScheduled
+		case <-ref.halt:
+			ref.halted = true
 		case <-start:
-			if !ref.enabled {
+			if !ref.enabled || ref.halted {
 				continue
 			}
-			next = ref.checkSources(ctx.Ctx(), next)
+			next = ref.checkSources(ref.runContext(), next)
 			ref.next.Store(next)
 			log.Trace().
 				Stringer("next", time.Until(next)).
@@ -225,8 +372,7 @@ func (ref *Refresher) handleReq(r req) error {
 	if s.Name() == "unknown" {
 		return fmt.Errorf("invalid source '%s'", r.name)
 	}
-	ctx := context.Background()
-	ctx = app.Log.WithStr(ctx, "source", s.Name())
+	ctx := app.Log.WithStr(ref.runContext(), "source", s.Name())
 	switch r.cmd {
 	case "start":
 		return ref.start(ctx, s)
@@ -244,6 +390,22 @@ func (ref *Refresher) Snapshot() plan {
 	return <-out
 }
 
+// Ping goes through the main loop
+func (ref *Refresher) Ping(ctx context.Context) error {
+	out := make(chan plan, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ref.snapshot <- out:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-out:
+		return nil
+	}
+}
+
 func (ref *Refresher) HttpGet(_ *http.Request) (any, error) {
 	return ref.upcoming(), nil
 }
@@ -262,6 +424,9 @@ func (ref *Refresher) HttpPostByID(name string, r *http.Request) (any, error) {
 func (ref *Refresher) start(ctx context.Context, source sources.Source) error {
 	log := app.Log.From(ctx)
 	log.Info().Msg("starting")
+	if ref.halted {
+		return fmt.Errorf("refresher is stopping")
+	}
 	_, ok := ref.active[source.ID]
 	if ok {
 		return fmt.Errorf("source %s is running", source.Name())
@@ -276,7 +441,7 @@ func (ref *Refresher) start(ctx context.Context, source sources.Source) error {
 		source: &source,
 		cancel: cancel,
 	}
-	go ref.refresh(tctx, client, source)
+	ref.runs.Go(func() { ref.refresh(tctx, client, source) })
 	return nil
 }
 
@@ -371,12 +536,12 @@ func (ref *Refresher) checkSources(ctx context.Context, trigger time.Time) time.
 		if len(ref.active) > ref.maxScheduled {
 			return trigger.Add(1 * time.Minute)
 		}
-		sctx := app.Log.WithStr(ctx, "source", s.Name())
-		log := app.Log.From(sctx)
 		if s.Feed == nil {
-			log.Error().Msg("feed is nil")
+			// proxies of sources without feed, like import, are pushed
 			continue
 		}
+		sctx := app.Log.WithStr(ctx, "source", s.Name())
+		log := app.Log.From(sctx)
 		if snapshot.IsRunning(s.ID) {
 			log.Trace().Msg("still refreshing")
 			continue
@@ -439,3 +604,25 @@ func (ref *Refresher) refresh(ctx context.Context, client *http.Client, source s
 	log.Info().Msg("finished refresh")
 	ref.finish <- finish{source.ID, ctx, feed.Err()}
 }
+
+func (ref *Refresher) CollectMetrics(m *app.Metrics) {
+	snapshot := ref.stats.Snapshot()
+	for _, s := range ref.sources() {
+		v, ok := snapshot[s.ID]
+		if !ok {
+			continue
+		}
+		for _, state := range []string{"idle", "running", "failed"} {
+			var value float64
+			if string(v.State) == state {
+				value = 1
+			}
+			m.Gauge("slrp_refresher_source_state", "Current state of a source refresh",
+				value, "source", s.Name(), "state", state)
+		}
+		m.Gauge("slrp_refresher_source_progress", "Progress of the latest source refresh in percent",
+			float64(v.Progress), "source", s.Name())
+		m.Gauge("slrp_refresher_source_updated", "Unix time of the latest update of a source refresh",
+			float64(v.Updated.Unix()), "source", s.Name())
+	}
+}
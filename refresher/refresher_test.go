@@ -3,11 +3,17 @@ package refresher
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
 	"github.com/nfx/slrp/sources"
+	"github.com/nfx/slrp/stats"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -241,3 +247,154 @@ func TestRefreshSessionSource(t *testing.T) {
 	<-finish
 	assert.Equal(t, 1, counter[3])
 }
+
+func TestCollectMetrics(t *testing.T) {
+	ref := withStats(&Refresher{
+		sources: func() []sources.Source {
+			return []sources.Source{
+				stubSource[0],
+				stubSource[1],
+			}
+		},
+	})
+	ref.stats.Launch(2)
+	m := app.NewMetrics()
+	ref.CollectMetrics(m)
+	var sb strings.Builder
+	m.WriteTo(&sb)
+	assert.Contains(t, sb.String(), `slrp_refresher_source_state{source="src:2",state="running"} 1`)
+	assert.Contains(t, sb.String(), `slrp_refresher_source_state{source="src:1",state="idle"} 0`)
+	assert.Contains(t, sb.String(), `slrp_refresher_source_progress{source="src:2"} 0`)
+}
+
+func TestReconfigure(t *testing.T) {
+	ref := withStats(&Refresher{
+		settings: make(chan settings),
+		snapshot: make(chan chan plan),
+		sources: func() []sources.Source {
+			return []sources.Source{}
+		},
+	})
+	defer app.MockStart(ref)()
+
+	err := ref.Reconfigure(app.Config{
+		"enabled":       "false",
+		"max_scheduled": "7",
+	})
+	assert.NoError(t, err)
+
+	// snapshot goes through the same loop
+	ref.Snapshot()
+	assert.False(t, ref.enabled)
+	assert.Equal(t, 7, ref.maxScheduled)
+}
+
+func TestReconfigureBeforeStart(t *testing.T) {
+	ref := &Refresher{settings: make(chan settings)}
+	err := ref.Reconfigure(app.Config{
+		"enabled":       "false",
+		"max_scheduled": "7",
+	})
+	assert.NoError(t, err)
+	assert.False(t, ref.enabled)
+	assert.Equal(t, 7, ref.maxScheduled)
+}
+
+func TestReconfigureAfterStop(t *testing.T) {
+	ref := &Refresher{settings: make(chan settings)}
+	ctx := ref.loops.Start(app.MockCtx())
+	ref.loops.Go(func() { <-ctx.Done() })
+	assert.NoError(t, ref.loops.Stop(context.Background()))
+
+	err := ref.Reconfigure(app.Config{})
+	assert.EqualError(t, err, "refresher is stopped")
+}
+
+func TestConfigureDeclaredSources(t *testing.T) {
+	defer func(orig []sources.Source) {
+		sources.Sources = orig
+	}(sources.Sources)
+	file := filepath.Join(t.TempDir(), "sources.yml")
+	err := os.WriteFile(file, []byte(`
+- name: example
+  urls:
+    socks5: [https://example.com/socks5.txt]
+  frequency: 15m
+`), 0600)
+	assert.NoError(t, err)
+
+	ref := NewRefresher(nil, nil, nil)
+	err = ref.Configure(app.Config{
+		"sources_file": file,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, sources.ByName("example").Frequency)
+
+	err = ref.Configure(app.Config{
+		"sources_file": file + ".missing",
+	})
+	assert.ErrorContains(t, err, "no such file or directory")
+}
+
+type watchProbe chan string
+
+func (w watchProbe) Schedule(ctx context.Context, proxy pmux.Proxy, source int) bool {
+	w <- "+" + proxy.String()
+	return true
+}
+
+func (w watchProbe) Forget(ctx context.Context, proxy pmux.Proxy, err error) bool {
+	w <- "-" + proxy.String() + " " + err.Error()
+	return true
+}
+
+type watchStats chan int
+
+func (w watchStats) Launch(source int) {}
+
+func (w watchStats) Finish(source int, err error) {
+	w <- source
+}
+
+func (w watchStats) Snapshot() stats.Sources {
+	return stats.Sources{}
+}
+
+func TestWatchFiles(t *testing.T) {
+	defer func(orig []sources.Source) {
+		sources.Sources = orig
+	}(sources.Sources)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "socks5.txt")
+	err := os.WriteFile(file, []byte("127.0.0.1:1080\n127.0.0.2:1080\n"), 0600)
+	assert.NoError(t, err)
+
+	probe := watchProbe(make(chan string))
+	finished := watchStats(make(chan int))
+	ref := NewRefresher(nil, nil, probe)
+	ref.stats = finished
+	err = ref.Configure(app.Config{
+		"enabled":        "false",
+		"watch_dir":      dir,
+		"watch_interval": "1s",
+	})
+	assert.NoError(t, err)
+	defer app.MockStart(ref)()
+
+	added := []string{<-probe, <-probe}
+	sort.Strings(added)
+	assert.Equal(t, []string{"+socks5://127.0.0.1:1080", "+socks5://127.0.0.2:1080"}, added)
+	assert.Equal(t, sources.ByName("file:socks5.txt").ID, <-finished)
+
+	err = os.WriteFile(file, []byte("127.0.0.2:1080\n"), 0600)
+	assert.NoError(t, err)
+	err = os.Chtimes(file, time.Now(), time.Now().Add(1*time.Minute))
+	assert.NoError(t, err)
+	changed := []string{<-probe, <-probe}
+	sort.Strings(changed)
+	assert.Equal(t, []string{
+		"+socks5://127.0.0.2:1080",
+		"-socks5://127.0.0.1:1080 removed from file:socks5.txt",
+	}, changed)
+	<-finished
+}
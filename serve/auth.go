@@ -0,0 +1,92 @@
+package serve
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+)
+
+// sessionSuffix in the username, like alice-session-abc, keeps sticky session
+// abc for the authenticated user alice
+const sessionSuffix = "-session-"
+
+// proxyAuth checks clients of the proxy listener by their address and
+// Basic credentials in Proxy-Authorization header
+type proxyAuth struct {
+	allow app.Allowlist
+	users map[string]string
+}
+
+func newProxyAuth(c app.Config) (*proxyAuth, error) {
+	allow, err := app.ParseAllowlist(c.ListOr("allow"))
+	if err != nil {
+		return nil, err
+	}
+	auth := &proxyAuth{
+		allow: allow,
+		users: map[string]string{},
+	}
+	for _, v := range c.ListOr("users") {
+		user, password, ok := strings.Cut(v, ":")
+		if !ok || user == "" || strings.Contains(user, sessionSuffix) {
+			return nil, fmt.Errorf("invalid user: expected user:password")
+		}
+		auth.users[user] = password
+	}
+	return auth, nil
+}
+
+// check replies with an error status, if the client is not allowed. Credentials
+// are removed from the request, unless they carry a sticky session.
+func (pa *proxyAuth) check(rw http.ResponseWriter, r *http.Request) bool {
+	if pa == nil {
+		return true
+	}
+	if !pa.allow.Allows(r.RemoteAddr) {
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	if len(pa.users) == 0 {
+		return true
+	}
+	user, ok := pa.authenticate(r.Header.Get("Proxy-Authorization"))
+	if !ok {
+		rw.Header().Set("Proxy-Authenticate", `Basic realm="slrp"`)
+		http.Error(rw, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+		return false
+	}
+	if !strings.Contains(user, sessionSuffix) {
+		// otherwise the pool keeps all requests of the user on a single proxy
+		r.Header.Del("Proxy-Authorization")
+	}
+	return true
+}
+
+// authenticate returns username from valid Basic credentials
+func (pa *proxyAuth) authenticate(header string) (string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	user, password, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return "", false
+	}
+	base, _, _ := strings.Cut(user, sessionSuffix)
+	expected, ok := pa.users[base]
+	if !ok {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+		return "", false
+	}
+	return user, true
+}
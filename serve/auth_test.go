@@ -0,0 +1,82 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nfx/slrp/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyAuth(t *testing.T) {
+	_, err := newProxyAuth(app.Config{"users": "alice"})
+	assert.EqualError(t, err, "invalid user: expected user:password")
+	_, err = newProxyAuth(app.Config{"users": "a-session-b:c"})
+	assert.EqualError(t, err, "invalid user: expected user:password")
+	_, err = newProxyAuth(app.Config{"allow": "nope"})
+	assert.EqualError(t, err, "invalid allow entry: nope")
+
+	auth, err := newProxyAuth(app.Config{
+		"users": "alice:secret,bob:",
+		"allow": "192.0.2.0/24",
+	})
+	require.NoError(t, err)
+	check := func(prepare func(r *http.Request)) (*http.Request, *httptest.ResponseRecorder, bool) {
+		r := httptest.NewRequest("CONNECT", "example.com:443", nil)
+		prepare(r)
+		rw := httptest.NewRecorder()
+		ok := auth.check(rw, r)
+		return r, rw, ok
+	}
+	basic := func(user, password string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.SetBasicAuth(user, password)
+			r.Header.Set("Proxy-Authorization", r.Header.Get("Authorization"))
+			r.Header.Del("Authorization")
+		}
+	}
+
+	_, rw, ok := check(func(r *http.Request) {})
+	assert.False(t, ok)
+	assert.Equal(t, 407, rw.Code)
+	assert.Equal(t, `Basic realm="slrp"`, rw.Header().Get("Proxy-Authenticate"))
+
+	_, rw, ok = check(basic("alice", "wrong"))
+	assert.False(t, ok)
+	assert.Equal(t, 407, rw.Code)
+
+	r, _, ok := check(basic("alice", "secret"))
+	assert.True(t, ok)
+	assert.Equal(t, "", r.Header.Get("Proxy-Authorization"))
+
+	r, _, ok = check(basic("bob", ""))
+	assert.True(t, ok)
+
+	// sticky session is kept for the pool
+	r, _, ok = check(basic("alice-session-abc", "secret"))
+	assert.True(t, ok)
+	assert.NotEqual(t, "", r.Header.Get("Proxy-Authorization"))
+
+	_, rw, ok = check(func(r *http.Request) {
+		basic("alice", "secret")(r)
+		r.RemoteAddr = "198.51.100.1:1234"
+	})
+	assert.False(t, ok)
+	assert.Equal(t, 403, rw.Code)
+
+	var nobody *proxyAuth
+	assert.True(t, nobody.check(httptest.NewRecorder(), r))
+}
+
+func TestMitmProxyAuthRequired(t *testing.T) {
+	mitm := NewMitmProxyServer(nil, defaultCA)
+	err := mitm.Configure(app.Config{"users": "alice:secret"})
+	require.NoError(t, err)
+	defer mitm.Close()
+
+	rw := httptest.NewRecorder()
+	mitm.ServeHTTP(rw, httptest.NewRequest("GET", "http://example.com/", nil))
+	assert.Equal(t, 407, rw.Code)
+}
@@ -1,16 +1,27 @@
 package serve
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
 	"math/big"
 	mrand "math/rand"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/nfx/slrp/app"
+
+	"github.com/rs/zerolog/log"
 )
 
 func init() {
@@ -18,34 +29,261 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	defaultCA = &ca
+	defaultCA = ca
 }
 
 var defaultCA *certWrapper
 
+// certWrapper is the certificate authority, that signs certificates for
+// intercepted hosts. It is persisted either in the state directory or in
+// the configured PEM file, so that clients have to trust it only once.
 type certWrapper struct {
 	Bytes       []byte
 	Certificate *x509.Certificate
-	PrivateKey  *ecdsa.PrivateKey
+	PrivateKey  crypto.Signer
+
+	file      string
+	generated bool
+	leaves    *leafCache
+}
+
+func NewCA() (*certWrapper, error) {
+	ca := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		// random serial, so that browsers don't reject regenerated CA
+		SerialNumber: big.NewInt(mrand.Int63()),
+		Subject: pkix.Name{
+			Organization: []string{"Untrusted MITM Proxy, INC"},
+		},
+		NotBefore: time.Now().Add(-1 * time.Hour),
+		NotAfter:  time.Now().AddDate(10, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth,
+			x509.ExtKeyUsageServerAuth,
+		},
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	res, err := certificateAndPrivateKey(ca, ca, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.generated = true
+	res.leaves = newLeafCache(1024)
+	return res, nil
+}
+
+func (c *certWrapper) Configure(conf app.Config) error {
+	c.leaves = newLeafCache(conf.IntOr("leaf_cache", 1024))
+	c.file = conf.StrOr("file", "")
+	if c.file == "" {
+		// certificate is loaded from the state directory, if present
+		return nil
+	}
+	raw, err := os.ReadFile(c.file)
+	if os.IsNotExist(err) {
+		return c.save()
+	}
+	if err != nil {
+		return err
+	}
+	err = c.UnmarshalPEM(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.file, err)
+	}
+	log.Info().Str("file", c.file).Msg("loaded CA")
+	return nil
+}
+
+func (c *certWrapper) ConfigSchema() app.Schema {
+	return app.Schema{
+		{Name: "file", Type: app.TypeString,
+			Doc: "PEM file with CA certificate and private key"},
+		{Name: "leaf_cache", Type: app.TypeInt, Default: "1024",
+			Doc: "number of signed host certificates kept in memory"},
+	}
+}
+
+func (c *certWrapper) Start(ctx app.Context) error {
+	if c.generated && c.file == "" {
+		// flush newly generated certificate to the state directory.
+		// fabric starts accepting heartbeats only after all services start
+		go ctx.Heartbeat()
+	}
+	return nil
+}
+
+func (c *certWrapper) save() error {
+	err := os.MkdirAll(filepath.Dir(c.file), 0700)
+	if err != nil {
+		return err
+	}
+	raw, err := c.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(c.file, raw, 0600)
+	if err != nil {
+		return err
+	}
+	c.generated = false
+	log.Info().Str("file", c.file).Msg("generated CA")
+	return nil
+}
+
+// MarshalPEM returns certificate and private key as PEM blocks
+func (c *certWrapper) MarshalPEM() ([]byte, error) {
+	key, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	raw := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Bytes})
+	return append(raw, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})...), nil
+}
+
+// UnmarshalPEM loads certificate and private key from PEM blocks
+func (c *certWrapper) UnmarshalPEM(raw []byte) (err error) {
+	var cert *x509.Certificate
+	var key crypto.Signer
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return err
+			}
+		case "PRIVATE KEY", "EC PRIVATE KEY", "RSA PRIVATE KEY":
+			key, err = parsePrivateKey(block)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if cert == nil {
+		return fmt.Errorf("no certificate found")
+	}
+	if key == nil {
+		return fmt.Errorf("no private key found")
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("not a certificate authority: %s", cert.Subject)
+	}
+	// all public keys of the standard library implement Equal
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+	if time.Now().After(cert.NotAfter) {
+		return fmt.Errorf("certificate authority expired at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	c.Bytes = cert.Raw
+	c.Certificate = cert
+	c.PrivateKey = key
+	c.generated = false
+	if c.leaves != nil {
+		c.leaves.reset()
+	}
+	return nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key: %T", key)
+	}
+	return signer, nil
+}
+
+func (c *certWrapper) MarshalBinary() ([]byte, error) {
+	return c.MarshalPEM()
+}
+
+func (c *certWrapper) UnmarshalBinary(data []byte) error {
+	if c.file != "" {
+		// configured file always takes priority over the state
+		return nil
+	}
+	return c.UnmarshalPEM(data)
+}
+
+// HttpGet serves CA certificate, so that clients could install it.
+// Use ?format=der for binary encoding.
+func (c *certWrapper) HttpGet(r *http.Request) (any, error) {
+	if r.FormValue("format") == "der" {
+		return app.Raw{
+			ContentType: "application/x-x509-ca-cert",
+			Filename:    "slrp-ca.crt",
+			Body:        c.Bytes,
+		}, nil
+	}
+	return app.Raw{
+		ContentType: "application/x-pem-file",
+		Filename:    "slrp-ca.pem",
+		Body:        pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Bytes}),
+	}, nil
 }
 
 func (c *certWrapper) Config() *tls.Config {
 	return &tls.Config{
-		Certificates: []tls.Certificate{{
-			Certificate: [][]byte{c.Bytes},
-			PrivateKey:  c.PrivateKey,
-		}},
+		// certificate is resolved on handshake, as it may be loaded
+		// from the state after the server is created
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &tls.Certificate{
+				Certificate: [][]byte{c.Bytes},
+				PrivateKey:  c.PrivateKey,
+			}, nil
+		},
 		NextProtos: []string{"http/1.1"},
 	}
 }
 
+// Sign returns a certificate for the host, that may also include the port
 func (c *certWrapper) Sign(host string) (*tls.Certificate, error) {
+	hostname, _, err := net.SplitHostPort(host)
+	if err == nil {
+		host = hostname
+	}
+	if c.leaves == nil {
+		return c.sign(host)
+	}
+	cert, ok := c.leaves.get(host)
+	if ok {
+		return cert, nil
+	}
+	cert, err = c.sign(host)
+	if err != nil {
+		return nil, err
+	}
+	c.leaves.put(host, cert)
+	return cert, nil
+}
+
+func (c *certWrapper) sign(host string) (*tls.Certificate, error) {
+	notAfter := time.Now().AddDate(0, 3, 0)
+	if notAfter.After(c.Certificate.NotAfter) {
+		notAfter = c.Certificate.NotAfter
+	}
 	t := &x509.Certificate{
 		SerialNumber: big.NewInt(mrand.Int63()),
 		Issuer:       c.Certificate.Subject,
 		Subject:      c.Certificate.Subject,
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().AddDate(0, 3, 0),
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     notAfter,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 	}
@@ -54,49 +292,95 @@ func (c *certWrapper) Sign(host string) (*tls.Certificate, error) {
 		t.IPAddresses = append(t.IPAddresses, ip)
 	} else {
 		t.DNSNames = append(t.DNSNames, host)
-		t.Subject.CommonName = host
 	}
-	hostCert, err := certificateAndPrivateKey(t, c.Certificate)
+	t.Subject.CommonName = host
+	hostCert, err := certificateAndPrivateKey(t, c.Certificate, c.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 	tlsCert := &tls.Certificate{
 		Certificate: [][]byte{hostCert.Bytes, c.Bytes},
 		PrivateKey:  hostCert.PrivateKey,
+		Leaf:        hostCert.Certificate,
 	}
 	return tlsCert, nil
 }
 
-func NewCA() (res certWrapper, err error) {
-	ca := &x509.Certificate{
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		SerialNumber:          big.NewInt(2022),
-		Subject: pkix.Name{
-			Organization: []string{"Untrusted MITM Proxy, INC"},
-		},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().AddDate(0, 3, 0),
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth,
-			x509.ExtKeyUsageServerAuth,
-		},
-		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+// certificateAndPrivateKey generates new key and certificate signed by parent
+// key. Certificate is self-signed, if parent key is not given.
+func certificateAndPrivateKey(cert, parent *x509.Certificate, parentKey crypto.Signer) (*certWrapper, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
 	}
-	return certificateAndPrivateKey(ca, ca)
-}
-
-func certificateAndPrivateKey(cert, parent *x509.Certificate) (res certWrapper, err error) {
-	res.Certificate = cert
-	// res.children = map[string]*tls.Certificate{}
-	res.PrivateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if parentKey == nil {
+		parentKey = key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, cert, parent, &key.PublicKey, parentKey)
 	if err != nil {
-		return
+		return nil, err
 	}
-	res.Bytes, err = x509.CreateCertificate(rand.Reader, cert, parent,
-		&res.PrivateKey.PublicKey, res.PrivateKey)
+	parsed, err := x509.ParseCertificate(raw)
 	if err != nil {
+		return nil, err
+	}
+	return &certWrapper{
+		Bytes:       raw,
+		Certificate: parsed,
+		PrivateKey:  key,
+	}, nil
+}
+
+// leafCache keeps signed certificates per host, so that every CONNECT to
+// the same host doesn't generate a new key. Oldest entries are evicted first.
+type leafCache struct {
+	mu    sync.Mutex
+	size  int
+	order []string
+	certs map[string]*tls.Certificate
+}
+
+func newLeafCache(size int) *leafCache {
+	return &leafCache{
+		size:  size,
+		certs: map[string]*tls.Certificate{},
+	}
+}
+
+func (lc *leafCache) get(host string) (*tls.Certificate, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	cert, ok := lc.certs[host]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().Add(24 * time.Hour).After(cert.Leaf.NotAfter) {
+		// re-sign certificates, that are about to expire
+		return nil, false
+	}
+	return cert, true
+}
+
+func (lc *leafCache) put(host string, cert *tls.Certificate) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.size <= 0 {
 		return
 	}
-	return res, nil
+	_, ok := lc.certs[host]
+	if !ok {
+		lc.order = append(lc.order, host)
+	}
+	lc.certs[host] = cert
+	for len(lc.order) > lc.size {
+		delete(lc.certs, lc.order[0])
+		lc.order = lc.order[1:]
+	}
+}
+
+func (lc *leafCache) reset() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.order = nil
+	lc.certs = map[string]*tls.Certificate{}
 }
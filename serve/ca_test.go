@@ -1,9 +1,19 @@
 package serve
 
 import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/nfx/slrp/app"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSignHost(t *testing.T) {
@@ -13,3 +23,149 @@ func TestSignHost(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, mitm)
 }
+
+func TestSignVerifies(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+
+	for host, name := range map[string]string{
+		"example.com:443": "example.com",
+		"127.0.0.1:8443":  "127.0.0.1",
+		"example.org":     "example.org",
+	} {
+		cert, err := ca.Sign(host)
+		require.NoError(t, err)
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{
+			DNSName: name,
+			Roots:   roots,
+		})
+		assert.NoError(t, err, host)
+	}
+}
+
+func TestSignCachesLeaves(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+	ca.leaves = newLeafCache(1)
+
+	first, err := ca.Sign("example.com:443")
+	require.NoError(t, err)
+	second, err := ca.Sign("example.com:8443")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	_, err = ca.Sign("example.org:443")
+	require.NoError(t, err)
+	third, err := ca.Sign("example.com:443")
+	require.NoError(t, err)
+	assert.NotSame(t, first, third)
+}
+
+func TestCAStateRoundTrip(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+	raw, err := ca.MarshalBinary()
+	require.NoError(t, err)
+
+	loaded, err := NewCA()
+	require.NoError(t, err)
+	err = loaded.UnmarshalBinary(raw)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Bytes, loaded.Bytes)
+	assert.False(t, loaded.generated)
+
+	err = loaded.UnmarshalBinary([]byte("nope"))
+	assert.EqualError(t, err, "no certificate found")
+
+	certOnly := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Bytes})
+	err = loaded.UnmarshalBinary(certOnly)
+	assert.EqualError(t, err, "no private key found")
+}
+
+func TestCAFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nested", "ca.pem")
+	conf := app.Config{"file": file}
+
+	ca, err := NewCA()
+	require.NoError(t, err)
+	err = ca.Configure(conf)
+	require.NoError(t, err)
+
+	stat, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	restarted, err := NewCA()
+	require.NoError(t, err)
+	err = restarted.Configure(conf)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Bytes, restarted.Bytes)
+
+	// state is ignored when file is configured
+	other, err := NewCA()
+	require.NoError(t, err)
+	state, err := other.MarshalBinary()
+	require.NoError(t, err)
+	err = restarted.UnmarshalBinary(state)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Bytes, restarted.Bytes)
+
+	err = os.WriteFile(file, []byte("garbage"), 0600)
+	require.NoError(t, err)
+	err = restarted.Configure(conf)
+	assert.EqualError(t, err, file+": no certificate found")
+
+	notAfter := time.Now().Add(-1 * time.Hour).UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	expired, err := certificateAndPrivateKey(template, template, nil)
+	require.NoError(t, err)
+	raw, err := expired.MarshalPEM()
+	require.NoError(t, err)
+	err = os.WriteFile(file, raw, 0600)
+	require.NoError(t, err)
+	err = restarted.Configure(conf)
+	assert.EqualError(t, err, fmt.Sprintf("%s: certificate authority expired at %s",
+		file, notAfter.Format(time.RFC3339)))
+}
+
+func TestCAKeyMismatch(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+	other, err := NewCA()
+	require.NoError(t, err)
+	ca.PrivateKey = other.PrivateKey
+	raw, err := ca.MarshalPEM()
+	require.NoError(t, err)
+
+	loaded, err := NewCA()
+	require.NoError(t, err)
+	err = loaded.UnmarshalPEM(raw)
+	assert.EqualError(t, err, "private key does not match the certificate")
+	assert.NotEqual(t, ca.Bytes, loaded.Bytes)
+}
+
+func TestCAHttpGet(t *testing.T) {
+	ca, err := NewCA()
+	require.NoError(t, err)
+
+	res, err := ca.HttpGet(httptest.NewRequest("GET", "/api/ca", nil))
+	require.NoError(t, err)
+	raw := res.(app.Raw)
+	block, _ := pem.Decode(raw.Body)
+	require.NotNil(t, block)
+	assert.Equal(t, ca.Bytes, block.Bytes)
+	assert.Equal(t, "slrp-ca.pem", raw.Filename)
+
+	res, err = ca.HttpGet(httptest.NewRequest("GET", "/api/ca?format=der", nil))
+	require.NoError(t, err)
+	assert.Equal(t, ca.Bytes, res.(app.Raw).Body)
+}
@@ -115,7 +115,7 @@ func (d *dashboard) HttpGet(_ *http.Request) (interface{}, error) {
 	}
 	plan := d.refresher.Snapshot()
 	srcs := []src{}
-	for _, s := range sources.Sources {
+	for _, s := range sources.All() {
 		urlPrefix := s.UrlPrefix
 		if urlPrefix == "" {
 			urlPrefix = s.Homepage
@@ -25,6 +25,8 @@ type HttpProxyServer struct {
 	listener  net.Listener
 	transport http.RoundTripper
 	signer    func(host string) (*tls.Certificate, error)
+	connect   *connectPolicy
+	tunnels   tunnels
 }
 
 // defaultTransport ignores invalid TLS certs and has low timeouts
@@ -59,6 +61,17 @@ func (srv *HttpProxyServer) ListenAndServe() error {
 	return srv.Serve(srv.listener)
 }
 
+// Shutdown stops accepting connections and waits for in-flight requests,
+// including the ones within intercepted CONNECT tunnels
+func (srv *HttpProxyServer) Shutdown(ctx context.Context) error {
+	err := srv.Server.Shutdown(ctx)
+	tunnelsErr := srv.tunnels.drain(ctx)
+	if err != nil {
+		return err
+	}
+	return tunnelsErr
+}
+
 func (srv *HttpProxyServer) addr() string {
 	return srv.listener.Addr().String()
 }
@@ -125,6 +138,10 @@ func (srv *HttpProxyServer) handleConnect(rw http.ResponseWriter, r *http.Reques
 		rw.WriteHeader(501)
 		return
 	}
+	if srv.connect.Passthrough(r.URL.Host) {
+		srv.handlePassthrough(log, hijacker, r.URL.Host, tunnelHeaders(r.Header))
+		return
+	}
 	rw.WriteHeader(200)
 	src, _, err := hijacker.Hijack()
 	if err != nil {
@@ -132,28 +149,56 @@ func (srv *HttpProxyServer) handleConnect(rw http.ResponseWriter, r *http.Reques
 		return
 	}
 	log.Trace().Stringer("url", r.URL).Msg("hijacked")
-	go func() {
-		ctx := context.Background() // TODO: cleanup all requests?..
-		ssl, err := srv.handleHandshake(ctx, src, r.URL.Host)
+	go srv.serveTLS(log, src, r.URL.Host, tunnelHeaders(r.Header))
+}
+
+// tunnelHeaders are taken from CONNECT request and apply to every request
+// within the tunnel, as clients usually can't set headers on inner requests
+func tunnelHeaders(h http.Header) http.Header {
+	inherited := http.Header{}
+	for k, v := range h {
+		if k == "Proxy-Authorization" || strings.HasPrefix(k, "X-Proxy-") {
+			inherited[k] = v
+		}
+	}
+	return inherited
+}
+
+// serveTLS terminates TLS on the hijacked connection with a certificate
+// signed for the host and forwards all inner requests through transport
+func (srv *HttpProxyServer) serveTLS(log zerolog.Logger, src net.Conn, host string, tunnel http.Header) {
+	ctx := context.Background() // TODO: cleanup all requests?..
+	ssl, err := srv.handleHandshake(ctx, src, host)
+	if err != nil {
+		log.Err(err).Msg("handshake failed")
+		src.Close()
+		return
+	}
+	// TODO: buffer both reads and writes
+	srv.serveInner(log, ssl, bufio.NewReader(ssl), "https", tunnel)
+}
+
+// serveInner reads requests from the connection until it's closed
+// and forwards them through transport with the given scheme
+func (srv *HttpProxyServer) serveInner(log zerolog.Logger, conn net.Conn, buf *bufio.Reader, scheme string, tunnel http.Header) {
+	defer conn.Close()
+	if !srv.tunnels.add(conn) {
+		return
+	}
+	defer srv.tunnels.remove(conn)
+	for {
+		err := srv.handleInnerHttp(log, conn, buf, scheme, tunnel)
+		if errors.Is(err, io.EOF) {
+			return
+		}
 		if err != nil {
-			log.Err(err).Msg("handshake failed")
-			src.Close()
+			srv.writeError(conn, 472, "Forwarding Failed", err)
 			return
 		}
-		defer ssl.Close()
-		// TODO: buffer both reads and writes
-		buf := bufio.NewReader(ssl)
-		for {
-			err := srv.handleInnerHttp(log, ssl, buf)
-			if errors.Is(err, io.EOF) {
-				return
-			}
-			if err != nil {
-				srv.writeError(ssl, 472, "Forwarding Failed", err)
-				return
-			}
+		if !srv.tunnels.idle(conn) {
+			return
 		}
-	}()
+	}
 }
 
 func (srv *HttpProxyServer) handleHandshake(ctx context.Context, src net.Conn, host string) (*tls.Conn, error) {
@@ -183,7 +228,7 @@ func (srv *HttpProxyServer) rewrapRequest(log zerolog.Logger, scheme string, req
 	}).WithContext(app.Log.To(req.Context(), log))
 }
 
-func (srv *HttpProxyServer) writeError(w *tls.Conn, httpCode int, status string, err error) {
+func (srv *HttpProxyServer) writeError(w net.Conn, httpCode int, status string, err error) {
 	log.Warn().Err(err).Stringer("from", w.RemoteAddr()).Msg("forwarding failed")
 	body := strings.NewReader(err.Error())
 	(&http.Response{
@@ -195,18 +240,24 @@ func (srv *HttpProxyServer) writeError(w *tls.Conn, httpCode int, status string,
 	}).Write(w)
 }
 
-func (srv *HttpProxyServer) handleInnerHttp(log zerolog.Logger, ssl *tls.Conn, buf *bufio.Reader) error {
+func (srv *HttpProxyServer) handleInnerHttp(log zerolog.Logger, conn net.Conn, buf *bufio.Reader, scheme string, tunnel http.Header) error {
 	req, err := http.ReadRequest(buf)
 	if err != nil {
 		return fmt.Errorf("read request: %w", err)
 	}
+	srv.tunnels.busy(conn)
+	for k, v := range tunnel {
+		if req.Header.Get(k) == "" {
+			req.Header[k] = v
+		}
+	}
 	defer req.Body.Close()
-	res, err := srv.transport.RoundTrip(srv.rewrapRequest(log, "https", req))
+	res, err := srv.transport.RoundTrip(srv.rewrapRequest(log, scheme, req))
 	if err != nil {
 		return fmt.Errorf("round trip: %w", err)
 	}
 	if res.Body != nil {
 		defer res.Body.Close() // leak or not?..
 	}
-	return res.Write(ssl) // or chunked?..
+	return res.Write(conn) // or chunked?..
 }
@@ -307,3 +307,54 @@ func TestHttpProxyServer_handleConnect_CannotHijack(t *testing.T) {
 	resp := w.Result()
 	assert.Equal(t, 200, resp.StatusCode)
 }
+
+func TestHttpProxyServer_TunnelHeaders(t *testing.T) {
+	inner := make(chan http.Header, 1)
+	httpProxy := NewTransparentProxy()
+	httpProxy.transport = staticRT(func(r *http.Request) (*http.Response, error) {
+		inner <- r.Header
+		return &http.Response{
+			StatusCode: 217,
+			Header:     http.Header{},
+		}, nil
+	})
+	go httpProxy.ListenAndServe()
+	defer httpProxy.Close()
+
+	ctx := context.Background()
+	conn, err := pmux.DefaultDialer.DialContext(ctx, "tcp", httpProxy.listener.Addr().String())
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("CONNECT example.com:443 HTTP/1.1\r\n" +
+		"Host: example.com:443\r\n" +
+		"Proxy-Authorization: Basic c2NvdHQ6dGlnZXI=\r\n" +
+		"X-Proxy-Session: abc\r\n" +
+		"X-Proxy-Country: DE\r\n" +
+		"User-Agent: curl\r\n\r\n"))
+	require.NoError(t, err)
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	ssl := tls.Client(conn, pmux.DefaultTlsConfig)
+	defer ssl.Close()
+	err = ssl.HandshakeContext(ctx)
+	require.NoError(t, err)
+
+	_, err = ssl.Write([]byte("GET / HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"X-Proxy-Country: NL\r\n\r\n"))
+	require.NoError(t, err)
+
+	response, err = http.ReadResponse(bufio.NewReader(ssl), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 217, response.StatusCode)
+
+	h := <-inner
+	assert.Equal(t, "Basic c2NvdHQ6dGlnZXI=", h.Get("Proxy-Authorization"))
+	assert.Equal(t, "abc", h.Get("X-Proxy-Session"))
+	// headers of inner requests take precedence
+	assert.Equal(t, "NL", h.Get("X-Proxy-Country"))
+	assert.Equal(t, "", h.Get("User-Agent"))
+}
@@ -13,9 +13,10 @@ import (
 type MitmProxyServer struct {
 	HttpsProxyServer
 	sessions chan int
+	auth     *proxyAuth
 }
 
-func NewMitmProxyServer(pool *pool.Pool, ca certWrapper) *MitmProxyServer {
+func NewMitmProxyServer(pool *pool.Pool, ca *certWrapper) *MitmProxyServer {
 	return &MitmProxyServer{
 		HttpsProxyServer: HttpsProxyServer{
 			HttpProxyServer: HttpProxyServer{
@@ -32,25 +33,57 @@ func NewMitmProxyServer(pool *pool.Pool, ca certWrapper) *MitmProxyServer {
 var mitmDefaultAddr = "localhost:8090"
 
 func (mps *MitmProxyServer) Configure(c app.Config) error {
-	// TODO: make sure about private interfaces only!!!
 	mps.Addr = c.StrOr("addr", mitmDefaultAddr)
 	mps.ReadTimeout = c.DurOr("read_timeout", 15*time.Second)
 	mps.IdleTimeout = c.DurOr("idle_timeout", 15*time.Second)
 	mps.WriteTimeout = c.DurOr("write_timeout", 15*time.Second)
 	mps.Handler = mps
-	err := mps.Listen()
+	connect, err := newConnectPolicy(c)
 	if err != nil {
 		return err
 	}
-	log.Info().Stringer("endpoint", mps.Proxy()).Msg("configured MITM Proxy")
+	mps.connect = connect
+	mps.auth, err = newProxyAuth(c)
+	if err != nil {
+		return err
+	}
+	err = mps.Listen()
+	if err != nil {
+		return err
+	}
+	log.Info().
+		Stringer("endpoint", mps.Proxy()).
+		Bool("auth", len(mps.auth.users) > 0).
+		Msg("configured MITM Proxy")
 	return nil
 }
 
-func (mps *MitmProxyServer) Start(ctx app.Context) {
+func (mps *MitmProxyServer) ConfigSchema() app.Schema {
+	return append(app.Schema{
+		{Name: "addr", Type: app.TypeString, Default: mitmDefaultAddr,
+			Doc: "address of listening HTTP proxy server"},
+		{Name: "read_timeout", Type: app.TypeDuration, Default: "15s",
+			Doc: "read timeout of proxy connections"},
+		{Name: "idle_timeout", Type: app.TypeDuration, Default: "15s",
+			Doc: "idle timeout of proxy connections"},
+		{Name: "write_timeout", Type: app.TypeDuration, Default: "15s",
+			Doc: "write timeout of proxy connections"},
+		{Name: "users", Type: app.TypeList, Secret: true,
+			Doc: "credentials, like alice:secret, that clients have to send"},
+		{Name: "allow", Type: app.TypeList,
+			Doc: "IP addresses and networks, that are allowed to connect"},
+	}, connectPolicySchema...)
+}
+
+func (mps *MitmProxyServer) Start(ctx app.Context) error {
 	go mps.counter(ctx)
+	return nil
 }
 
 func (mps *MitmProxyServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if !mps.auth.check(rw, r) {
+		return
+	}
 	session := <-mps.sessions
 	logger := log.With().Int("session", session).Logger()
 	ctx := app.Log.To(r.Context(), logger)
@@ -66,7 +66,7 @@ func TestFlows(t *testing.T) {
 				Country: "Zimbabwe",
 			}, &net.Dialer{})
 			mitm, runtime := app.MockStartSpin(
-				NewMitmProxyServer(pool, *defaultCA),
+				NewMitmProxyServer(pool, defaultCA),
 				history, pool, tt.Via)
 			defer runtime.Stop()
 
@@ -100,7 +100,7 @@ func TestMitm_HTTP_viaHTTP_toHTTP(t *testing.T) { // TODO: rename
 		Country: "Zimbabwe",
 	}, &net.Dialer{})
 	mitm, runtime := app.MockStartSpin(
-		NewMitmProxyServer(pool, *defaultCA),
+		NewMitmProxyServer(pool, defaultCA),
 		history, pool, transparentHttp)
 	defer runtime.Stop()
 
@@ -0,0 +1,198 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+
+	"github.com/rs/zerolog"
+)
+
+// connectPolicy decides, whether CONNECT requests are intercepted with forged
+// certificates or forwarded as raw byte streams through tunnelling proxies
+type connectPolicy struct {
+	passthrough      bool
+	passthroughHosts []string
+	interceptHosts   []string
+}
+
+// connectPolicySchema declares keys, that are shared by proxy frontends
+var connectPolicySchema = app.Schema{
+	{Name: "connect_mode", Type: app.TypeString, Default: "intercept",
+		Doc:    "how CONNECT requests are handled by default",
+		Values: []string{"intercept", "passthrough"}},
+	{Name: "passthrough_hosts", Type: app.TypeList,
+		Doc: "host patterns, that are always forwarded in passthrough mode"},
+	{Name: "intercept_hosts", Type: app.TypeList,
+		Doc: "host patterns, that are always intercepted"},
+}
+
+func newConnectPolicy(c app.Config) (*connectPolicy, error) {
+	cp := &connectPolicy{
+		passthroughHosts: c.ListOr("passthrough_hosts"),
+		interceptHosts:   c.ListOr("intercept_hosts"),
+	}
+	mode := c.StrOr("connect_mode", "intercept")
+	switch mode {
+	case "intercept":
+	case "passthrough":
+		cp.passthrough = true
+	default:
+		return nil, fmt.Errorf("invalid connect_mode: %s", mode)
+	}
+	for _, pattern := range append(cp.passthroughHosts, cp.interceptHosts...) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid host pattern %s: %w", pattern, err)
+		}
+	}
+	return cp, nil
+}
+
+// Passthrough tells if connection to the host should not be intercepted.
+// Intercepted hosts take priority over passthrough hosts and both of them
+// take priority over the default mode.
+func (cp *connectPolicy) Passthrough(hostPort string) bool {
+	if cp == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = hostPort
+	}
+	host = strings.ToLower(host)
+	if cp.matches(cp.interceptHosts, host) {
+		return false
+	}
+	if cp.matches(cp.passthroughHosts, host) {
+		return true
+	}
+	return cp.passthrough
+}
+
+func (cp *connectPolicy) matches(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		ok, _ := path.Match(strings.ToLower(pattern), host)
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePassthrough forwards CONNECT as a raw byte stream without terminating
+// TLS, so that clients with pinned certificates or non-HTTP protocols work
+func (srv *HttpProxyServer) handlePassthrough(log zerolog.Logger, hijacker http.Hijacker, host string, tunnel http.Header) {
+	src, buf, err := hijacker.Hijack()
+	if err != nil {
+		log.Err(err).Msg("cannot hijack")
+		return
+	}
+	// hijacked connection inherits deadlines from http.Server
+	src.SetDeadline(time.Time{})
+	dst, headers, err := srv.dialTunnel(log, host, tunnel)
+	if err != nil {
+		srv.writeError(src, http.StatusBadGateway, "Bad Gateway", err)
+		src.Close()
+		return
+	}
+	_, err = fmt.Fprint(src, "HTTP/1.1 200 Connection Established\r\n")
+	if err == nil {
+		err = headers.Write(src)
+	}
+	if err == nil {
+		_, err = fmt.Fprint(src, "\r\n")
+	}
+	if err != nil {
+		log.Err(err).Msg("cannot reply")
+		src.Close()
+		dst.Close()
+		return
+	}
+	pipe(log, withBuffered(src, buf.Reader), dst)
+}
+
+// dialTunnel establishes raw connection to host through transport and returns
+// it along with headers, that describe the proxy used for the tunnel
+func (srv *HttpProxyServer) dialTunnel(log zerolog.Logger, host string, tunnel http.Header) (io.ReadWriteCloser, http.Header, error) {
+	// request context is cancelled once the connection is hijacked
+	ctx := app.Log.To(context.Background(), log)
+	req := (&http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: host},
+		Host:   host,
+		Header: tunnel.Clone(),
+	}).WithContext(ctx)
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	res, err := srv.transport.RoundTrip(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tunnel: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		if res.Body != nil {
+			res.Body.Close()
+		}
+		return nil, nil, fmt.Errorf("tunnel: %s", res.Status)
+	}
+	conn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		if res.Body != nil {
+			res.Body.Close()
+		}
+		return nil, nil, fmt.Errorf("tunnel: transport returned no connection")
+	}
+	log.Debug().
+		Str("host", host).
+		Str("through", res.Header.Get("X-Proxy-Through")).
+		Msg("passthrough established")
+	return conn, res.Header, nil
+}
+
+func withBuffered(conn net.Conn, buf *bufio.Reader) net.Conn {
+	if buf == nil || buf.Buffered() == 0 {
+		return conn
+	}
+	return &bufferedConn{conn, buf}
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies bytes in both directions until both sides are done
+func pipe(log zerolog.Logger, client, upstream io.ReadWriteCloser) {
+	var wg sync.WaitGroup
+	closeBoth := func() {
+		client.Close()
+		upstream.Close()
+	}
+	forward := func(dst io.WriteCloser, src io.Reader) {
+		defer wg.Done()
+		_, err := io.Copy(dst, src)
+		cw, ok := dst.(closeWriter)
+		if err != nil || !ok {
+			// no way to signal half-close, so tear down the whole tunnel
+			closeBoth()
+			return
+		}
+		cw.CloseWrite()
+	}
+	wg.Add(2)
+	go forward(upstream, client)
+	go forward(client, upstream)
+	wg.Wait()
+	closeBoth()
+	log.Trace().Msg("passthrough closed")
+}
@@ -0,0 +1,110 @@
+package serve
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noInterception(host string) (*tls.Certificate, error) {
+	return nil, fmt.Errorf("%s must not be intercepted", host)
+}
+
+func TestConnectPolicy(t *testing.T) {
+	cp, err := newConnectPolicy(app.Config{
+		"passthrough_hosts": "*.bank.com, pinned.org",
+		"intercept_hosts":   "www.bank.com",
+	})
+	require.NoError(t, err)
+
+	assert.True(t, cp.Passthrough("api.bank.com:443"))
+	assert.True(t, cp.Passthrough("PINNED.org:8443"))
+	assert.True(t, cp.Passthrough("pinned.org"))
+	assert.False(t, cp.Passthrough("www.bank.com:443"))
+	assert.False(t, cp.Passthrough("example.com:443"))
+
+	cp, err = newConnectPolicy(app.Config{
+		"connect_mode":    "passthrough",
+		"intercept_hosts": "scrape.me",
+	})
+	require.NoError(t, err)
+	assert.True(t, cp.Passthrough("example.com:443"))
+	assert.False(t, cp.Passthrough("scrape.me:443"))
+
+	var none *connectPolicy
+	assert.False(t, none.Passthrough("example.com:443"))
+}
+
+func TestConnectPolicy_Invalid(t *testing.T) {
+	_, err := newConnectPolicy(app.Config{
+		"connect_mode": "maybe",
+	})
+	assert.EqualError(t, err, "invalid connect_mode: maybe")
+
+	_, err = newConnectPolicy(app.Config{
+		"passthrough_hosts": "[a-",
+	})
+	assert.EqualError(t, err, "invalid host pattern [a-: syntax error in pattern")
+}
+
+func TestPassthrough(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(217)
+		}))
+	defer srv.Close()
+
+	// plain HTTP proxies are not offered for tunnels
+	plain := NewTransparentProxy()
+	via := NewTransparentHttpsProxy()
+	history := history.NewHistory()
+	pool := pool.NewPool(history, ipinfo.NoopIpInfo{
+		Country: "Zimbabwe",
+	}, &net.Dialer{})
+	mitm, runtime := app.MockStartSpin(
+		NewMitmProxyServer(pool, defaultCA),
+		history, pool, plain, via)
+	defer runtime.Stop()
+	socks := NewSocksProxyServer(pool, defaultCA)
+	_, socksRuntime := app.MockStartSpin(socks)
+	defer socksRuntime.Stop()
+
+	for _, srv := range []*HttpProxyServer{&mitm.HttpProxyServer, &socks.HttpProxyServer} {
+		srv.connect = &connectPolicy{passthrough: true}
+		srv.signer = noInterception
+	}
+
+	pool.Add(runtime.Context(), plain.Proxy(), 1*time.Second)
+
+	req := mitm.Proxy().MustNewGetRequest(srv.URL)
+	_, err := pmux.DefaultHttpClient.Do(req)
+	assert.ErrorContains(t, err, "Bad Gateway")
+
+	_, err = socksClient(t, socks, nil).Get(srv.URL)
+	assert.ErrorContains(t, err, "general SOCKS server failure")
+
+	// selection starts from random offset, so keep only one proxy
+	pool.Remove(plain.Proxy())
+	pool.Add(runtime.Context(), via.Proxy(), 1*time.Second)
+
+	req = mitm.Proxy().MustNewGetRequest(srv.URL)
+	res, err := pmux.DefaultHttpClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, 217, res.StatusCode)
+
+	res, err = socksClient(t, socks, nil).Get(srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 217, res.StatusCode)
+}
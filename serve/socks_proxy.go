@@ -0,0 +1,427 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/pool"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// see https://www.rfc-editor.org/rfc/rfc1928 and https://www.rfc-editor.org/rfc/rfc1929
+const (
+	socks5Version        = 0x05
+	socksAuthVersion     = 0x01
+	socksNoAuth          = 0x00
+	socksUserPass        = 0x02
+	socksNoAcceptable    = 0xff
+	socksCmdConnect      = 0x01
+	socksAddrIPv4        = 0x01
+	socksAddrDomain      = 0x03
+	socksAddrIPv6        = 0x04
+	socksSucceeded       = 0x00
+	socksGeneralFailure  = 0x01
+	socksCmdUnsupported  = 0x07
+	socksAddrUnsupported = 0x08
+	tlsRecordHandshake   = 0x16
+)
+
+var errSocksAuth = errors.New("socks auth failed")
+
+// SocksProxyServer accepts SOCKS5 connections and forwards HTTP and HTTPS
+// requests, that are sent through the tunnel, via the proxy pool. Depending
+// on connect policy, the tunnel may be forwarded as raw bytes instead.
+type SocksProxyServer struct {
+	HttpProxyServer
+	username string
+	password string
+	allow    app.Allowlist
+	sessions chan int
+}
+
+func NewSocksProxyServer(pool *pool.Pool, ca *certWrapper) *SocksProxyServer {
+	return &SocksProxyServer{
+		HttpProxyServer: HttpProxyServer{
+			transport: pool,
+			signer:    ca.Sign,
+		},
+		sessions: make(chan int),
+	}
+}
+
+// package-private variable, to simplify tests
+var socksDefaultAddr = "localhost:8091"
+
+func (sps *SocksProxyServer) Configure(c app.Config) error {
+	sps.Addr = c.StrOr("addr", socksDefaultAddr)
+	sps.ReadTimeout = c.DurOr("read_timeout", 15*time.Second)
+	sps.username = c.StrOr("username", "")
+	sps.password = c.StrOr("password", "")
+	connect, err := newConnectPolicy(c)
+	if err != nil {
+		return err
+	}
+	sps.allow, err = app.ParseAllowlist(c.ListOr("allow"))
+	if err != nil {
+		return err
+	}
+	sps.connect = connect
+	err = sps.Listen()
+	if err != nil {
+		return err
+	}
+	log.Info().
+		Stringer("endpoint", sps.Proxy()).
+		Bool("auth", sps.username != "").
+		Msg("configured SOCKS5 Proxy")
+	return nil
+}
+
+func (sps *SocksProxyServer) ConfigSchema() app.Schema {
+	return append(app.Schema{
+		{Name: "addr", Type: app.TypeString, Default: socksDefaultAddr,
+			Doc: "address of listening SOCKS5 proxy server"},
+		{Name: "read_timeout", Type: app.TypeDuration, Default: "15s",
+			Doc: "time to complete SOCKS5 handshake"},
+		{Name: "username", Type: app.TypeString,
+			Doc: "username for RFC 1929 authentication"},
+		{Name: "password", Type: app.TypeString, Secret: true,
+			Doc: "password for RFC 1929 authentication"},
+		{Name: "allow", Type: app.TypeList,
+			Doc: "IP addresses and networks, that are allowed to connect"},
+	}, connectPolicySchema...)
+}
+
+func (sps *SocksProxyServer) Start(ctx app.Context) error {
+	go sps.counter(ctx)
+	return nil
+}
+
+func (sps *SocksProxyServer) Proxy() pmux.Proxy {
+	return pmux.Socks5Proxy(sps.addr())
+}
+
+func (sps *SocksProxyServer) String() string {
+	return fmt.Sprintf("socks5://%s", sps.addr())
+}
+
+// ListenAndServe accepts connections from listener configured in Configure method
+func (sps *SocksProxyServer) ListenAndServe() error {
+	if sps.listener == nil {
+		return fmt.Errorf("listener is not configured")
+	}
+	log.Debug().Stringer("server", sps).Msg("started")
+	for {
+		conn, err := sps.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go sps.handleConn(conn)
+	}
+}
+
+func (sps *SocksProxyServer) Close() error {
+	if sps.listener == nil {
+		return nil
+	}
+	return sps.listener.Close()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// within SOCKS5 tunnels
+func (sps *SocksProxyServer) Shutdown(ctx context.Context) error {
+	err := sps.Close()
+	tunnelsErr := sps.tunnels.drain(ctx)
+	if err != nil {
+		return err
+	}
+	return tunnelsErr
+}
+
+func (sps *SocksProxyServer) handleConn(conn net.Conn) {
+	session := <-sps.sessions
+	log := log.With().
+		Int("session", session).
+		Str("connection", "SOCKS5").
+		Stringer("from", conn.RemoteAddr()).
+		Logger()
+	if !sps.allow.Allows(conn.RemoteAddr().String()) {
+		log.Debug().Msg("not allowed")
+		conn.Close()
+		return
+	}
+	if sps.ReadTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(sps.ReadTimeout))
+	}
+	buf := bufio.NewReader(conn)
+	target, err := sps.handshake(buf, conn)
+	if err != nil {
+		log.Debug().Err(err).Msg("handshake failed")
+		conn.Close()
+		return
+	}
+	log = log.With().Str("target", target).Logger()
+	if sps.connect.Passthrough(target) {
+		sps.handlePassthrough(log, conn, buf, target)
+		return
+	}
+	// we're not connecting to destination just yet, as every request
+	// within the tunnel may go through a different proxy from the pool
+	err = sps.reply(conn, socksSucceeded)
+	if err != nil {
+		log.Debug().Err(err).Msg("reply failed")
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	log.Trace().Msg("tunnel established")
+	switch sniff(conn, buf) {
+	case sniffTLS:
+		// TLS ClientHello has to be intercepted, so that we can see the
+		// inner HTTP requests and send them through the pool
+		sps.serveTLS(log, &bufferedConn{conn, buf}, target, nil)
+	case sniffHTTP:
+		sps.serveInner(log, conn, buf, "http", nil)
+	case sniffOther:
+		// SSH, database drivers and other protocols can't be intercepted
+		sps.tunnel(log, conn, buf, target)
+	default:
+		log.Trace().Msg("nothing sent")
+		conn.Close()
+	}
+}
+
+// sniffTimeout limits waiting for the first bytes from the client. Protocols,
+// where the server speaks first, like SSH or SMTP, are tunnelled after it.
+var sniffTimeout = 1 * time.Second
+
+const (
+	sniffClosed = iota
+	sniffTLS
+	sniffHTTP
+	sniffOther
+)
+
+// httpMethods are prefixes of plain HTTP requests
+var httpMethods = []string{"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "TRACE "}
+
+// sniff peeks just enough bytes to tell TLS record or HTTP request from
+// other protocols
+func sniff(conn net.Conn, buf *bufio.Reader) int {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	first, err := buf.Peek(1)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return sniffOther
+	}
+	if err != nil {
+		return sniffClosed
+	}
+	if first[0] == tlsRecordHandshake {
+		return sniffTLS
+	}
+	for _, method := range httpMethods {
+		if method[0] != first[0] {
+			continue
+		}
+		prefix, _ := buf.Peek(len(method))
+		if string(prefix) == method {
+			return sniffHTTP
+		}
+	}
+	return sniffOther
+}
+
+// tunnel pipes raw bytes through the pool, once the client was told,
+// that the connection is established
+func (sps *SocksProxyServer) tunnel(log zerolog.Logger, conn net.Conn, buf *bufio.Reader, target string) {
+	dst, _, err := sps.dialTunnel(log, target, nil)
+	if err != nil {
+		log.Debug().Err(err).Msg("tunnel failed")
+		conn.Close()
+		return
+	}
+	pipe(log, withBuffered(conn, buf), dst)
+}
+
+// handlePassthrough replies to the client only after the tunnel through
+// the pool is established, so that failures are reported to the client
+func (sps *SocksProxyServer) handlePassthrough(log zerolog.Logger, conn net.Conn, buf *bufio.Reader, target string) {
+	dst, _, err := sps.dialTunnel(log, target, nil)
+	if err != nil {
+		log.Debug().Err(err).Msg("passthrough failed")
+		sps.reply(conn, socksGeneralFailure)
+		conn.Close()
+		return
+	}
+	err = sps.reply(conn, socksSucceeded)
+	if err != nil {
+		log.Debug().Err(err).Msg("reply failed")
+		conn.Close()
+		dst.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	pipe(log, withBuffered(conn, buf), dst)
+}
+
+// handshake performs method negotiation, optional username/password
+// authentication and returns the requested destination address. Reply
+// to the CONNECT command is sent by the caller.
+func (sps *SocksProxyServer) handshake(r *bufio.Reader, w io.Writer) (string, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return "", fmt.Errorf("greeting: %w", err)
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported version: %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	_, err = io.ReadFull(r, methods)
+	if err != nil {
+		return "", fmt.Errorf("methods: %w", err)
+	}
+	method := byte(socksNoAuth)
+	if sps.username != "" {
+		method = socksUserPass
+	}
+	var offered bool
+	for _, v := range methods {
+		if v == method {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		w.Write([]byte{socks5Version, socksNoAcceptable})
+		return "", fmt.Errorf("no acceptable methods")
+	}
+	_, err = w.Write([]byte{socks5Version, method})
+	if err != nil {
+		return "", err
+	}
+	if method == socksUserPass {
+		err = sps.authenticate(r, w)
+		if err != nil {
+			return "", err
+		}
+	}
+	request := make([]byte, 4)
+	_, err = io.ReadFull(r, request)
+	if err != nil {
+		return "", fmt.Errorf("request: %w", err)
+	}
+	if request[1] != socksCmdConnect {
+		sps.reply(w, socksCmdUnsupported)
+		return "", fmt.Errorf("unsupported command: %d", request[1])
+	}
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		_, err = io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case socksAddrDomain:
+		var domain []byte
+		domain, err = readShortString(r)
+		host = string(domain)
+	default:
+		sps.reply(w, socksAddrUnsupported)
+		return "", fmt.Errorf("unsupported address type: %d", request[3])
+	}
+	if err != nil {
+		return "", fmt.Errorf("address: %w", err)
+	}
+	port := make([]byte, 2)
+	_, err = io.ReadFull(r, port)
+	if err != nil {
+		return "", fmt.Errorf("port: %w", err)
+	}
+	portNum := strconv.Itoa(int(binary.BigEndian.Uint16(port)))
+	return net.JoinHostPort(host, portNum), nil
+}
+
+func (sps *SocksProxyServer) authenticate(r *bufio.Reader, w io.Writer) error {
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if version != socksAuthVersion {
+		return fmt.Errorf("unsupported auth version: %d", version)
+	}
+	username, err := readShortString(r)
+	if err != nil {
+		return fmt.Errorf("username: %w", err)
+	}
+	password, err := readShortString(r)
+	if err != nil {
+		return fmt.Errorf("password: %w", err)
+	}
+	userOk := subtle.ConstantTimeCompare(username, []byte(sps.username)) == 1
+	passOk := subtle.ConstantTimeCompare(password, []byte(sps.password)) == 1
+	if !userOk || !passOk {
+		w.Write([]byte{socksAuthVersion, socksGeneralFailure})
+		return errSocksAuth
+	}
+	_, err = w.Write([]byte{socksAuthVersion, socksSucceeded})
+	return err
+}
+
+func (sps *SocksProxyServer) reply(w io.Writer, code byte) error {
+	// bound address is not relevant for the clients, as we're not
+	// exposing the actual outgoing connection
+	_, err := w.Write([]byte{socks5Version, code, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func (sps *SocksProxyServer) counter(ctx app.Context) {
+	var start int
+	for {
+		start++
+		select {
+		case <-ctx.Done():
+			return
+		case sps.sessions <- start:
+		}
+	}
+}
+
+// readShortString reads one byte of length and then the value
+func readShortString(r *bufio.Reader) ([]byte, error) {
+	size, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	_, err = io.ReadFull(r, value)
+	return value, err
+}
+
+// bufferedConn makes sure, that bytes already peeked from connection
+// are not lost for the reader, like TLS server
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
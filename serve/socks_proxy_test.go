@@ -0,0 +1,290 @@
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/history"
+	"github.com/nfx/slrp/ipinfo"
+	"github.com/nfx/slrp/pmux"
+	"github.com/nfx/slrp/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+)
+
+func init() {
+	// listen socks on a random port each time
+	socksDefaultAddr = "localhost:0"
+}
+
+func socksClient(t *testing.T, srv *SocksProxyServer, auth *proxy.Auth) *http.Client {
+	dialer, err := proxy.SOCKS5("tcp", srv.addr(), auth, proxy.Direct)
+	require.NoError(t, err)
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			Dial:            dialer.Dial,
+			TLSClientConfig: pmux.DefaultTlsConfig,
+		},
+	}
+}
+
+func TestSocksFlows(t *testing.T) {
+	type permutation struct {
+		Name   string
+		Target func(handler http.Handler) *httptest.Server
+	}
+	tests := []permutation{
+		{
+			Name:   "via SOCKS5 to HTTP",
+			Target: httptest.NewServer,
+		},
+		{
+			Name:   "via SOCKS5 to HTTPS",
+			Target: httptest.NewTLSServer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			srv := tt.Target(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(217)
+				}))
+			defer srv.Close()
+
+			via := NewTransparentProxy()
+			history := history.NewHistory()
+			pool := pool.NewPool(history, ipinfo.NoopIpInfo{
+				Country: "Zimbabwe",
+			}, &net.Dialer{})
+			socks, runtime := app.MockStartSpin(
+				NewSocksProxyServer(pool, defaultCA),
+				history, pool, via)
+			defer runtime.Stop()
+
+			pool.Add(runtime.Context(), via.Proxy(), 1*time.Second)
+			assert.Equal(t, 1, pool.Len())
+
+			res, err := socksClient(t, socks, nil).Get(srv.URL)
+			require.NoError(t, err)
+
+			assert.Equal(t, 217, res.StatusCode)
+			assert.Equal(t, via.Proxy().String(), res.Header.Get("X-Proxy-Through"))
+		})
+	}
+}
+
+func TestSocksTunnelsOtherProtocols(t *testing.T) {
+	defer func(orig time.Duration) {
+		sniffTimeout = orig
+	}(sniffTimeout)
+	sniffTimeout = 100 * time.Millisecond
+
+	// server speaks first, like SSH, and then echoes
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("SSH-2.0-test\r\n"))
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	// test proxies intercept tunnels, so this one just pipes bytes
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer upstream.Close()
+	go func() {
+		tlsListener := tls.NewListener(upstream, defaultCA.Config())
+		for {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				req, err := http.ReadRequest(r)
+				if err != nil {
+					return
+				}
+				dst, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer dst.Close()
+				conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+				go io.Copy(dst, r)
+				io.Copy(conn, dst)
+			}()
+		}
+	}()
+
+	history := history.NewHistory()
+	pool := pool.NewPool(history, ipinfo.NoopIpInfo{
+		Country: "Zimbabwe",
+	}, &net.Dialer{})
+	socks, runtime := app.MockStartSpin(
+		NewSocksProxyServer(pool, defaultCA),
+		history, pool)
+	defer runtime.Stop()
+	pool.Add(runtime.Context(), pmux.HttpsProxy(upstream.Addr().String()), 1*time.Second)
+
+	dialer, err := proxy.SOCKS5("tcp", socks.addr(), nil, proxy.Direct)
+	require.NoError(t, err)
+	conn, err := dialer.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	banner, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "SSH-2.0-test\r\n", banner)
+
+	payload := []byte{0x00, 0x01, 'G', 'E', 'T', 0xff}
+	_, err = conn.Write(payload)
+	require.NoError(t, err)
+	echo := make([]byte, len(payload))
+	_, err = io.ReadFull(r, echo)
+	require.NoError(t, err)
+	assert.Equal(t, payload, echo)
+}
+
+// configuredSocks is configured with the given values instead of defaults,
+// so that fields are never changed after the server is started
+type configuredSocks struct {
+	*SocksProxyServer
+	config app.Config
+}
+
+func (c configuredSocks) Configure(app.Config) error {
+	return c.SocksProxyServer.Configure(c.config)
+}
+
+func startConfiguredSocks(t *testing.T, config app.Config) *SocksProxyServer {
+	via := NewTransparentProxy()
+	history := history.NewHistory()
+	pool := pool.NewPool(history, ipinfo.NoopIpInfo{
+		Country: "Zimbabwe",
+	}, &net.Dialer{})
+	socks := NewSocksProxyServer(pool, defaultCA)
+	_, runtime := app.MockStartSpin(&configuredSocks{socks, config}, history, pool, via)
+	t.Cleanup(runtime.Stop)
+	pool.Add(runtime.Context(), via.Proxy(), 1*time.Second)
+	return socks
+}
+
+func TestSocksAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(217)
+		}))
+	defer srv.Close()
+
+	socks := startConfiguredSocks(t, app.Config{
+		"username": "scott",
+		"password": "tiger",
+	})
+
+	_, err := socksClient(t, socks, &proxy.Auth{
+		User:     "scott",
+		Password: "wrong",
+	}).Get(srv.URL)
+	assert.ErrorContains(t, err, "username/password authentication failed")
+
+	_, err = socksClient(t, socks, nil).Get(srv.URL)
+	assert.ErrorContains(t, err, "no acceptable authentication methods")
+
+	res, err := socksClient(t, socks, &proxy.Auth{
+		User:     "scott",
+		Password: "tiger",
+	}).Get(srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 217, res.StatusCode)
+}
+
+func TestSocksAllowlist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(217)
+		}))
+	defer srv.Close()
+
+	// clients outside of allowlist are disconnected
+	socks := startConfiguredSocks(t, app.Config{
+		"allow": "192.0.2.1",
+	})
+	_, err := socksClient(t, socks, nil).Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestSocksUnsupportedCommand(t *testing.T) {
+	socks := NewSocksProxyServer(nil, defaultCA)
+	// BIND command is not supported
+	r := bufio.NewReader(bytes.NewReader([]byte{
+		socks5Version, 1, socksNoAuth,
+		socks5Version, 0x02, 0x00, socksAddrIPv4, 127, 0, 0, 1, 0, 80,
+	}))
+	w := &sink{}
+	_, err := socks.handshake(r, w)
+	assert.EqualError(t, err, "unsupported command: 2")
+	assert.Equal(t, []byte{
+		socks5Version, socksNoAuth,
+		socks5Version, socksCmdUnsupported, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0,
+	}, w.data)
+}
+
+func TestSocksHandshakeDomain(t *testing.T) {
+	socks := NewSocksProxyServer(nil, defaultCA)
+	r := bufio.NewReader(bytes.NewReader(append([]byte{
+		socks5Version, 1, socksNoAuth,
+		socks5Version, socksCmdConnect, 0x00, socksAddrDomain, 11,
+	}, append([]byte("example.com"), 0x01, 0xbb)...)))
+	target, err := socks.handshake(r, &sink{})
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com:443", target)
+}
+
+func TestSocksListenAndServe_NoConf(t *testing.T) {
+	err := (&SocksProxyServer{}).ListenAndServe()
+	assert.EqualError(t, err, "listener is not configured")
+}
+
+func TestSocksListenAndServe_Closed(t *testing.T) {
+	socks := NewSocksProxyServer(nil, defaultCA)
+	err := socks.Configure(app.Config{})
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		done <- socks.ListenAndServe()
+	}()
+	assert.NoError(t, socks.Close())
+	assert.ErrorIs(t, <-done, net.ErrClosed)
+}
+
+type sink struct {
+	data []byte
+}
+
+func (s *sink) Write(b []byte) (int, error) {
+	s.data = append(s.data, b...)
+	return len(b), nil
+}
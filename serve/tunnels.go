@@ -0,0 +1,81 @@
+package serve
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// tunnels keeps track of requests within intercepted CONNECT connections,
+// because http.Server forgets about connections once they are hijacked
+type tunnels struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	conns    map[net.Conn]bool
+	draining bool
+}
+
+// add returns false, if the server is shutting down
+func (t *tunnels) add(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = map[net.Conn]bool{}
+	}
+	t.conns[conn] = false
+	t.wg.Add(1)
+	return true
+}
+
+func (t *tunnels) busy(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[conn] = true
+}
+
+// idle returns false, if the connection has to be closed after the response
+func (t *tunnels) idle(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[conn] = false
+	return !t.draining
+}
+
+func (t *tunnels) remove(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+	t.wg.Done()
+}
+
+// drain closes idle connections and waits for in-flight requests to finish.
+// Remaining connections are closed, once the context is done.
+func (t *tunnels) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	for conn, busy := range t.conns {
+		if !busy {
+			conn.Close()
+		}
+	}
+	t.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for conn := range t.conns {
+			conn.Close()
+		}
+		return ctx.Err()
+	}
+}
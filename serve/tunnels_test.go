@@ -0,0 +1,102 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownDrainsTunnels(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	srv := &HttpProxyServer{
+		transport: staticRT(func(r *http.Request) (*http.Response, error) {
+			started <- true
+			<-release
+			return &http.Response{
+				StatusCode: 200,
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Body:       io.NopCloser(strings.NewReader("done")),
+			}, nil
+		}),
+	}
+	busy, busyServer := net.Pipe()
+	go srv.serveInner(log.Logger, busyServer, bufio.NewReader(busyServer), "http", nil)
+	idle, idleServer := net.Pipe()
+	go srv.serveInner(log.Logger, idleServer, bufio.NewReader(idleServer), "http", nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	go req.Write(busy)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	drained := make(chan error)
+	go func() {
+		drained <- srv.Shutdown(ctx)
+	}()
+
+	// idle tunnels are closed right away
+	_, err := idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	select {
+	case <-drained:
+		t.Fatal("shutdown must wait for in-flight request")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- true
+
+	res, err := http.ReadResponse(bufio.NewReader(busy), req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "done", string(body))
+	assert.NoError(t, <-drained)
+
+	// connection is not reused after the shutdown
+	_, err = busy.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	stuck := make(chan bool)
+	defer close(stuck)
+	srv := &HttpProxyServer{
+		transport: staticRT(func(r *http.Request) (*http.Response, error) {
+			<-stuck
+			return nil, io.ErrUnexpectedEOF
+		}),
+	}
+	client, server := net.Pipe()
+	go srv.serveInner(log.Logger, server, bufio.NewReader(server), "http", nil)
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Write(client)
+	for {
+		srv.tunnels.mu.Lock()
+		busy := srv.tunnels.conns[server]
+		srv.tunnels.mu.Unlock()
+		if busy {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// stuck connection is closed forcefully
+	_, err = client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,300 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/nfx/go-htmltable"
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// Declared is the source, that is defined in YAML file instead of code
+type Declared struct {
+	Name     string `json:"name"`
+	Homepage string `json:"homepage,omitempty"`
+	// URLs are pages with proxies per protocol, like http or socks5
+	URLs map[string][]string `json:"urls"`
+	// Expect is the string, that must be present in every page
+	Expect string `json:"expect,omitempty"`
+	// Extract is one of regex (default), table or json
+	Extract string `json:"extract,omitempty"`
+	// Regex overrides the default IP:port pattern. Named groups host,
+	// port and protocol are used, when present.
+	Regex string `json:"regex,omitempty"`
+	// Columns name table headers of host, port and protocol
+	Columns Columns `json:"columns,omitempty"`
+	// JSON selects proxies from JSON responses
+	JSON      JSONAPI           `json:"json,omitempty"`
+	Frequency string            `json:"frequency,omitempty"`
+	Seed      bool              `json:"seed,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+type Columns struct {
+	Host     string `json:"host,omitempty"`
+	Port     string `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// declaredIDs start after the IDs of built-in sources
+const declaredIDs = 1000
+
+var knownProtocols = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"socks4": true,
+	"socks5": true,
+}
+
+// IsProtocol tells if proxies with the protocol are supported
+func IsProtocol(protocol string) bool {
+	return knownProtocols[protocol]
+}
+
+// LoadDeclared reads and validates sources from YAML file
+func LoadDeclared(file string) ([]Source, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var declared []Declared
+	err = yaml.Unmarshal(raw, &declared)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	srcs := []Source{}
+	for i, d := range declared {
+		s, err := d.Source()
+		if err != nil {
+			return nil, fmt.Errorf("%s: source #%d: %w", file, i+1, err)
+		}
+		srcs = append(srcs, s)
+	}
+	return srcs, nil
+}
+
+// Declare replaces previously declared sources with the given ones,
+// so that refresher, dashboard and probe treat them as built-in.
+func Declare(declared []Source) error {
+	mu.Lock()
+	defer mu.Unlock()
+	srcs := []Source{}
+	names := map[string]int{}
+	ids := map[int]string{}
+	for _, s := range Sources {
+		if s.declared {
+			continue
+		}
+		srcs = append(srcs, s)
+		names[s.Name()] = s.ID
+		ids[s.ID] = s.Name()
+	}
+	for _, s := range declared {
+		_, ok := names[s.Name()]
+		if ok {
+			return fmt.Errorf("duplicate source name: %s", s.Name())
+		}
+		other, ok := ids[s.ID]
+		if ok {
+			return fmt.Errorf("source %s has the same ID as %s, rename one of them", s.Name(), other)
+		}
+		names[s.Name()] = s.ID
+		ids[s.ID] = s.Name()
+		srcs = append(srcs, s)
+	}
+	Sources = srcs
+	return nil
+}
+
+// Source validates the declaration. ID is derived from the name, so that
+// reordering of the file doesn't change it.
+func (d Declared) Source() (Source, error) {
+	if d.Name == "" {
+		return Source{}, fmt.Errorf("no name")
+	}
+	if len(d.URLs) == 0 {
+		return Source{}, fmt.Errorf("%s: no urls", d.Name)
+	}
+	for protocol, urls := range d.URLs {
+		if !knownProtocols[protocol] {
+			return Source{}, fmt.Errorf("%s: unknown protocol: %s", d.Name, protocol)
+		}
+		if len(urls) == 0 {
+			return Source{}, fmt.Errorf("%s: no urls for %s", d.Name, protocol)
+		}
+	}
+	frequency := 1 * time.Hour
+	if d.Frequency != "" {
+		f, err := app.ParseDuration(d.Frequency)
+		if err != nil || f <= 0 {
+			return Source{}, fmt.Errorf("%s: invalid frequency: %s", d.Name, d.Frequency)
+		}
+		frequency = f
+	}
+	feed, err := d.feed()
+	if err != nil {
+		return Source{}, fmt.Errorf("%s: %w", d.Name, err)
+	}
+	return Source{
+		ID:        declaredID(d.Name),
+		name:      d.Name,
+		Homepage:  d.Homepage,
+		Frequency: frequency,
+		Seed:      d.Seed,
+		declared:  true,
+		Feed: func(ctx context.Context, h *http.Client) Src {
+			m := merged()
+			for protocol, urls := range d.URLs {
+				for _, url := range urls {
+					m.refresh(feed(ctx, h, url, protocol))
+				}
+			}
+			return m
+		},
+	}, nil
+}
+
+// pageFeed fetches proxies from the URL, where protocol is used for
+// proxies without explicit protocol
+type pageFeed func(ctx context.Context, h *http.Client, url, protocol string) func() ([]pmux.Proxy, error)
+
+func (d Declared) feed() (pageFeed, error) {
+	if d.Extract == "json" {
+		api, err := d.JSON.compile()
+		if err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+		return func(ctx context.Context, h *http.Client, url, protocol string) func() ([]pmux.Proxy, error) {
+			return api.fetch(ctx, h, d.request(url), protocol)
+		}, nil
+	}
+	extract, err := d.extractor()
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, h *http.Client, url, protocol string) func() ([]pmux.Proxy, error) {
+		return d.fetch(ctx, h, url, protocol, extract)
+	}, nil
+}
+
+func (d Declared) request(url string) req {
+	return req{
+		URL:              url,
+		ExpectInResponse: d.Expect,
+		Headers:          d.Headers,
+	}
+}
+
+// declaredID is derived from the name, so that statistics survive restarts
+func declaredID(name string) int {
+	return declaredIDs + int(crc32.ChecksumIEEE([]byte(name))%(1<<20))
+}
+
+// extractor finds proxies in the body, where protocol is used for proxies
+// without explicit protocol
+type extractor func(ctx context.Context, body []byte, protocol string) ([]pmux.Proxy, error)
+
+func (d Declared) extractor() (extractor, error) {
+	switch d.Extract {
+	case "", "regex":
+		return d.regexExtractor()
+	case "table":
+		if d.Columns.Host == "" || d.Columns.Port == "" {
+			return nil, fmt.Errorf("table: host and port columns are required")
+		}
+		return d.extractTable, nil
+	default:
+		return nil, fmt.Errorf("unknown extract: %s", d.Extract)
+	}
+}
+
+func (d Declared) fetch(ctx context.Context, h *http.Client, url, protocol string, extract extractor) func() ([]pmux.Proxy, error) {
+	return func() ([]pmux.Proxy, error) {
+		body, serial, err := d.request(url).Do(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		ctx := app.Log.WithInt(ctx, "serial", serial)
+		extracted, err := extract(ctx, body, protocol)
+		if err != nil {
+			return nil, skipErr(err, intEC{"serial", serial}, strEC{"url", url})
+		}
+		found := []pmux.Proxy{}
+		for _, proxy := range extracted {
+			if proxy.Valid() {
+				found = append(found, proxy)
+			}
+		}
+		log := app.Log.From(ctx)
+		log.Info().Int("count", len(found)).Str("url", url).Msg("found")
+		return found, nil
+	}
+}
+
+func (d Declared) regexExtractor() (extractor, error) {
+	if d.Regex == "" {
+		return func(_ context.Context, body []byte, protocol string) (found []pmux.Proxy, err error) {
+			for _, v := range ipPortRegex.FindAll(body, -1) {
+				found = append(found, pmux.NewProxy(string(v), protocol))
+			}
+			return found, nil
+		}, nil
+	}
+	re, err := regexp.Compile(d.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("regex: %w", err)
+	}
+	host, port, proto := re.SubexpIndex("host"), re.SubexpIndex("port"), re.SubexpIndex("protocol")
+	return func(_ context.Context, body []byte, protocol string) (found []pmux.Proxy, err error) {
+		for _, m := range re.FindAllSubmatch(body, -1) {
+			addr := string(m[0])
+			if host > 0 && port > 0 {
+				addr = net.JoinHostPort(string(m[host]), string(m[port]))
+			}
+			p := protocol
+			if proto > 0 {
+				p = orProtocol(string(m[proto]), protocol)
+			}
+			found = append(found, pmux.NewProxy(addr, p))
+		}
+		return found, nil
+	}, nil
+}
+
+func (d Declared) extractTable(ctx context.Context, body []byte, protocol string) (found []pmux.Proxy, err error) {
+	page, err := htmltable.New(ctx, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	if d.Columns.Protocol == "" {
+		err = page.Each2(d.Columns.Host, d.Columns.Port, func(host, port string) error {
+			found = append(found, pmux.NewProxy(net.JoinHostPort(host, port), protocol))
+			return nil
+		})
+		return found, err
+	}
+	err = page.Each3(d.Columns.Host, d.Columns.Port, d.Columns.Protocol, func(host, port, p string) error {
+		found = append(found, pmux.NewProxy(net.JoinHostPort(host, port), orProtocol(p, protocol)))
+		return nil
+	})
+	return found, err
+}
+
+// orProtocol returns known protocol from the page or the default one
+func orProtocol(p, def string) string {
+	p = strings.ToLower(strings.TrimSpace(p))
+	if knownProtocols[p] {
+		return p
+	}
+	return def
+}
@@ -0,0 +1,169 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func declaredServer(t *testing.T) *httptest.Server {
+	pages := map[string]string{
+		"/list.txt":   "Proxy List\n127.0.0.1:8080\n127.0.0.2:8080\n",
+		"/custom.txt": "Proxy List\nsocks5 127.0.0.3 1080\nhttp 127.0.0.4 8080\n",
+		"/table.html": `<table>
+			<tr><th>IP Address</th><th>Port</th><th>Type</th></tr>
+			<tr><td>127.0.0.5</td><td>1080</td><td>SOCKS4</td></tr>
+			<tr><td>127.0.0.6</td><td>8080</td><td>unknown</td></tr>
+		</table>`,
+		"/api.json": `{"data": {"items": [
+			{"ip": "127.0.0.7", "port": 1080, "protocol": "socks5"},
+			{"ip": "127.0.0.8", "port": "3128"},
+			"127.0.0.9:80"
+		]}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "abc" {
+			w.WriteHeader(403)
+			return
+		}
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func consumeDeclared(t *testing.T, d Declared) []string {
+	s, err := d.Source()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	feed := s.Feed(ctx, http.DefaultClient)
+	found := []string{}
+	for _, v := range consumeSource(ctx, feed) {
+		found = append(found, v.String())
+	}
+	require.NoError(t, feed.Err())
+	sort.Strings(found)
+	return found
+}
+
+func TestDeclaredExtract(t *testing.T) {
+	srv := declaredServer(t)
+	headers := map[string]string{"X-Token": "abc"}
+	tests := []struct {
+		name   string
+		d      Declared
+		expect []string
+	}{
+		{"regex", Declared{
+			URLs:   map[string][]string{"https": {srv.URL + "/list.txt"}},
+			Expect: "Proxy List",
+		}, []string{"https://127.0.0.1:8080", "https://127.0.0.2:8080"}},
+		{"custom regex", Declared{
+			URLs:  map[string][]string{"http": {srv.URL + "/custom.txt"}},
+			Regex: `(?P<protocol>\w+) (?P<host>[\d.]+) (?P<port>\d+)`,
+		}, []string{"http://127.0.0.4:8080", "socks5://127.0.0.3:1080"}},
+		{"table", Declared{
+			URLs:    map[string][]string{"http": {srv.URL + "/table.html"}},
+			Extract: "table",
+			Columns: Columns{Host: "IP Address", Port: "Port", Protocol: "Type"},
+		}, []string{"http://127.0.0.6:8080", "socks4://127.0.0.5:1080"}},
+		{"json", Declared{
+			URLs:    map[string][]string{"http": {srv.URL + "/api.json"}},
+			Extract: "json",
+			JSON:    JSONAPI{Items: "data.items"},
+		}, []string{"http://127.0.0.8:3128", "http://127.0.0.9:80", "socks5://127.0.0.7:1080"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.d.Name = tt.name
+			tt.d.Headers = headers
+			assert.Equal(t, tt.expect, consumeDeclared(t, tt.d))
+		})
+	}
+}
+
+func TestDeclaredSourceErrors(t *testing.T) {
+	urls := map[string][]string{"http": {"http://localhost/"}}
+	tests := []struct {
+		d   Declared
+		err string
+	}{
+		{Declared{}, "no name"},
+		{Declared{Name: "a"}, "a: no urls"},
+		{Declared{Name: "a", URLs: map[string][]string{"gopher": {"x"}}}, "a: unknown protocol: gopher"},
+		{Declared{Name: "a", URLs: urls, Frequency: "often"}, "a: invalid frequency: often"},
+		{Declared{Name: "a", URLs: urls, Extract: "xml"}, "a: unknown extract: xml"},
+		{Declared{Name: "a", URLs: urls, Extract: "table"}, "a: table: host and port columns are required"},
+		{Declared{Name: "a", URLs: urls, Regex: "("}, "a: regex: error parsing regexp: missing closing ): `(`"},
+		{Declared{Name: "a", URLs: urls, Extract: "json", JSON: JSONAPI{Items: "data["}}, "a: json: invalid selector: data["},
+	}
+	for _, tt := range tests {
+		_, err := tt.d.Source()
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestLoadAndDeclare(t *testing.T) {
+	defer func(orig []Source) {
+		Sources = orig
+	}(Sources)
+	file := filepath.Join(t.TempDir(), "sources.yml")
+	err := os.WriteFile(file, []byte(`
+- name: first
+  homepage: https://example.com
+  urls:
+    socks5:
+    - https://example.com/socks5.txt
+  frequency: 30m
+  seed: true
+- name: second
+  urls:
+    http: [https://example.com/http.txt]
+`), 0600)
+	require.NoError(t, err)
+
+	declared, err := LoadDeclared(file)
+	require.NoError(t, err)
+	require.Len(t, declared, 2)
+	assert.Equal(t, "first", declared[0].Name())
+	assert.Equal(t, 30*time.Minute, declared[0].Frequency)
+	assert.True(t, declared[0].Seed)
+	assert.Equal(t, 1*time.Hour, declared[1].Frequency)
+
+	// IDs don't depend on the position in the file
+	again, err := Declared{Name: "first", URLs: map[string][]string{"http": {"x"}}}.Source()
+	require.NoError(t, err)
+	assert.Equal(t, declared[0].ID, again.ID)
+	assert.Greater(t, again.ID, declaredIDs)
+
+	builtin := len(Sources)
+	require.NoError(t, Declare(declared))
+	assert.Len(t, Sources, builtin+2)
+	assert.Equal(t, declared[1].ID, ByName("second").ID)
+
+	// declaring again replaces previous sources
+	require.NoError(t, Declare(declared[:1]))
+	assert.Len(t, Sources, builtin+1)
+
+	err = Declare([]Source{declared[0], declared[0]})
+	assert.EqualError(t, err, "duplicate source name: first")
+
+	taken, err := Declared{Name: "import", URLs: map[string][]string{"http": {"x"}}}.Source()
+	require.NoError(t, err)
+	err = Declare([]Source{taken})
+	assert.EqualError(t, err, "duplicate source name: import")
+
+	err = os.WriteFile(file, []byte("- name: broken\n"), 0600)
+	require.NoError(t, err)
+	_, err = LoadDeclared(file)
+	assert.EqualError(t, err, file+": source #1: broken: no urls")
+}
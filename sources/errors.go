@@ -45,7 +45,7 @@ func (se sourceError) Proxy() pmux.Proxy {
 			continue
 		}
 	}
-	return 0
+	return pmux.Proxy{}
 }
 
 func (se sourceError) Error() string {
@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/nfx/slrp/pmux"
@@ -54,7 +56,7 @@ func fate0(ctx context.Context, h *http.Client) (found []pmux.Proxy, err error)
 			continue
 		}
 		found = append(found, pmux.NewProxy(
-			fmt.Sprintf("%s:%d", line.Host, line.Port),
+			net.JoinHostPort(line.Host, strconv.Itoa(line.Port)),
 			line.Type))
 	}
 	return
@@ -0,0 +1,237 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// listFileFrequency is large, because watched files are refreshed on change
+const listFileFrequency = 24 * time.Hour
+
+// Directory has *.txt and *.csv files with proxies, where every file becomes
+// the source named like file:socks5.txt. Proxies without protocol get it from
+// the file name, like socks5.txt or http.csv, and default to http.
+type Directory struct {
+	dir   string
+	mu    sync.Mutex
+	files map[string]*listFile
+}
+
+func NewDirectory(dir string) *Directory {
+	return &Directory{
+		dir:   dir,
+		files: map[string]*listFile{},
+	}
+}
+
+// Scan registers sources for new files and returns names of sources, whose
+// files were changed or deleted since they were read the last time.
+func (d *Directory) Scan(ctx context.Context) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	log := app.Log.From(ctx)
+	for _, pattern := range []string{"*.txt", "*.csv"} {
+		files, err := filepath.Glob(filepath.Join(d.dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range files {
+			_, ok := d.files[path]
+			if ok {
+				continue
+			}
+			f := newListFile(path)
+			err = Register(f.source())
+			if err != nil {
+				// file is not retried until restart, so that logs are not flooded
+				log.Warn().Err(err).Str("file", path).Msg("cannot watch")
+				f = nil
+			}
+			d.files[path] = f
+		}
+	}
+	changed := []string{}
+	for _, f := range d.files {
+		if f != nil && f.changed() {
+			changed = append(changed, f.name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// listFile remembers the version of the file, that was read the last time,
+// and proxies it had, so that removed proxies are forgotten. This version is
+// kept only in memory, so proxies removed while slrp was not running stay
+// in the pool, until they stop working.
+type listFile struct {
+	path     string
+	name     string
+	format   string
+	protocol string
+	mu       sync.Mutex
+	listVersion
+}
+
+// listVersion is the state of the file after a single read
+type listVersion struct {
+	modTime time.Time
+	size    int64
+	proxies map[pmux.Proxy]bool
+}
+
+func newListFile(path string) *listFile {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	protocol := strings.ToLower(strings.TrimSuffix(base, ext))
+	if !knownProtocols[protocol] {
+		protocol = "http"
+	}
+	return &listFile{
+		path:     path,
+		name:     "file:" + base,
+		format:   strings.TrimPrefix(ext, "."),
+		protocol: protocol,
+		listVersion: listVersion{
+			proxies: map[pmux.Proxy]bool{},
+		},
+	}
+}
+
+func (f *listFile) source() Source {
+	return Source{
+		ID:        declaredID(f.name),
+		name:      f.name,
+		Frequency: listFileFrequency,
+		// files are read without HTTP client
+		Seed:     true,
+		declared: true,
+		Feed: func(ctx context.Context, _ *http.Client) Src {
+			return &fileSrc{
+				file: f,
+				out:  make(chan Signal),
+			}
+		},
+	}
+}
+
+// changed tells if the file differs from the version, that was read.
+// Deleted file is changed, until its proxies are forgotten.
+func (f *listFile) changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return len(f.proxies) > 0
+	}
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
+
+// read returns signals to add every proxy in the file and to forget
+// proxies, that were removed from it. The new version is committed only
+// after all signals are sent, so that interrupted refresh reads the file again.
+func (f *listFile) read() ([]Signal, listVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current := listVersion{
+		proxies: map[pmux.Proxy]bool{},
+	}
+	// stat goes before read, so that file modified in between is read again
+	info, err := os.Stat(f.path)
+	if err == nil {
+		current.modTime = info.ModTime()
+		current.size = info.Size()
+		body, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, current, err
+		}
+		entries, err := ParseList(f.format, body)
+		if err != nil {
+			// broken file is read again only after it's fixed
+			f.modTime = current.modTime
+			f.size = current.size
+			return nil, current, fmt.Errorf("%s: %w", f.path, err)
+		}
+		for _, v := range entries {
+			proxy := v.Proxy(f.protocol)
+			if proxy.Valid() {
+				current.proxies[proxy] = true
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, current, err
+	}
+	signals := []Signal{}
+	for proxy := range current.proxies {
+		signals = append(signals, Signal{
+			Proxy: proxy,
+			Add:   true,
+		})
+	}
+	for proxy := range f.proxies {
+		if current.proxies[proxy] {
+			continue
+		}
+		signals = append(signals, Signal{
+			Proxy: proxy,
+			Err:   fmt.Errorf("removed from %s", f.name),
+		})
+	}
+	return signals, current, nil
+}
+
+// commit remembers the version, once all of its signals were sent
+func (f *listFile) commit(v listVersion) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listVersion = v
+}
+
+// fileSrc emits signals of a single read of the file
+type fileSrc struct {
+	file *listFile
+	out  chan Signal
+	err  error
+	len  int
+}
+
+func (s *fileSrc) Generate(ctx context.Context) <-chan Signal {
+	go s.generate(ctx)
+	return s.out
+}
+
+func (s *fileSrc) Err() error {
+	return s.err
+}
+
+func (s *fileSrc) Len() int {
+	return s.len
+}
+
+func (s *fileSrc) generate(ctx context.Context) {
+	defer close(s.out)
+	signals, version, err := s.file.read()
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.len = len(signals)
+	for _, v := range signals {
+		select {
+		case <-ctx.Done():
+			return
+		case s.out <- v:
+		}
+	}
+	s.file.commit(version)
+}
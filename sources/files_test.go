@@ -0,0 +1,145 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readSignals(t *testing.T, name string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	feed := ByName(name).Feed(ctx, http.DefaultClient)
+	found := []string{}
+	for v := range feed.Generate(ctx) {
+		if v.Add {
+			found = append(found, "+"+v.Proxy.String())
+		} else {
+			found = append(found, "-"+v.Proxy.String())
+		}
+	}
+	require.NoError(t, feed.Err())
+	assert.Equal(t, len(found), feed.Len())
+	sort.Strings(found)
+	return found
+}
+
+func writeList(t *testing.T, file, body string, mod time.Time) {
+	err := os.WriteFile(file, []byte(body), 0600)
+	require.NoError(t, err)
+	err = os.Chtimes(file, mod, mod)
+	require.NoError(t, err)
+}
+
+func TestDirectoryScan(t *testing.T) {
+	defer func(orig []Source) {
+		Sources = orig
+	}(Sources)
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "socks5.txt")
+	mod := time.Now().Add(-1 * time.Hour)
+	writeList(t, file, "127.0.0.1:1080\nhttp://127.0.0.2:8080\n", mod)
+	writeList(t, filepath.Join(dir, "list.csv"), "Host,Port\n127.0.0.3,3128\n", mod)
+	err := os.WriteFile(filepath.Join(dir, "notes.md"), []byte("127.0.0.4:80"), 0600)
+	require.NoError(t, err)
+
+	d := NewDirectory(dir)
+	changed, err := d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file:list.csv", "file:socks5.txt"}, changed)
+	assert.Equal(t, declaredID("file:socks5.txt"), ByName("file:socks5.txt").ID)
+
+	assert.Equal(t, []string{"+http://127.0.0.3:3128"}, readSignals(t, "file:list.csv"))
+	assert.Equal(t, []string{
+		"+http://127.0.0.2:8080",
+		"+socks5://127.0.0.1:1080",
+	}, readSignals(t, "file:socks5.txt"))
+
+	changed, err = d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// removed proxies are forgotten
+	writeList(t, file, "127.0.0.1:1080\n127.0.0.5:1080\n", mod.Add(1*time.Minute))
+	changed, err = d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file:socks5.txt"}, changed)
+	assert.Equal(t, []string{
+		"+socks5://127.0.0.1:1080",
+		"+socks5://127.0.0.5:1080",
+		"-http://127.0.0.2:8080",
+	}, readSignals(t, "file:socks5.txt"))
+
+	// deleted file is changed, until all of its proxies are forgotten
+	require.NoError(t, os.Remove(file))
+	changed, err = d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file:socks5.txt"}, changed)
+	assert.Equal(t, []string{
+		"-socks5://127.0.0.1:1080",
+		"-socks5://127.0.0.5:1080",
+	}, readSignals(t, "file:socks5.txt"))
+	changed, err = d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+}
+
+func TestDirectoryCancelledRead(t *testing.T) {
+	defer func(orig []Source) {
+		Sources = orig
+	}(Sources)
+	dir := t.TempDir()
+	writeList(t, filepath.Join(dir, "http.txt"), "127.0.0.1:8080\n127.0.0.2:8080\n", time.Now())
+
+	d := NewDirectory(dir)
+	changed, err := d.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file:http.txt"}, changed)
+
+	// nothing reads signals of the cancelled refresh
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	feed := ByName("file:http.txt").Feed(ctx, http.DefaultClient)
+	feed.(*fileSrc).generate(ctx)
+
+	// file is read again, because not all of its proxies were sent
+	changed, err = d.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file:http.txt"}, changed)
+	assert.Equal(t, []string{
+		"+http://127.0.0.1:8080",
+		"+http://127.0.0.2:8080",
+	}, readSignals(t, "file:http.txt"))
+}
+
+func TestDirectoryBrokenFile(t *testing.T) {
+	defer func(orig []Source) {
+		Sources = orig
+	}(Sources)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeList(t, filepath.Join(dir, "broken.csv"), "\"127.0.0.1\n", time.Now())
+
+	d := NewDirectory(dir)
+	changed, err := d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file:broken.csv"}, changed)
+
+	feed := ByName("file:broken.csv").Feed(ctx, http.DefaultClient)
+	for range feed.Generate(ctx) {
+	}
+	assert.ErrorContains(t, feed.Err(), "broken.csv: ")
+
+	// broken file is not read again, until it's changed
+	changed, err = d.Scan(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+}
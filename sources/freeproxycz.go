@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -64,7 +65,7 @@ func freeProxyCz(ctx context.Context, h *http.Client) Src {
 				if err != nil {
 					return err
 				}
-				proxy := pmux.NewProxy(fmt.Sprintf("%s:%s", addr, b), strings.ToLower(c))
+				proxy := pmux.NewProxy(net.JoinHostPort(string(addr), b), strings.ToLower(c))
 				found = append(found, proxy)
 				return nil
 			})
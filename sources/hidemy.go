@@ -3,6 +3,7 @@ package sources
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -42,7 +43,7 @@ func hidemyName(ctx context.Context, h *http.Client) Src {
 			err = p.Each3("IP address", "Port", "Type", func(host, port, types string) error {
 				for _, v := range strings.Split(types, ",") {
 					v = strings.ToLower(strings.TrimSpace(v))
-					proxy := pmux.NewProxy(fmt.Sprintf("%s:%s", host, port), v)
+					proxy := pmux.NewProxy(net.JoinHostPort(host, port), v)
 					found = append(found, proxy)
 				}
 				return nil
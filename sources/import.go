@@ -0,0 +1,12 @@
+package sources
+
+// Import is the source of proxies, that external crawlers push through
+// POST /api/probe/import. It has no feed, so refresher never starts it.
+const Import = 100
+
+func init() {
+	Sources = append(Sources, Source{
+		ID:   Import,
+		name: "import",
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +25,9 @@ type Source struct {
 	expectString string
 
 	Feed func(context.Context, *http.Client) Src
+
+	// declared sources come from YAML file and are replaced on reload
+	declared bool
 }
 
 func (s Source) Name() string {
@@ -42,8 +46,38 @@ func (s Source) Name() string {
 
 var Sources = []Source{}
 
+// mu guards Sources, that are replaced by Declare and Register
+// while the app is running. Both build a new slice, so that
+// the one returned by All can be iterated without lock.
+var mu sync.RWMutex
+
+// All returns every known source
+func All() []Source {
+	mu.RLock()
+	defer mu.RUnlock()
+	return Sources
+}
+
+// Register adds the source, that was discovered while the app is running
+func Register(s Source) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range Sources {
+		if v.Name() == s.Name() {
+			return fmt.Errorf("duplicate source name: %s", s.Name())
+		}
+		if v.ID == s.ID {
+			return fmt.Errorf("source %s has the same ID as %s, rename one of them", s.Name(), v.Name())
+		}
+	}
+	srcs := make([]Source, len(Sources), len(Sources)+1)
+	copy(srcs, Sources)
+	Sources = append(srcs, s)
+	return nil
+}
+
 func ByID(id int) Source {
-	for _, s := range Sources {
+	for _, s := range All() {
 		if s.ID != id {
 			continue
 		}
@@ -55,7 +89,7 @@ func ByID(id int) Source {
 }
 
 func ByName(name string) Source {
-	for _, s := range Sources {
+	for _, s := range All() {
 		if s.Name() != name {
 			continue
 		}
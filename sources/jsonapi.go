@@ -0,0 +1,432 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// JSONAPI describes a provider, that returns proxies in JSON responses.
+// Fields are selectors like `data.items`, `protocols[0]` or `protocols[*]`.
+type JSONAPI struct {
+	// Items selects the array of proxies. Response itself, when empty.
+	Items string `json:"items,omitempty"`
+	// Host, Port and Protocol select fields of every item. Host defaults
+	// to `ip`, Port to `port` and Protocol to `protocol`.
+	Host     string `json:"host,omitempty"`
+	Port     string `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Address selects `IP:port` field instead of Host and Port
+	Address string `json:"address,omitempty"`
+	// Protocols map provider values to protocols, like `4: socks5`.
+	// Items with values, that are not mapped, are skipped.
+	Protocols map[string]string `json:"protocols,omitempty"`
+	// Filter keeps items, where the selected value is one of the listed
+	Filter     map[string][]string `json:"filter,omitempty"`
+	Pagination Pagination          `json:"pagination,omitempty"`
+}
+
+// Pagination tells how to get the next page. Requests stop on the empty page,
+// after MaxPages, or once other conditions are met.
+type Pagination struct {
+	// Type is one of page, next or cursor. Only the first page is fetched,
+	// when empty.
+	Type string `json:"type,omitempty"`
+	// Param is the query parameter with page number or cursor
+	Param string `json:"param,omitempty"`
+	// Start is the number of the first page. Defaults to 1.
+	Start int `json:"start,omitempty"`
+	// Next selects URL of the next page or the cursor
+	Next string `json:"next,omitempty"`
+	// Total selects the number of items in all pages
+	Total string `json:"total,omitempty"`
+	// Last selects the flag, that is true on the last page
+	Last     string `json:"last,omitempty"`
+	MaxPages int    `json:"max_pages,omitempty"`
+}
+
+// defaultMaxPages protects from providers, that never return an empty page
+const defaultMaxPages = 100
+
+// jsonAPI is the JSONAPI with parsed selectors
+type jsonAPI struct {
+	items     selector
+	host      selector
+	port      selector
+	protocol  selector
+	address   selector
+	protocols map[string]string
+	filter    map[string]jsonFilter
+	paginate  string
+	param     string
+	start     int
+	next      selector
+	total     selector
+	last      selector
+	maxPages  int
+}
+
+type jsonFilter struct {
+	selector selector
+	allowed  map[string]bool
+}
+
+func (j JSONAPI) compile() (*jsonAPI, error) {
+	api := &jsonAPI{
+		protocols: map[string]string{},
+		filter:    map[string]jsonFilter{},
+		paginate:  j.Pagination.Type,
+		param:     j.Pagination.Param,
+		start:     j.Pagination.Start,
+		maxPages:  j.Pagination.MaxPages,
+	}
+	selectors := []struct {
+		dst *selector
+		raw string
+		def string
+	}{
+		{&api.items, j.Items, ""},
+		{&api.host, j.Host, "ip"},
+		{&api.port, j.Port, "port"},
+		{&api.protocol, j.Protocol, "protocol"},
+		{&api.address, j.Address, ""},
+		{&api.next, j.Pagination.Next, ""},
+		{&api.total, j.Pagination.Total, ""},
+		{&api.last, j.Pagination.Last, ""},
+	}
+	for _, v := range selectors {
+		raw := v.raw
+		if raw == "" {
+			raw = v.def
+		}
+		s, err := parseSelector(raw)
+		if err != nil {
+			return nil, err
+		}
+		*v.dst = s
+	}
+	for k, v := range j.Protocols {
+		protocol := strings.ToLower(v)
+		if !knownProtocols[protocol] {
+			return nil, fmt.Errorf("protocols: %s: unknown protocol: %s", k, v)
+		}
+		api.protocols[strings.ToLower(k)] = protocol
+	}
+	for k, values := range j.Filter {
+		s, err := parseSelector(k)
+		if err != nil {
+			return nil, err
+		}
+		allowed := map[string]bool{}
+		for _, v := range values {
+			allowed[strings.ToLower(v)] = true
+		}
+		api.filter[k] = jsonFilter{s, allowed}
+	}
+	switch api.paginate {
+	case "":
+	case "page":
+		if api.param == "" {
+			api.param = "page"
+		}
+		if api.start == 0 {
+			api.start = 1
+		}
+	case "next":
+		if api.next == nil {
+			return nil, fmt.Errorf("pagination: next selector is required")
+		}
+	case "cursor":
+		if api.next == nil {
+			return nil, fmt.Errorf("pagination: next selector is required")
+		}
+		if api.param == "" {
+			api.param = "cursor"
+		}
+	default:
+		return nil, fmt.Errorf("pagination: unknown type: %s", api.paginate)
+	}
+	if api.maxPages == 0 {
+		api.maxPages = defaultMaxPages
+	}
+	return api, nil
+}
+
+// fetch goes through all pages, where protocol is used for items without one
+func (api *jsonAPI) fetch(ctx context.Context, h *http.Client, r req, protocol string) func() ([]pmux.Proxy, error) {
+	return func() ([]pmux.Proxy, error) {
+		log := app.Log.From(ctx)
+		found := []pmux.Proxy{}
+		first := r.URL
+		current := first
+		items := 0
+		for page := 0; page < api.maxPages; page++ {
+			var err error
+			if api.paginate == "page" {
+				current, err = withQuery(first, api.param, strconv.Itoa(api.start+page))
+				if err != nil {
+					return nil, err
+				}
+			}
+			r.URL = current
+			body, serial, err := r.Do(ctx, h)
+			if err != nil {
+				return nil, err
+			}
+			var doc any
+			err = json.Unmarshal(body, &doc)
+			if err != nil {
+				return nil, skipErr(err, intEC{"serial", serial}, strEC{"url", current})
+			}
+			list, ok := api.items.first(doc).([]any)
+			if !ok || len(list) == 0 {
+				break
+			}
+			items += len(list)
+			for _, item := range list {
+				for _, proxy := range api.proxies(item, protocol) {
+					// items without host or port are skipped
+					if proxy.Valid() {
+						found = append(found, proxy)
+					}
+				}
+			}
+			log.Info().Int("page", page+1).Int("count", len(found)).Msg("loaded page")
+			if api.done(doc, items) {
+				break
+			}
+			next := jsonString(api.next.first(doc))
+			if next == "" && api.paginate != "page" {
+				break
+			}
+			switch api.paginate {
+			case "next":
+				current, err = resolveURL(current, next)
+			case "cursor":
+				current, err = withQuery(first, api.param, next)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return found, nil
+	}
+}
+
+// done tells if the page is the last one
+func (api *jsonAPI) done(doc any, items int) bool {
+	if api.paginate == "" {
+		return true
+	}
+	if api.last != nil && truthy(api.last.first(doc)) {
+		return true
+	}
+	if api.total != nil {
+		total, err := strconv.Atoi(jsonString(api.total.first(doc)))
+		if err == nil && items >= total {
+			return true
+		}
+	}
+	return false
+}
+
+// proxies returns proxy for every protocol of the item
+func (api *jsonAPI) proxies(item any, protocol string) (found []pmux.Proxy) {
+	if addr, ok := item.(string); ok {
+		return []pmux.Proxy{pmux.NewProxy(addr, protocol)}
+	}
+	for _, f := range api.filter {
+		if !f.match(item) {
+			return nil
+		}
+	}
+	var addr string
+	if api.address != nil {
+		addr = jsonString(api.address.first(item))
+	} else {
+		host := jsonString(api.host.first(item))
+		port := jsonString(api.port.first(item))
+		addr = net.JoinHostPort(host, port)
+	}
+	values := api.protocol.all(item)
+	if len(values) == 0 {
+		values = []any{nil}
+	}
+	for _, v := range values {
+		p := strings.ToLower(jsonString(v))
+		if len(api.protocols) > 0 {
+			mapped, ok := api.protocols[p]
+			if !ok {
+				continue
+			}
+			p = mapped
+		}
+		found = append(found, pmux.NewProxy(addr, orProtocol(p, protocol)))
+	}
+	return found
+}
+
+func (f jsonFilter) match(item any) bool {
+	for _, v := range f.selector.all(item) {
+		if f.allowed[strings.ToLower(jsonString(v))] {
+			return true
+		}
+	}
+	return false
+}
+
+// selector is the path in JSON document, like `data.items[0].ip` or
+// `protocols[*]`. Leading `$.` is optional.
+type selector []string
+
+func parseSelector(raw string) (selector, error) {
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "$"), ".")
+	if raw == "" {
+		return nil, nil
+	}
+	s := selector{}
+	for _, part := range strings.Split(raw, ".") {
+		for part != "" {
+			open := strings.Index(part, "[")
+			if open == -1 {
+				s = append(s, part)
+				break
+			}
+			if open > 0 {
+				s = append(s, part[:open])
+			}
+			end := strings.Index(part, "]")
+			if end < open {
+				return nil, fmt.Errorf("invalid selector: %s", raw)
+			}
+			idx := part[open+1 : end]
+			if idx != "*" {
+				_, err := strconv.Atoi(idx)
+				if err != nil {
+					return nil, fmt.Errorf("invalid selector: %s", raw)
+				}
+			}
+			s = append(s, "["+idx+"]")
+			part = part[end+1:]
+		}
+	}
+	return s, nil
+}
+
+// all returns every selected value, where arrays at the end are flattened
+func (s selector) all(doc any) []any {
+	values := []any{doc}
+	for _, key := range s {
+		next := []any{}
+		for _, v := range values {
+			next = append(next, step(v, key)...)
+		}
+		values = next
+	}
+	res := []any{}
+	for _, v := range values {
+		arr, ok := v.([]any)
+		if ok {
+			res = append(res, arr...)
+			continue
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// first returns the selected value without flattening arrays
+func (s selector) first(doc any) any {
+	for _, key := range s {
+		values := step(doc, key)
+		if len(values) == 0 {
+			return nil
+		}
+		doc = values[0]
+	}
+	return doc
+}
+
+func step(v any, key string) []any {
+	if strings.HasPrefix(key, "[") {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil
+		}
+		idx := key[1 : len(key)-1]
+		if idx == "*" {
+			return arr
+		}
+		i, _ := strconv.Atoi(idx)
+		if i < 0 || i >= len(arr) {
+			return nil
+		}
+		return []any{arr[i]}
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	child, ok := obj[key]
+	if !ok || child == nil {
+		return nil
+	}
+	return []any{child}
+}
+
+func jsonString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		return ""
+	}
+}
+
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return x != "" && x != "0" && x != "false"
+	default:
+		return false
+	}
+}
+
+func withQuery(raw, key, value string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	qs := u.Query()
+	qs.Set(key, value)
+	u.RawQuery = qs.Encode()
+	return u.String(), nil
+}
+
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
@@ -0,0 +1,190 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonAPIServer serves testdata/jsonapi fixtures, like next2.json for
+// /next?page=2, and counts requests
+func jsonAPIServer(t *testing.T, requests *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		page := r.FormValue("page")
+		switch r.FormValue("cursor") {
+		case "abc":
+			page = "2"
+		case "def":
+			page = "3"
+		}
+		if page == "" {
+			page = "1"
+		}
+		raw, err := os.ReadFile("testdata/jsonapi" + r.URL.Path + page + ".json")
+		if err != nil {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write(raw)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestJSONAPIPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		api      JSONAPI
+		expect   []string
+		requests int
+	}{
+		{"next link and protocol mapping", "/next", JSONAPI{
+			Items:     "$.results",
+			Address:   "addr",
+			Protocol:  "type",
+			Protocols: map[string]string{"1": "http", "2": "https", "4": "socks5"},
+			Pagination: Pagination{
+				Type: "next",
+				Next: "links.next",
+			},
+		}, []string{
+			"http://127.0.0.1:8080",
+			"https://127.0.0.3:3128",
+			"socks5://127.0.0.2:1080",
+		}, 2},
+		{"cursor and last page flag", "/cursor", JSONAPI{
+			Items: "proxies",
+			Host:  "host.ip",
+			Port:  "host.port",
+			Pagination: Pagination{
+				Type: "cursor",
+				Next: "meta.cursor",
+				Last: "meta.last",
+			},
+		}, []string{
+			"socks4://127.0.0.1:8080",
+			"socks4://127.0.0.2:8080",
+		}, 2},
+		{"page number and total", "/total", JSONAPI{
+			Items: "items",
+			Pagination: Pagination{
+				Type:  "page",
+				Total: "total",
+			},
+		}, []string{
+			"socks4://127.0.0.1:1080",
+			"socks4://127.0.0.2:1080",
+			"socks4://127.0.0.3:1080",
+		}, 2},
+		{"empty page", "/next", JSONAPI{
+			Items:   "results",
+			Address: "addr",
+			Pagination: Pagination{
+				Type:  "page",
+				Start: 2,
+			},
+		}, []string{
+			"socks4://127.0.0.3:3128",
+			"socks4://127.0.0.4:1080",
+		}, 2},
+		{"max pages", "/total", JSONAPI{
+			Items: "items",
+			Pagination: Pagination{
+				Type:     "page",
+				MaxPages: 1,
+			},
+		}, []string{
+			"socks4://127.0.0.1:1080",
+			"socks4://127.0.0.2:1080",
+		}, 1},
+		{"incomplete items", "/incomplete", JSONAPI{
+			Items: "proxies",
+			Host:  "host.ip",
+			Port:  "host.port",
+		}, []string{
+			"socks4://127.0.0.1:8080",
+		}, 1},
+		{"no pagination", "/next", JSONAPI{
+			Items:   "results",
+			Address: "addr",
+		}, []string{
+			"socks4://127.0.0.1:8080",
+			"socks4://127.0.0.2:1080",
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			srv := jsonAPIServer(t, &requests)
+			api, err := tt.api.compile()
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			proxies, err := api.fetch(ctx, http.DefaultClient, req{URL: srv.URL + tt.path}, "socks4")()
+			require.NoError(t, err)
+			found := []string{}
+			for _, v := range proxies {
+				found = append(found, v.String())
+			}
+			sort.Strings(found)
+			assert.Equal(t, tt.expect, found)
+			assert.Equal(t, tt.requests, requests)
+		})
+	}
+}
+
+func TestJSONAPICompileErrors(t *testing.T) {
+	tests := []struct {
+		api JSONAPI
+		err string
+	}{
+		{JSONAPI{Items: "data[x]"}, "invalid selector: data[x]"},
+		{JSONAPI{Host: "a]b["}, "invalid selector: a]b["},
+		{JSONAPI{Protocols: map[string]string{"1": "gopher"}}, "protocols: 1: unknown protocol: gopher"},
+		{JSONAPI{Pagination: Pagination{Type: "next"}}, "pagination: next selector is required"},
+		{JSONAPI{Pagination: Pagination{Type: "cursor"}}, "pagination: next selector is required"},
+		{JSONAPI{Pagination: Pagination{Type: "offset"}}, "pagination: unknown type: offset"},
+	}
+	for _, tt := range tests {
+		_, err := tt.api.compile()
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	doc := map[string]any{
+		"data": []any{
+			map[string]any{"ip": "127.0.0.1", "protocols": []any{"http", "https"}},
+			map[string]any{"ip": "127.0.0.2", "protocols": []any{"socks5"}},
+		},
+	}
+	tests := []struct {
+		selector string
+		first    any
+		all      []any
+	}{
+		{"data[0].ip", "127.0.0.1", []any{"127.0.0.1"}},
+		{"$.data[1].protocols[0]", "socks5", []any{"socks5"}},
+		{"data[*].ip", "127.0.0.1", []any{"127.0.0.1", "127.0.0.2"}},
+		{"data[0].protocols", []any{"http", "https"}, []any{"http", "https"}},
+		{"data[5].ip", nil, []any{}},
+		{"missing", nil, []any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := parseSelector(tt.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tt.first, s.first(doc))
+			assert.Equal(t, tt.all, s.all(doc))
+		})
+	}
+}
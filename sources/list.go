@@ -0,0 +1,185 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/nfx/slrp/pmux"
+)
+
+// ListEntry is a single proxy from a list, optionally with its protocol
+type ListEntry struct {
+	Raw      string
+	Protocol string
+}
+
+// Proxy parses the entry, where protocol is used for addresses without scheme
+func (e ListEntry) Proxy(protocol string) pmux.Proxy {
+	raw := strings.TrimSpace(e.Raw)
+	if scheme, rest, ok := strings.Cut(raw, "://"); ok {
+		// pmux falls back to HTTP for unknown schemes, like ftp://
+		scheme = strings.ToLower(scheme)
+		if !knownProtocols[scheme] {
+			return pmux.Proxy{}
+		}
+		return pmux.NewProxyFromURL(scheme + "://" + rest)
+	}
+	if e.Protocol != "" {
+		protocol = strings.ToLower(e.Protocol)
+	}
+	if !knownProtocols[protocol] {
+		return pmux.Proxy{}
+	}
+	return pmux.NewProxy(raw, protocol)
+}
+
+// ParseList reads proxies from newline-separated list, JSON array or CSV
+func ParseList(format string, body []byte) ([]ListEntry, error) {
+	switch format {
+	case "txt":
+		return parseListText(body)
+	case "json":
+		return parseListJSON(body)
+	case "csv":
+		return parseListCSV(body)
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// parseListText reads one proxy per line, optionally followed by protocol,
+// like `1.2.3.4:1080 socks5`. Empty lines and comments are skipped.
+func parseListText(body []byte) (entries []ListEntry, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entry := ListEntry{Raw: fields[0]}
+		if len(fields) > 1 {
+			entry.Protocol = fields[1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// parseListJSON reads an array of proxy URLs or of objects, like
+// {"ip": "1.2.3.4", "port": 1080, "protocol": "socks5"}. Output of
+// pool export in JSON format is accepted as well.
+func parseListJSON(body []byte) (entries []ListEntry, err error) {
+	var raw []json.RawMessage
+	err = json.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	for _, v := range raw {
+		var str string
+		if json.Unmarshal(v, &str) == nil {
+			entries = append(entries, ListEntry{Raw: str})
+			continue
+		}
+		var obj map[string]any
+		if json.Unmarshal(v, &obj) != nil {
+			// invalid entries are reported by their position
+			entries = append(entries, ListEntry{})
+			continue
+		}
+		fields := map[string]string{}
+		for k, v := range obj {
+			if v == nil {
+				continue
+			}
+			fields[strings.ToLower(k)] = fmt.Sprint(v)
+		}
+		entries = append(entries, newListEntry(fields))
+	}
+	return entries, nil
+}
+
+// parseListCSV reads rows with a header, that names the columns, like
+// `ip,port,protocol`. Without a known header, the first column is the proxy
+// and the second one is the optional protocol.
+func parseListCSV(body []byte) (entries []ListEntry, err error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := []string{}
+	for _, v := range rows[0] {
+		header = append(header, strings.ToLower(strings.TrimSpace(v)))
+	}
+	if !isListHeader(header) {
+		header = []string{"proxy", "protocol"}
+	} else {
+		rows = rows[1:]
+	}
+	for _, row := range rows {
+		fields := map[string]string{}
+		for i, v := range row {
+			if i < len(header) {
+				fields[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		entries = append(entries, newListEntry(fields))
+	}
+	return entries, nil
+}
+
+var (
+	listProxyColumns    = []string{"proxy", "url"}
+	listHostColumns     = []string{"ip", "host", "address", "addr"}
+	listProtocolColumns = []string{"protocol", "type", "scheme"}
+)
+
+func isListHeader(header []string) bool {
+	for _, v := range header {
+		for _, name := range append(listProxyColumns, listHostColumns...) {
+			if v == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newListEntry makes an entry from fields with lowercase names
+func newListEntry(fields map[string]string) ListEntry {
+	entry := ListEntry{
+		Raw:      first(fields, listProxyColumns),
+		Protocol: first(fields, listProtocolColumns),
+	}
+	if entry.Raw != "" {
+		return entry
+	}
+	host := first(fields, listHostColumns)
+	port := fields["port"]
+	if host != "" && port != "" {
+		entry.Raw = net.JoinHostPort(host, port)
+	} else {
+		entry.Raw = host
+	}
+	return entry
+}
+
+func first(fields map[string]string, names []string) string {
+	for _, name := range names {
+		v, ok := fields[name]
+		if ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		format   string
+		body     string
+		protocol string
+		expect   []string
+	}{
+		{"txt", "# comment\n127.0.0.1:8080\n\n127.0.0.2:1080 socks5\nsocks4://127.0.0.3:1080\n",
+			"http", []string{"http://127.0.0.1:8080", "socks5://127.0.0.2:1080", "socks4://127.0.0.3:1080"}},
+		{"txt", "127.0.0.1:8080\nSOCKS5://127.0.0.2:1080", "https", []string{"https://127.0.0.1:8080", "socks5://127.0.0.2:1080"}},
+		{"json", `["127.0.0.1:8080", "socks5://127.0.0.2:1080"]`,
+			"http", []string{"http://127.0.0.1:8080", "socks5://127.0.0.2:1080"}},
+		{"json", `[{"ip": "127.0.0.1", "port": 1080, "protocol": "socks5"}, {"Proxy": "http://127.0.0.2:8080", "Ok": true}]`,
+			"http", []string{"socks5://127.0.0.1:1080", "http://127.0.0.2:8080"}},
+		{"csv", "Host,Port,Type\n127.0.0.1,1080,socks4\n127.0.0.2,8080,\n",
+			"http", []string{"socks4://127.0.0.1:1080", "http://127.0.0.2:8080"}},
+		{"csv", "127.0.0.1:1080,socks5\nhttp://127.0.0.2:8080\n",
+			"http", []string{"socks5://127.0.0.1:1080", "http://127.0.0.2:8080"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			entries, err := ParseList(tt.format, []byte(tt.body))
+			require.NoError(t, err)
+			actual := []string{}
+			for _, v := range entries {
+				actual = append(actual, v.Proxy(tt.protocol).String())
+			}
+			assert.Equal(t, tt.expect, actual)
+		})
+	}
+}
+
+func TestParseListErrors(t *testing.T) {
+	_, err := ParseList("xml", nil)
+	assert.EqualError(t, err, "unknown format: xml")
+
+	_, err = ParseList("json", []byte(`{"a": 1}`))
+	assert.ErrorContains(t, err, "json: ")
+
+	entries, err := ParseList("txt", []byte("127.0.0.1:8080 gopher\nlocalhost:8080\nftp://127.0.0.1:21\n"))
+	require.NoError(t, err)
+	assert.False(t, entries[0].Proxy("http").Valid())
+	assert.False(t, entries[1].Proxy("http").Valid())
+	assert.False(t, entries[2].Proxy("http").Valid())
+}
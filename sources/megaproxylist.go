@@ -115,7 +115,7 @@ func megaproxylist(ctx context.Context, h *http.Client) (found []pmux.Proxy, err
 		}
 
 		found = append(found,
-			pmux.NewProxy(fmt.Sprintf("%s:%s", addr, record[1]),
+			pmux.NewProxy(net.JoinHostPort(addr, record[1]),
 				"http"))
 	}
 
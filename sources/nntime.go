@@ -3,6 +3,7 @@ package sources
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -51,7 +52,7 @@ func newNetTimePage(ctx context.Context, h *http.Client, i int) func() ([]pmux.P
 				port = strings.ReplaceAll(port, k, v)
 			}
 			port = strings.ReplaceAll(port, "+", "")
-			found = append(found, pmux.HttpProxy(fmt.Sprintf("%s:%s", ip, port)))
+			found = append(found, pmux.HttpProxy(net.JoinHostPort(ip, port)))
 		}
 		return
 	}
@@ -0,0 +1,274 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/nfx/go-htmltable"
+	"github.com/nfx/slrp/app"
+	"github.com/nfx/slrp/pmux"
+)
+
+// pluginLoadTimeout limits the top-level code of a plugin, that runs on start
+var pluginLoadTimeout = 5 * time.Second
+
+// plugin is the source written in JavaScript. Script defines refresh()
+// function, that emits proxies, and optional plugin object with homepage,
+// frequency and seed properties. Script has no access to the file system
+// and can make HTTP requests only through fetch(), that uses the same
+// client as other sources.
+type plugin struct {
+	name    string
+	script  *goja.Program
+	timeout time.Duration
+}
+
+type pluginMeta struct {
+	Homepage  string `json:"homepage"`
+	Frequency string `json:"frequency"`
+	Seed      bool   `json:"seed"`
+}
+
+// LoadPlugins reads sources from *.js files in the directory. File name
+// without extension becomes the name of the source. Every refresh() call
+// is interrupted after the timeout.
+func LoadPlugins(dir string, timeout time.Duration) ([]Source, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.js"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	srcs := []Source{}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".js")
+		s, err := newPlugin(name, string(raw), timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		srcs = append(srcs, s)
+	}
+	return srcs, nil
+}
+
+func newPlugin(name, script string, timeout time.Duration) (Source, error) {
+	program, err := goja.Compile(name+".js", script, true)
+	if err != nil {
+		return Source{}, err
+	}
+	p := plugin{
+		name:    name,
+		script:  program,
+		timeout: timeout,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginLoadTimeout)
+	defer cancel()
+	// plugin is loaded without HTTP client, so that fetch() fails
+	// when it's called outside of refresh()
+	vm, err := p.load(ctx, nil, func(pmux.Proxy) {})
+	if err != nil {
+		return Source{}, err
+	}
+	var meta pluginMeta
+	v := vm.Get("plugin")
+	if v != nil && !goja.IsUndefined(v) {
+		err = vm.ExportTo(v, &meta)
+		if err != nil {
+			return Source{}, fmt.Errorf("plugin: %w", err)
+		}
+	}
+	frequency := 1 * time.Hour
+	if meta.Frequency != "" {
+		f, err := app.ParseDuration(meta.Frequency)
+		if err != nil || f <= 0 {
+			return Source{}, fmt.Errorf("invalid frequency: %s", meta.Frequency)
+		}
+		frequency = f
+	}
+	return Source{
+		ID:        declaredID(name),
+		name:      name,
+		Homepage:  meta.Homepage,
+		Frequency: frequency,
+		Seed:      meta.Seed,
+		declared:  true,
+		Feed: func(ctx context.Context, h *http.Client) Src {
+			return gen(func() ([]pmux.Proxy, error) {
+				return p.refresh(ctx, h)
+			})
+		},
+	}, nil
+}
+
+// refresh runs the script in a new VM, so that runs don't share state
+func (p plugin) refresh(ctx context.Context, h *http.Client) ([]pmux.Proxy, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	found := []pmux.Proxy{}
+	vm, err := p.load(ctx, h, func(proxy pmux.Proxy) {
+		found = append(found, proxy)
+	})
+	if err != nil {
+		return nil, p.runErr(ctx, err)
+	}
+	refresh, _ := goja.AssertFunction(vm.Get("refresh"))
+	_, err = p.interruptible(ctx, vm, func() (goja.Value, error) {
+		return refresh(goja.Undefined())
+	})
+	if err != nil {
+		return nil, p.runErr(ctx, err)
+	}
+	log := app.Log.From(ctx)
+	log.Info().Int("count", len(found)).Msg("found")
+	return found, nil
+}
+
+// runErr doesn't retry scripts, that ran out of time
+func (p plugin) runErr(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return skipError(fmt.Sprintf("timed out after %s", p.timeout))
+	}
+	return err
+}
+
+// load runs the top-level code of the script
+func (p plugin) load(ctx context.Context, h *http.Client, emit func(pmux.Proxy)) (*goja.Runtime, error) {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	err := p.bind(ctx, vm, h, emit)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.interruptible(ctx, vm, func() (goja.Value, error) {
+		return vm.RunProgram(p.script)
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, ok := goja.AssertFunction(vm.Get("refresh"))
+	if !ok {
+		return nil, fmt.Errorf("refresh() function is not defined")
+	}
+	return vm, nil
+}
+
+// interruptible stops the script, once the context is done
+func (p plugin) interruptible(ctx context.Context, vm *goja.Runtime, cb func() (goja.Value, error)) (goja.Value, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			vm.Interrupt(ctx.Err())
+		case <-done:
+		}
+	}()
+	return cb()
+}
+
+// bind exposes helpers to the script
+func (p plugin) bind(ctx context.Context, vm *goja.Runtime, h *http.Client, emit func(pmux.Proxy)) error {
+	helpers := map[string]any{
+		// fetch(url, {headers: {...}, expect: "..."}) returns the body of the page
+		"fetch": func(url string, options map[string]any) (string, error) {
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				return "", fmt.Errorf("only http and https urls are allowed: %s", url)
+			}
+			r := req{URL: url}
+			if expect, ok := options["expect"].(string); ok {
+				r.ExpectInResponse = expect
+			}
+			if headers, ok := options["headers"].(map[string]any); ok {
+				r.Headers = map[string]string{}
+				for k, v := range headers {
+					r.Headers[k] = fmt.Sprint(v)
+				}
+			}
+			body, _, err := r.Do(ctx, h)
+			return string(body), err
+		},
+		// findAll(text) returns every IP:port in the text
+		"findAll": func(text string) []string {
+			found := ipPortRegex.FindAllString(text, -1)
+			if found == nil {
+				return []string{}
+			}
+			return found
+		},
+		// match(text, pattern) returns submatches of Go regular expression
+		"match": func(text, pattern string) ([][]string, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.FindAllStringSubmatch(text, -1), nil
+		},
+		// table(html, column...) returns rows of the table with the columns
+		// as objects, where keys are column names
+		"table": func(body string, columns ...string) ([]map[string]string, error) {
+			page, err := htmltable.New(ctx, bytes.NewBufferString(body))
+			if err != nil {
+				return nil, err
+			}
+			table, err := page.FindWithColumns(columns...)
+			if err != nil {
+				return nil, err
+			}
+			rows := []map[string]string{}
+			for _, row := range table.Rows {
+				res := map[string]string{}
+				for i, header := range table.Header {
+					if i < len(row) {
+						res[header] = row[i]
+					}
+				}
+				rows = append(rows, res)
+			}
+			return rows, nil
+		},
+		"atob": func(in string) (string, error) {
+			dec, err := base64.StdEncoding.DecodeString(in)
+			return string(dec), err
+		},
+		"log": func(msg string) {
+			log := app.Log.From(ctx)
+			log.Info().Str("plugin", p.name).Msg(msg)
+		},
+		// emit(addr, protocol) adds proxy like 1.2.3.4:1080 with the protocol,
+		// that defaults to http, or proxy URL like socks5://1.2.3.4:1080
+		"emit": func(addr, protocol string) bool {
+			var proxy pmux.Proxy
+			if strings.Contains(addr, "://") {
+				proxy = pmux.NewProxyFromURL(addr)
+			} else {
+				proxy = pmux.NewProxy(addr, orProtocol(protocol, "http"))
+			}
+			if !proxy.Valid() {
+				return false
+			}
+			emit(proxy)
+			return true
+		},
+	}
+	for name, v := range helpers {
+		err := vm.Set(name, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginRefresh(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "abc" {
+			w.WriteHeader(403)
+			return
+		}
+		switch r.URL.Path {
+		case "/list.txt":
+			w.Write([]byte("Proxy List\n127.0.0.1:8080\n127.0.0.2:8080\n"))
+		case "/table.html":
+			w.Write([]byte(`<table>
+				<tr><th>IP</th><th>Port</th><th>Type</th></tr>
+				<tr><td>MTI3LjAuMC4z</td><td>1080</td><td>SOCKS5</td></tr>
+			</table>`))
+		}
+	}))
+	defer srv.Close()
+
+	s, err := newPlugin("example", `
+	var plugin = {
+		homepage: "https://example.com",
+		frequency: "30m",
+		seed: true
+	};
+	function refresh() {
+		var opts = {headers: {"X-Token": "abc"}, expect: "Proxy List"};
+		findAll(fetch("`+srv.URL+`/list.txt", opts)).forEach(function(addr) {
+			emit(addr, "https");
+		});
+		table(fetch("`+srv.URL+`/table.html", {headers: {"X-Token": "abc"}}), "IP", "Port").forEach(function(row) {
+			emit(atob(row.IP) + ":" + row.Port, row.Type);
+		});
+		match("socks4 127.0.0.4 1080", "(\\w+) ([\\d.]+) (\\d+)").forEach(function(m) {
+			emit(m[1] + "://" + m[2] + ":" + m[3]);
+		});
+		if (emit("not a proxy")) {
+			throw new Error("invalid proxy emitted");
+		}
+	}`, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "example", s.Name())
+	assert.Equal(t, "https://example.com", s.Homepage)
+	assert.Equal(t, 30*time.Minute, s.Frequency)
+	assert.True(t, s.Seed)
+	assert.Equal(t, declaredID("example"), s.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	feed := s.Feed(ctx, http.DefaultClient)
+	found := []string{}
+	for _, v := range consumeSource(ctx, feed) {
+		found = append(found, v.String())
+	}
+	require.NoError(t, feed.Err())
+	sort.Strings(found)
+	assert.Equal(t, []string{
+		"https://127.0.0.1:8080",
+		"https://127.0.0.2:8080",
+		"socks4://127.0.0.4:1080",
+		"socks5://127.0.0.3:1080",
+	}, found)
+}
+
+func TestPluginErrors(t *testing.T) {
+	defer func(orig time.Duration) {
+		pluginLoadTimeout = orig
+	}(pluginLoadTimeout)
+	pluginLoadTimeout = 100 * time.Millisecond
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{`function refresh( {`, "SyntaxError"},
+		{`var x = 1;`, "refresh() function is not defined"},
+		{`var plugin = {frequency: "often"}; function refresh() {}`, "invalid frequency: often"},
+		{`fetch("https://example.com"); function refresh() {}`, "no http client"},
+		{`fetch("file:///etc/passwd"); function refresh() {}`, "only http and https urls are allowed"},
+		{`while (true) {}`, "context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		_, err := newPlugin("broken", tt.script, time.Minute)
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
+
+func TestPluginInterrupted(t *testing.T) {
+	s, err := newPlugin("slow", `function refresh() { while (true) {} }`, time.Minute)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	found := consumeSource(ctx, s.Feed(ctx, http.DefaultClient))
+	assert.Empty(t, found)
+}
+
+func TestPluginTimeout(t *testing.T) {
+	s, err := newPlugin("endless", `function refresh() { while (true) {} }`, 100*time.Millisecond)
+	require.NoError(t, err)
+	// refresher context is not cancelled, so only the timeout stops the loop
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	feed := s.Feed(ctx, http.DefaultClient)
+	found := consumeSource(ctx, feed)
+	assert.Empty(t, found)
+	assert.NoError(t, ctx.Err())
+	assert.EqualError(t, feed.Err(), "timed out after 100ms (skip)")
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "first.js"), []byte(`function refresh() {}`), 0600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "README.md"), []byte(`not a plugin`), 0600)
+	require.NoError(t, err)
+
+	srcs, err := LoadPlugins(dir, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, srcs, 1)
+	assert.Equal(t, "first", srcs[0].Name())
+	assert.Equal(t, 1*time.Hour, srcs[0].Frequency)
+
+	err = os.WriteFile(filepath.Join(dir, "second.js"), []byte(`var x;`), 0600)
+	require.NoError(t, err)
+	_, err = LoadPlugins(dir, time.Minute)
+	assert.EqualError(t, err, filepath.Join(dir, "second.js")+": refresh() function is not defined")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -117,7 +118,7 @@ func premproxyHttpPage(ctx context.Context, h *http.Client, url string) func() (
 			if !ok {
 				continue
 			}
-			addr := fmt.Sprintf("%s:%s", split[0], port)
+			addr := net.JoinHostPort(split[0], port)
 			found = append(found, pmux.HttpsProxy(addr))
 		}
 		return found, nil
@@ -139,7 +140,7 @@ func premproxySocksPage(ctx context.Context, h *http.Client, url string) func()
 			if !ok {
 				continue
 			}
-			addr := fmt.Sprintf("%s:%s", split[0], port)
+			addr := net.JoinHostPort(split[0], port)
 			found = append(found, pmux.NewProxy(addr, strings.ToLower(match[2])))
 		}
 		return found, nil
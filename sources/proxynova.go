@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -65,7 +66,7 @@ func proxyNova(ctx context.Context, h *http.Client) Src {
 					return err
 				}
 				port = strings.ReplaceAll(port, ".0", "")
-				found = append(found, pmux.HttpProxy(proxy+":"+port))
+				found = append(found, pmux.HttpProxy(net.JoinHostPort(proxy, port)))
 				return nil
 			})
 			if err != nil {
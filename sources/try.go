@@ -104,7 +104,7 @@ func (f *retriableGenerator) generate(ctx context.Context) {
 				// TODO: proxy pool exhausted should trigger sleep
 				evt.Msg("intermediate failure")
 				proxy := se.Proxy()
-				if proxy != 0 {
+				if proxy.Valid() {
 					f.out <- Signal{
 						Proxy: proxy,
 						Err:   fmt.Errorf(se.msg),
@@ -29,7 +29,7 @@ var countries = []string{
 	"VN", "ZA",
 }
 
-var ipPortRegex = regexp.MustCompile(`(?m)\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}:\d{2,5}`)
+var ipPortRegex = regexp.MustCompile(`(?m)(?:\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}|\[[0-9a-fA-F:.]{2,45}\]):\d{2,5}`)
 
 func newRegexPage(ctx context.Context, h *http.Client, url, expect string,
 	cb func(proxy string) pmux.Proxy) (found []pmux.Proxy, err error) {
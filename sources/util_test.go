@@ -33,6 +33,20 @@ func TestExtractProxiesFromReaderNoProxies(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestExtractProxiesFromReaderIPv6(t *testing.T) {
+	body := []byte(`1.2.3.4:8080 <td>[2001:db8::1]:3128</td> [::ffff:5.6.7.8]:80`)
+	found, err := extractProxiesFromReader(context.Background(), "..", body,
+		func(proxy string) pmux.Proxy {
+			return pmux.HttpProxy(proxy)
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []pmux.Proxy{
+		pmux.HttpProxy("1.2.3.4:8080"),
+		pmux.HttpProxy("[2001:db8::1]:3128"),
+		pmux.HttpProxy("5.6.7.8:80"),
+	}, found)
+}
+
 func TestFindLinksWithOnError(t *testing.T) {
 	_, err := findLinksWithOn(context.Background(), nil, "..", "..")
 	assert.EqualError(t, err, "no http client (skip)")
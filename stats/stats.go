@@ -2,6 +2,7 @@ package stats
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"net/http"
 	"time"
@@ -80,8 +81,9 @@ func NewStats() *Stats {
 	}
 }
 
-func (s *Stats) Start(ctx app.Context) {
+func (s *Stats) Start(ctx app.Context) error {
 	go s.main(ctx)
+	return nil
 }
 
 func (s *Stats) Launch(source int) {
@@ -121,6 +123,22 @@ func (s *Stats) Snapshot() Sources {
 	return <-req
 }
 
+// Ping goes through the main loop
+func (s *Stats) Ping(ctx context.Context) error {
+	out := make(chan Sources, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.snapshot <- out:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-out:
+		return nil
+	}
+}
+
 func (s *Stats) HttpGet(_ *http.Request) (interface{}, error) {
 	return s.Snapshot(), nil
 }